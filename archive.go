@@ -0,0 +1,75 @@
+// Read config inputs from tar archives.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+const (
+	// Archive member skipped since its format can't be detected.
+	warnSkippedArchiveMember = "skipped-archive-member"
+)
+
+// Check if input is a tar archive from its name.
+func isTarArchive(name string) bool {
+	n := strings.ToLower(name)
+	return strings.HasSuffix(n, ".tar") || strings.HasSuffix(n, ".tar.gz") || strings.HasSuffix(n, ".tgz")
+}
+
+// Read members of tar archive as inputs. Format of every member is detected from its name and
+// members with unknown format are skipped. If archive prefix is set then path of member within
+// the archive without extension is used as its prefix. Ex: config/db.toml => config/db
+func tarArchiveInputs(name string, r io.Reader, delimiter string) ([]configInput, error) {
+	if n := strings.ToLower(name); strings.HasSuffix(n, ".gz") || strings.HasSuffix(n, ".tgz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var inputs []configInput
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		member := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+		cType, err := inputType(member, "")
+		if err != nil {
+			addWarning(warnSkippedArchiveMember, "skipped %s in %s since its format can't be detected", member, name)
+			continue
+		}
+
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		in := configInput{name: name + ":" + member, cType: cType, r: bytes.NewReader(b)}
+		if kvArchivePrefix {
+			in.prefix = strings.Replace(strings.TrimSuffix(member, path.Ext(member)), "/", delimiter, -1)
+		}
+
+		inputs = append(inputs, in)
+	}
+
+	return inputs, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Write tar archive of files in order to path, gzip compressed if path ends with .gz or .tgz.
+func writeTestTar(t *testing.T, fPath string, files [][2]string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "./db/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f[0], Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(f[1]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	if strings.HasSuffix(fPath, ".gz") || strings.HasSuffix(fPath, ".tgz") {
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		zw.Write(b)
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		b = gz.Bytes()
+	}
+
+	if err := ioutil.WriteFile(fPath, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTarArchiveInputs(t *testing.T) {
+	dir := t.TempDir()
+	files := [][2]string{
+		{"app.toml", "name = \"app\"\n"},
+		{"./db/primary.yaml", "port: 5432\n"},
+		{"README.txt", "not a config"},
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"configs.tar", []string{"--prefix", "myconfig"}, "myconfig/name=\"app\"\nmyconfig/port=5432"},
+		{"configs.tar.gz", []string{"--prefix", "myconfig", "--archive-prefix"}, "myconfig/app/name=\"app\"\nmyconfig/db/primary/port=5432"},
+		{"configs.tgz", []string{"--archive-prefix", "--delimiter", "."}, "app.name=\"app\"\ndb.primary.port=5432"},
+	}
+
+	for _, tt := range tests {
+		fPath := filepath.Join(dir, tt.name)
+		writeTestTar(t, fPath, files)
+
+		if got := pairLines(t, testKVPairs(t, append(tt.args, fPath)...)); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	// Members of unknown format are skipped with a warning.
+	fPath := filepath.Join(dir, "configs.tar")
+	_, stderr, code := runCLI(t, "", "kv", fPath)
+	if code != 0 || !strings.Contains(stderr, "[skipped-archive-member] skipped README.txt in "+fPath) {
+		t.Errorf("exit code %d, stderr %q", code, stderr)
+	}
+
+	// Corrupt archive is an error.
+	broken := writeTestFile(t, "broken.tar.gz", "not gzip")
+	if _, stderr, code := runCLI(t, "", "kv", broken); code == 0 {
+		t.Errorf("expected error for corrupt archive, stderr %q", stderr)
+	}
+}
@@ -0,0 +1,232 @@
+// Extract comments above keys from TOML configs.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// Suffix of keys which hold comments of a key.
+const docKeySuffix = "__doc"
+
+// Suffix of keys which hold checksum of value of a key.
+const checksumKeySuffix = "__sum"
+
+// Extract comments written immediately above keys in TOML config. Returns a map of key path to
+// comment text where comment lines are joined with new line. It's a line scanner, not a full TOML
+// parser. Supported are keys and table headers with bare, quoted and dotted keys, trailing comments,
+// and values spanning lines (multi line strings, arrays and inline tables) which are skipped. Keys of
+// array of tables and of their sub tables are ignored, as are comments inside multi line values.
+func tomlKeyComments(b []byte) map[string]string {
+	var (
+		docs     = make(map[string]string)
+		table    []string
+		inArray  bool
+		comments []string
+		// Paths of array of tables seen so far.
+		arrays []string
+		// Multi line string delimiter if inside a multi line string.
+		mlString string
+		// Depth of brackets if inside a multi line array or inline table.
+		depth int
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip lines till multi line string or array ends.
+		if mlString != "" {
+			if strings.Count(line, mlString)%2 == 1 {
+				mlString = ""
+			}
+			continue
+		}
+		if depth > 0 {
+			depth += bracketDepth(line)
+			continue
+		}
+
+		switch {
+		case line == "":
+			comments = nil
+
+		case strings.HasPrefix(line, "#"):
+			comments = append(comments, strings.TrimSpace(strings.TrimPrefix(line, "#")))
+
+		case strings.HasPrefix(line, "[["):
+			if end := indexUnquoted(line, "]]"); end != -1 {
+				arrays = append(arrays, strings.Join(splitTOMLKey(line[2:end]), "."))
+			}
+			inArray = true
+			comments = nil
+
+		case strings.HasPrefix(line, "["):
+			end := indexUnquoted(line, "]")
+			if end == -1 {
+				comments = nil
+				continue
+			}
+
+			// Sub tables of array of tables are tables of array items.
+			table = splitTOMLKey(line[1:end])
+			inArray = false
+			for _, a := range arrays {
+				if hasPathPrefix(strings.Join(table, "."), a, ".") {
+					inArray = true
+				}
+			}
+			comments = nil
+
+		default:
+			i := indexUnquoted(line, "=")
+			if i == -1 {
+				comments = nil
+				continue
+			}
+
+			value := strings.TrimSpace(line[i+1:])
+			for _, d := range []string{`"""`, `'''`} {
+				if strings.HasPrefix(value, d) && strings.Count(value, d)%2 == 1 {
+					mlString = d
+				}
+			}
+			if mlString == "" {
+				depth = bracketDepth(value)
+			}
+
+			if len(comments) > 0 && !inArray {
+				path := append(append([]string{}, table...), splitTOMLKey(line[:i])...)
+				docs[strings.ToLower(strings.Join(path, "."))] = strings.Join(comments, "\n")
+			}
+			comments = nil
+		}
+	}
+
+	return docs
+}
+
+// Add comments to config map as `<key>__doc` sibling keys.
+func addDocKeys(m map[string]interface{}, docs map[string]string) {
+	for path, doc := range docs {
+		segments := strings.Split(path, ".")
+		parent := m
+		for _, seg := range segments[:len(segments)-1] {
+			child, ok := parent[seg].(map[string]interface{})
+			if !ok {
+				parent = nil
+				break
+			}
+			parent = child
+		}
+
+		if parent == nil {
+			continue
+		}
+
+		last := segments[len(segments)-1]
+		if _, ok := parent[last]; ok {
+			parent[last+docKeySuffix] = doc
+		}
+	}
+}
+
+// Split TOML key into its parts. Ex: a."b.c".d => [a b.c d]. Escaped quotes in basic strings
+// are unescaped, other escape sequences are kept as is.
+func splitTOMLKey(key string) []string {
+	var (
+		parts   []string
+		cur     strings.Builder
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range strings.TrimSpace(key) {
+		switch {
+		case escaped:
+			if r != '"' && r != '\\' {
+				cur.WriteRune('\\')
+			}
+			cur.WriteRune(r)
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '.':
+			parts = append(parts, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+
+	return append(parts, strings.TrimSpace(cur.String()))
+}
+
+// Get index of first occurrence of sep in line outside quoted strings, or -1 if it's not found or is
+// after a comment. Ex: index of = in "a=b" = 1 is 6.
+func indexUnquoted(line string, sep string) int {
+	var (
+		quote   byte
+		escaped bool
+	)
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return -1
+		case strings.HasPrefix(line[i:], sep):
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Get change in bracket depth for a line, ignoring brackets inside strings and comments.
+func bracketDepth(s string) int {
+	var (
+		depth   int
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return depth
+		case r == '[' || r == '{':
+			depth++
+		case r == ']' || r == '}':
+			depth--
+		}
+	}
+
+	return depth
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTOMLKeyComments(t *testing.T) {
+	tests := []struct {
+		name string
+		toml string
+		want map[string]string
+	}{
+		{
+			name: "keys and tables",
+			toml: "# Name of app\n# Shown in UI\nname = \"app\"\n\n[db]\n# DB port\nport = 5432\n",
+			want: map[string]string{"name": "Name of app\nShown in UI", "db.port": "DB port"},
+		},
+		{
+			name: "blank line detaches comment",
+			toml: "# Detached\n\nname = \"app\"\n",
+			want: map[string]string{},
+		},
+		{
+			name: "hash inside quoted values and headers",
+			toml: "[\"a#b\"] # Table [comment]\n# Key\nurl = \"http://host/#anchor\"\n# Next\nnext = 1\n",
+			want: map[string]string{"a#b.url": "Key", "a#b.next": "Next"},
+		},
+		{
+			name: "dotted and quoted keys",
+			toml: "[server.\"tls.v2\"]\n# Cert\ncert.path = \"/etc/cert\"\n# Equals in key\n\"a=b\" = 1\n# Escaped quote\n\"x\\\"y\" = 2\n",
+			want: map[string]string{"server.tls.v2.cert.path": "Cert", "server.tls.v2.a=b": "Equals in key", "server.tls.v2.x\"y": "Escaped quote"},
+		},
+		{
+			name: "multi line strings",
+			toml: "# Text\ntext = \"\"\"\n# not a comment\nkey = 1\n\"\"\"\n# After\nafter = '''one line'''\n# Literal\nlit = '''\n[not.a.table]\n'''\n# Last\nlast = true\n",
+			want: map[string]string{"text": "Text", "after": "After", "lit": "Literal", "last": "Last"},
+		},
+		{
+			name: "multi line arrays and inline tables",
+			toml: "# Hosts\nhosts = [\n  # not a key comment\n  \"a\", # ]\n  \"b]\",\n]\n# Inline\ninline = { a = [1, 2], b = \"}\" }\n# After\nafter = 1\n",
+			want: map[string]string{"hosts": "Hosts", "inline": "Inline", "after": "After"},
+		},
+		{
+			name: "array of tables and sub tables are ignored",
+			toml: "[[servers]]\n# Ignored\nname = \"a\"\n\n[servers.tls]\n# Ignored too\ncert = \"x\"\n\n[serversx]\n# Kept\nname = \"b\"\n",
+			want: map[string]string{"serversx.name": "Kept"},
+		},
+		{
+			name: "keys are lower cased",
+			toml: "[DB]\n# Port\nPort = 1\n",
+			want: map[string]string{"db.port": "Port"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := tomlKeyComments([]byte(tt.toml))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSplitTOMLKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"a", []string{"a"}},
+		{" a . b ", []string{"a", "b"}},
+		{`a."b.c".d`, []string{"a", "b.c", "d"}},
+		{`'x.y'.z`, []string{"x.y", "z"}},
+		{`"q\"uote"`, []string{`q"uote`}},
+	}
+
+	for _, tt := range tests {
+		if got := splitTOMLKey(tt.key); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitTOMLKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -3,14 +3,22 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
+	"os"
 	"strings"
 
 	"github.com/spf13/viper"
+	"github.com/vividvilla/consul-cfg/parser"
 )
 
-// Parse config file to a map
+// Parse config file to a map. Custom formats are parsed by their registered parser.
 func configToMap(cType string, r io.Reader) (map[string]interface{}, error) {
+	if p, ok := parser.Get(cType); ok {
+		return p.Parse(r)
+	}
+
 	viper.SetConfigType(cType)
 	err := viper.ReadConfig(r)
 	if err != nil {
@@ -20,6 +28,83 @@ func configToMap(cType string, r io.Reader) (map[string]interface{}, error) {
 	return viper.AllSettings(), nil
 }
 
+// Parse config to a map using a new viper instance, so it can be called concurrently. Custom formats
+// are parsed by their registered parser. Keys with null values are kept if keepNulls is set.
+func parseConfig(cType string, r io.Reader, keepNulls bool) (map[string]interface{}, error) {
+	if p, ok := parser.Get(cType); ok {
+		return p.Parse(r)
+	}
+
+	v := viper.New()
+	v.SetConfigType(cType)
+	if cType == "json" {
+		if err := readJSONConfig(v, r); err != nil {
+			return nil, err
+		}
+	} else if err := v.ReadConfig(r); err != nil {
+		return nil, err
+	}
+
+	m := v.AllSettings()
+	if keepNulls {
+		addNullValues(v, m)
+	}
+
+	return m, nil
+}
+
+// Read JSON config to viper with numbers decoded as json.Number instead of float64, so that integers
+// beyond float64 precision are kept exactly, ex: 9007199254740993. Values are set as defaults since viper
+// can't read a decoded map, keys are made case insensitive the same way as by ReadConfig.
+func readJSONConfig(v *viper.Viper, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var m map[string]interface{}
+	if err := dec.Decode(&m); err != nil {
+		return fmt.Errorf("While parsing config: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("While parsing config: invalid data after top-level value")
+	}
+
+	for k, val := range m {
+		v.SetDefault(k, val)
+	}
+
+	return nil
+}
+
+// Add keys holding null values in parsed config to the map since viper leaves them out of settings.
+func addNullValues(v *viper.Viper, m map[string]interface{}) {
+	for _, k := range v.AllKeys() {
+		if v.Get(k) != nil {
+			continue
+		}
+
+		path := strings.Split(k, ".")
+		parent := m
+		for _, seg := range path[:len(path)-1] {
+			v, ok := parent[seg]
+			if !ok {
+				v = make(map[string]interface{})
+				parent[seg] = v
+			}
+
+			child, ok := v.(map[string]interface{})
+			if !ok {
+				parent = nil
+				break
+			}
+			parent = child
+		}
+
+		if parent != nil {
+			parent[path[len(path)-1]] = nil
+		}
+	}
+}
+
 // Check if given input format is supported.
 func isValidInputFormat(format string, availFormats []string) bool {
 	for _, f := range availFormats {
@@ -35,3 +120,38 @@ func isValidInputFormat(format string, availFormats []string) bool {
 func formatsToString(formats []string) string {
 	return strings.Join(formats, ", ")
 }
+
+// Get environment variable or default value if it's not set.
+func envOrDefault(key string, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return def
+}
+
+// Trim all leading and trailing delimiters from the string.
+func trimDelimiter(s string, delimiter string) string {
+	for strings.HasPrefix(s, delimiter) {
+		s = strings.TrimPrefix(s, delimiter)
+	}
+
+	for strings.HasSuffix(s, delimiter) {
+		s = strings.TrimSuffix(s, delimiter)
+	}
+
+	return s
+}
+
+// Join two key parts with delimiter. Empty parts are ignored.
+func joinKey(a string, b string, delimiter string) string {
+	if a == "" {
+		return b
+	}
+
+	if b == "" {
+		return a
+	}
+
+	return a + delimiter + b
+}
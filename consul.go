@@ -0,0 +1,223 @@
+// Minimal Consul HTTP API client.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Max number of operations allowed in a single Consul transaction.
+const consulMaxTxnOps = 64
+
+// Consul's default max request size of a transaction (`txn_max_req_len`).
+const consulMaxTxnSize = 512 * 1024
+
+type consulClient struct {
+	addr  string
+	token string
+	http  *http.Client
+}
+
+// Transaction operation. Only KV operations are supported.
+type consulTxnOp struct {
+	KV consulTxnKVOp `json:"KV"`
+}
+
+type consulTxnKVOp struct {
+	Verb  string `json:"Verb"`
+	Key   string `json:"Key"`
+	Value string `json:"Value,omitempty"`
+	Flags uint64 `json:"Flags,omitempty"`
+}
+
+// Error response of a failed transaction.
+type consulTxnError struct {
+	OpIndex int    `json:"OpIndex"`
+	What    string `json:"What"`
+}
+
+func newConsulClient(addr string, token string) *consulClient {
+	// Default to http if scheme is not given. Ex: 127.0.0.1:8500
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	return &consulClient{
+		addr:  strings.TrimSuffix(addr, "/"),
+		token: token,
+		http:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Make a request to Consul and decode JSON response to out if it's not nil.
+// Returns status code of the response.
+func (c *consulClient) do(method string, path string, query url.Values, body interface{}, out interface{}) (int, error) {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+
+	u := c.addr + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, &reqBody)
+	if err != nil {
+		return 0, err
+	}
+
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+
+	if resp.StatusCode >= 300 {
+		// Some endpoints like txn return error details as JSON.
+		if out != nil && json.Unmarshal(b, out) == nil {
+			return resp.StatusCode, nil
+		}
+
+		return resp.StatusCode, fmt.Errorf("unexpected response %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	if out != nil && len(b) > 0 {
+		if err := json.Unmarshal(b, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("error decoding response: %v", err)
+		}
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Apply operations in a single transaction.
+func (c *consulClient) txn(ops []consulTxnOp) error {
+	if len(ops) > consulMaxTxnOps {
+		return fmt.Errorf("transaction can't have more than %d operations", consulMaxTxnOps)
+	}
+
+	var resp struct {
+		Errors []consulTxnError `json:"Errors"`
+	}
+
+	code, err := c.do(http.MethodPut, "/v1/txn", nil, ops, &resp)
+	if err != nil {
+		return err
+	}
+
+	// Transaction is rolled back if any operation fails.
+	if len(resp.Errors) > 0 {
+		var msgs []string
+		for _, e := range resp.Errors {
+			if e.OpIndex >= 0 && e.OpIndex < len(ops) {
+				msgs = append(msgs, fmt.Sprintf("%s: %s", ops[e.OpIndex].KV.Key, e.What))
+			} else {
+				msgs = append(msgs, e.What)
+			}
+		}
+
+		return fmt.Errorf("transaction rolled back - %s", strings.Join(msgs, ", "))
+	}
+
+	if code != http.StatusOK {
+		return fmt.Errorf("unexpected response %d", code)
+	}
+
+	return nil
+}
+
+// List keys under prefix. Returns no keys if there are none.
+func (c *consulClient) keys(prefix string) ([]string, error) {
+	var keys []string
+	code, err := c.do(http.MethodGet, "/v1/kv/"+prefix, url.Values{"keys": []string{""}}, nil, &keys)
+	if code == http.StatusNotFound {
+		return nil, nil
+	}
+
+	return keys, err
+}
+
+// Get KV pairs under prefix. Returns no pairs if there are none.
+func (c *consulClient) list(prefix string) ([]consulKVPair, error) {
+	var pairs []consulKVPair
+	code, err := c.do(http.MethodGet, "/v1/kv/"+prefix, url.Values{"recurse": []string{""}}, nil, &pairs)
+	if code == http.StatusNotFound {
+		return nil, nil
+	}
+
+	return pairs, err
+}
+
+// Get KV pair of key. Returns no pairs if key doesn't exist.
+func (c *consulClient) get(key string) ([]consulKVPair, error) {
+	var pairs []consulKVPair
+	code, err := c.do(http.MethodGet, "/v1/kv/"+key, nil, nil, &pairs)
+	if code == http.StatusNotFound {
+		return nil, nil
+	}
+
+	return pairs, err
+}
+
+// Session used to hold locks.
+type consulSession struct {
+	Name      string `json:"Name"`
+	TTL       string `json:"TTL"`
+	LockDelay string `json:"LockDelay"`
+}
+
+// Create session and return its ID.
+func (c *consulClient) createSession(s consulSession) (string, error) {
+	var resp struct {
+		ID string `json:"ID"`
+	}
+	if _, err := c.do(http.MethodPut, "/v1/session/create", nil, s, &resp); err != nil {
+		return "", err
+	}
+
+	return resp.ID, nil
+}
+
+// Renew TTL of session.
+func (c *consulClient) renewSession(id string) error {
+	_, err := c.do(http.MethodPut, "/v1/session/renew/"+id, nil, nil, nil)
+	return err
+}
+
+// Destroy session. Locks held by the session are released.
+func (c *consulClient) destroySession(id string) error {
+	_, err := c.do(http.MethodPut, "/v1/session/destroy/"+id, nil, nil, nil)
+	return err
+}
+
+// Acquire lock on key for session with value as its content. Returns false if the lock is held by another session.
+func (c *consulClient) acquire(key string, session string, value interface{}) (bool, error) {
+	var ok bool
+	_, err := c.do(http.MethodPut, "/v1/kv/"+key, url.Values{"acquire": []string{session}}, value, &ok)
+	return ok, err
+}
+
+// Release lock on key held by session.
+func (c *consulClient) release(key string, session string) error {
+	_, err := c.do(http.MethodPut, "/v1/kv/"+key, url.Values{"release": []string{session}}, nil, nil)
+	return err
+}
@@ -0,0 +1,254 @@
+// CUE output of KV pairs.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Name of the definition which has inferred types of the config.
+const cueDefinition = "#Config"
+
+// Labels which can be written without quotes.
+var cueIdentRe = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// CUE keywords which have to be quoted when used as labels.
+var cueKeywords = map[string]bool{
+	"package": true, "import": true, "for": true, "in": true, "if": true, "let": true,
+	"true": true, "false": true, "null": true,
+}
+
+// Reconstruct config from KV pairs as CUE. A definition with types inferred from values is written
+// first followed by the values, which are unified with the definition by embedding it.
+func cueConfig(pairs []consulKVPair) (string, error) {
+	m, err := pairsToMap(pairs, kvDelimiter, true)
+	if err != nil {
+		return "", err
+	}
+
+	if kvCollapseSingleKeyMaps {
+		if err := collapseSingleKeyMaps(m, collapsedKeySeparator); err != nil {
+			return "", err
+		}
+	}
+
+	buf := bytes.NewBufferString("")
+	fmt.Fprintf(buf, "%s: %s\n\n%s\n\n", cueDefinition, cueType(inferSchema(cueSchemaValue(m)), 0), cueDefinition)
+	if err := writeCueFields(buf, m, 0); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// Convert JSON numbers to int64 or float64 so that their schema can be inferred.
+func cueSchemaValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+		return t
+
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[k] = cueSchemaValue(val)
+		}
+		return m
+
+	case []interface{}:
+		arr := make([]interface{}, len(t))
+		for i, val := range t {
+			arr[i] = cueSchemaValue(val)
+		}
+		return arr
+	}
+
+	return v
+}
+
+// Get CUE type of inferred schema. Keys which are not in every item of an array are optional.
+func cueType(s *jsonSchema, indent int) string {
+	if s == nil || len(s.types) == 0 {
+		return "_"
+	}
+
+	var types []string
+	for _, t := range s.types {
+		switch t {
+		case "object":
+			if len(s.properties) == 0 {
+				types = append(types, "{}")
+				continue
+			}
+
+			required := make(map[string]bool, len(s.required))
+			for _, k := range s.required {
+				required[k] = true
+			}
+
+			var b strings.Builder
+			b.WriteString("{\n")
+			for _, k := range sortedSchemaKeys(s.properties) {
+				opt := ""
+				if !required[k] {
+					opt = "?"
+				}
+				fmt.Fprintf(&b, "%s%s%s: %s\n", cueIndent(indent+1), cueLabel(k), opt, cueType(s.properties[k], indent+1))
+			}
+			b.WriteString(cueIndent(indent) + "}")
+			types = append(types, b.String())
+
+		case "array":
+			if s.items == nil {
+				types = append(types, "[...]")
+				continue
+			}
+
+			item := cueType(s.items, indent)
+			if strings.Contains(item, " | ") {
+				item = "(" + item + ")"
+			}
+			types = append(types, "[..."+item+"]")
+
+		case "integer":
+			types = append(types, "int")
+		case "number":
+			types = append(types, "number")
+		case "boolean":
+			types = append(types, "bool")
+		default:
+			types = append(types, t)
+		}
+	}
+
+	return strings.Join(types, " | ")
+}
+
+// Write fields of map in sorted order.
+func writeCueFields(buf *bytes.Buffer, m map[string]interface{}, indent int) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v, err := cueValue(m[k], indent)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(buf, "%s%s: %s\n", cueIndent(indent), cueLabel(k), v)
+	}
+
+	return nil
+}
+
+// Get CUE literal of decoded JSON value. Arrays of scalars are written in a single line.
+func cueValue(v interface{}, indent int) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "null", nil
+
+	case bool:
+		return strconv.FormatBool(t), nil
+
+	case json.Number:
+		return t.String(), nil
+
+	case string:
+		return cueString(t)
+
+	case map[string]interface{}:
+		if len(t) == 0 {
+			return "{}", nil
+		}
+
+		buf := bytes.NewBufferString("{\n")
+		if err := writeCueFields(buf, t, indent+1); err != nil {
+			return "", err
+		}
+		buf.WriteString(cueIndent(indent) + "}")
+		return buf.String(), nil
+
+	case []interface{}:
+		items := make([]string, len(t))
+		multiline := false
+		for i, item := range t {
+			s, err := cueValue(item, indent+1)
+			if err != nil {
+				return "", err
+			}
+
+			items[i] = s
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				multiline = true
+			}
+		}
+
+		if !multiline {
+			return "[" + strings.Join(items, ", ") + "]", nil
+		}
+
+		var b strings.Builder
+		b.WriteString("[\n")
+		for _, s := range items {
+			b.WriteString(cueIndent(indent+1) + s + ",\n")
+		}
+		b.WriteString(cueIndent(indent) + "]")
+		return b.String(), nil
+	}
+
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+// Quote string as CUE string. JSON strings are valid CUE strings and `\` is always escaped,
+// so there is no string interpolation.
+func cueString(s string) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// Get label for key. Keys which aren't identifiers, keywords and keys starting with `_` (hidden)
+// or `#` (definition) are quoted.
+func cueLabel(k string) string {
+	if cueIdentRe.MatchString(k) && !cueKeywords[k] {
+		return k
+	}
+
+	s, _ := cueString(k)
+	return s
+}
+
+func cueIndent(n int) string {
+	return strings.Repeat("\t", n)
+}
+
+// Get sorted keys of schema properties.
+func sortedSchemaKeys(m map[string]*jsonSchema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
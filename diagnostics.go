@@ -0,0 +1,90 @@
+// Diagnostics of converted KV pairs printed to stderr.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Max width of histogram bars.
+const histogramWidth = 40
+
+// Count keys by number of path segments. Index 0 is depth 1.
+func keyDepthCounts(pairs []consulKVPair, delimiter string) []int {
+	var counts []int
+	for _, p := range pairs {
+		depth := len(splitKey(trimDelimiter(p.Key, delimiter), delimiter))
+		for len(counts) < depth {
+			counts = append(counts, 0)
+		}
+		counts[depth-1]++
+	}
+
+	return counts
+}
+
+// Print histogram of key depths. Bars are scaled to the most common depth.
+func printKeyDepthHistogram(pairs []consulKVPair, delimiter string) {
+	counts := keyDepthCounts(pairs, delimiter)
+
+	max := 0
+	for _, c := range counts {
+		if c > max {
+			max = c
+		}
+	}
+
+	depthWidth := len(fmt.Sprint(len(counts)))
+	countWidth := len(fmt.Sprint(max))
+
+	errLog.Printf("Key depth histogram (%d keys):", len(pairs))
+	for i, c := range counts {
+		bar := 0
+		if c > 0 {
+			bar = (c*histogramWidth + max - 1) / max
+		}
+		errLog.Print(strings.TrimRight(fmt.Sprintf("  %*d | %*d %s", depthWidth, i+1, countWidth, c, strings.Repeat("#", bar)), " "))
+	}
+}
+
+// Print size in bytes of value of every key, largest first, with totals of keys and values.
+// Sizes are of values as stored in Consul, ie. JSON encoded before base64 encoding.
+func printValueLengths(pairs []consulKVPair) {
+	type keySize struct {
+		key  string
+		size int
+	}
+
+	sizes := make([]keySize, 0, len(pairs))
+	keysTotal, valuesTotal := 0, 0
+	for _, p := range pairs {
+		v, err := pairValue(p)
+		if err != nil {
+			continue
+		}
+
+		sizes = append(sizes, keySize{key: p.Key, size: len(v)})
+		keysTotal += len(p.Key)
+		valuesTotal += len(v)
+	}
+
+	sort.SliceStable(sizes, func(i, j int) bool {
+		return sizes[i].size > sizes[j].size
+	})
+
+	errLog.Printf("Value lengths (%d keys, %d bytes of values, %d bytes of keys):", len(sizes), valuesTotal, keysTotal)
+	if len(sizes) == 0 {
+		return
+	}
+
+	width := len(fmt.Sprint(sizes[0].size))
+	for _, s := range sizes {
+		line := fmt.Sprintf("  %*d %s", width, s.size, s.key)
+		if s.size > consulMaxValueSize {
+			line += " (exceeds Consul's default limit)"
+		}
+		errLog.Print(line)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyDepthCounts(t *testing.T) {
+	pairs := []consulKVPair{testPair("a", "1"), testPair("a/b/c/d", "1"), testPair("/x/y/", "1")}
+
+	// Depths without keys are zero and leading and trailing delimiters don't count.
+	if got, want := keyDepthCounts(pairs, "/"), []int{1, 1, 0, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestKeyDepthHistogram(t *testing.T) {
+	config := filepath.Join("testdata", "config.toml")
+
+	_, stderr, code := runCLI(t, "", "kv", "--key-depth-histogram", config)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %s", code, stderr)
+	}
+	want := "Key depth histogram (9 keys):\n" +
+		"  1 | 4 " + strings.Repeat("#", 40) + "\n" +
+		"  2 | 3 " + strings.Repeat("#", 30) + "\n" +
+		"  3 | 2 " + strings.Repeat("#", 20) + "\n"
+	if stderr != want {
+		t.Errorf("got\n%s\nwant\n%s", stderr, want)
+	}
+
+	// Prefix adds a level.
+	_, stderr, _ = runCLI(t, "", "kv", "--key-depth-histogram", "--prefix", "app/billing", config)
+	if !strings.Contains(stderr, "  3 | 4 "+strings.Repeat("#", 40)+"\n") {
+		t.Errorf("histogram with prefix:\n%s", stderr)
+	}
+
+	_, stderr, _ = runCLI(t, "", "kv", "--key-depth-histogram", "--quiet", config)
+	if stderr != "" {
+		t.Errorf("quiet should suppress histogram, got %s", stderr)
+	}
+}
+
+func TestValueLengths(t *testing.T) {
+	fPath := writeTestFile(t, "config.toml", `name = "billing"
+port = 5432
+enabled = true
+`)
+
+	// Sizes are of JSON encoded values, ex: "billing" is 9 bytes with quotes.
+	_, stderr, code := runCLI(t, "", "kv", "--emit-value-lengths", "--prefix", "app", fPath)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %s", code, stderr)
+	}
+	want := "Value lengths (3 keys, 17 bytes of values, 27 bytes of keys):\n" +
+		"  9 app/name\n" +
+		"  4 app/enabled\n" +
+		"  4 app/port\n"
+	if stderr != want {
+		t.Errorf("got\n%s\nwant\n%s", stderr, want)
+	}
+
+	// Values over Consul's limit are flagged.
+	big := writeTestFile(t, "big.json", `{"blob": "`+strings.Repeat("x", consulMaxValueSize)+`", "port": 1}`)
+	_, stderr, _ = runCLI(t, "", "kv", "--emit-value-lengths", big)
+	if !strings.Contains(stderr, "  524290 blob (exceeds Consul's default limit)\n       1 port\n") {
+		t.Errorf("oversized value isn't flagged:\n%s", stderr)
+	}
+
+	_, stderr, _ = runCLI(t, "", "kv", "--emit-value-lengths", "-q", fPath)
+	if stderr != "" {
+		t.Errorf("quiet should suppress value lengths, got %s", stderr)
+	}
+}
@@ -0,0 +1,235 @@
+// Diff and overlay of KV pairs.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Available diff formats.
+var kvDiffFormats = []string{"txn", "unified", "json", "summary"}
+
+// Change of a key between base and target KV pairs. Old is nil for added keys and new for removed keys.
+type kvChange struct {
+	op  string
+	key string
+	old *consulKVPair
+	new *consulKVPair
+}
+
+// Get changes from base KV pairs to target KV pairs and the number of unchanged keys. Added and changed
+// keys are in order of target and removed keys in order of base. Last value of repeated keys is used.
+func kvChanges(base, target []consulKVPair) ([]kvChange, int) {
+	base = dedupeKVPairs(base)
+	target = dedupeKVPairs(target)
+
+	baseByKey := make(map[string]int, len(base))
+	for i, p := range base {
+		baseByKey[p.Key] = i
+	}
+
+	var (
+		changes   []kvChange
+		unchanged int
+	)
+	inTarget := make(map[string]bool, len(target))
+	for i, p := range target {
+		inTarget[p.Key] = true
+		j, ok := baseByKey[p.Key]
+		if !ok {
+			changes = append(changes, kvChange{op: "added", key: p.Key, new: &target[i]})
+			continue
+		}
+
+		if b := base[j]; b.Value == p.Value && b.Flags == p.Flags {
+			unchanged++
+			continue
+		}
+		changes = append(changes, kvChange{op: "changed", key: p.Key, old: &base[j], new: &target[i]})
+	}
+
+	for i, p := range base {
+		if !inTarget[p.Key] {
+			changes = append(changes, kvChange{op: "removed", key: p.Key, old: &base[i]})
+		}
+	}
+
+	return changes, unchanged
+}
+
+// Get operations to turn base KV pairs into target KV pairs. Added and changed keys are set in
+// order of target and removed keys are deleted in order of base. Last value of repeated keys is used.
+func diffKVPairs(base, target []consulKVPair) []consulTxnOp {
+	changes, _ := kvChanges(base, target)
+
+	ops := []consulTxnOp{}
+	for _, c := range changes {
+		if c.new == nil {
+			ops = append(ops, consulTxnOp{KV: consulTxnKVOp{Verb: "delete", Key: c.key}})
+			continue
+		}
+
+		ops = append(ops, consulTxnOp{KV: consulTxnKVOp{
+			Verb:  "set",
+			Key:   c.key,
+			Value: c.new.Value,
+			Flags: c.new.Flags,
+		}})
+	}
+
+	return ops
+}
+
+// Get diff of KV pairs from base in given format. `txn` writes Consul transaction operations, `unified`
+// writes changed keys as removed and added lines, `json` writes changes with old and new values and
+// `summary` writes only the number of keys of every kind of change.
+func kvDiffToString(format string, base, target []consulKVPair, baseName, targetName string) (string, error) {
+	switch format {
+	case "txn":
+		b, err := json.MarshalIndent(diffKVPairs(base, target), "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+
+	case "unified":
+		return unifiedDiff(base, target, baseName, targetName)
+
+	case "json":
+		return jsonDiff(base, target)
+
+	case "summary":
+		changes, unchanged := kvChanges(base, target)
+		counts := make(map[string]int)
+		for _, c := range changes {
+			counts[c.op]++
+		}
+		return fmt.Sprintf("added: %d\nchanged: %d\nremoved: %d\nunchanged: %d",
+			counts["added"], counts["changed"], counts["removed"], unchanged), nil
+	}
+
+	return "", fmt.Errorf("invalid diff format - %s", format)
+}
+
+// Name of inputs in diff header. Stdin is `-`.
+func diffInputsName(args []string) string {
+	if len(args) == 0 {
+		return "-"
+	}
+
+	return strings.Join(args, " ")
+}
+
+// Write changes as unified diff like lines, `-key = value` for old and `+key = value` for new pairs.
+// Values are raw JSON as stored in Consul and non zero flags are shown after the value.
+func unifiedDiff(base, target []consulKVPair, baseName, targetName string) (string, error) {
+	changes, _ := kvChanges(base, target)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "--- %s\n+++ %s", baseName, targetName)
+	for _, c := range changes {
+		for _, l := range []struct {
+			sign string
+			p    *consulKVPair
+		}{{"-", c.old}, {"+", c.new}} {
+			if l.p == nil {
+				continue
+			}
+
+			v, err := pairValue(*l.p)
+			if err != nil {
+				return "", err
+			}
+
+			fmt.Fprintf(buf, "\n%s%s = %s", l.sign, c.key, v)
+			if l.p.Flags != 0 {
+				fmt.Fprintf(buf, " (flags %d)", l.p.Flags)
+			}
+		}
+	}
+
+	return buf.String(), nil
+}
+
+// Change in `json` diff format. Values are decoded, ex: 5432 instead of its base64 encoding. Values
+// which aren't valid JSON (ex: Consul templates) are JSON strings.
+type jsonDiffChange struct {
+	Op       string      `json:"op"`
+	Key      string      `json:"key"`
+	Old      interface{} `json:"old,omitempty"`
+	New      interface{} `json:"new,omitempty"`
+	OldFlags *uint64     `json:"old_flags,omitempty"`
+	NewFlags *uint64     `json:"new_flags,omitempty"`
+}
+
+// Write changes as JSON array of changes with old and new values.
+func jsonDiff(base, target []consulKVPair) (string, error) {
+	changes, _ := kvChanges(base, target)
+
+	out := []jsonDiffChange{}
+	for _, c := range changes {
+		jc := jsonDiffChange{Op: c.op, Key: c.key}
+		if c.old != nil {
+			v, err := jsonDiffValue(*c.old)
+			if err != nil {
+				return "", err
+			}
+			jc.Old, jc.OldFlags = v, &c.old.Flags
+		}
+		if c.new != nil {
+			v, err := jsonDiffValue(*c.new)
+			if err != nil {
+				return "", err
+			}
+			jc.New, jc.NewFlags = v, &c.new.Flags
+		}
+
+		out = append(out, jc)
+	}
+
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// Get decoded value of pair for `json` diff format.
+func jsonDiffValue(p consulKVPair) (interface{}, error) {
+	v, err := pairValue(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if json.Valid([]byte(v)) {
+		return json.RawMessage(v), nil
+	}
+
+	return v, nil
+}
+
+// Overlay pairs on base pairs. Pairs replace base pairs of the same key in place and other pairs are
+// appended in order. Last value of repeated keys is used.
+func overlayKVPairs(base, pairs []consulKVPair) []consulKVPair {
+	out := dedupeKVPairs(base)
+	index := make(map[string]int, len(out))
+	for i, p := range out {
+		index[p.Key] = i
+	}
+
+	for _, p := range pairs {
+		if i, ok := index[p.Key]; ok {
+			out[i] = p
+			continue
+		}
+
+		index[p.Key] = len(out)
+		out = append(out, p)
+	}
+
+	return out
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBaseDiff(t *testing.T) {
+	base := writeTestFile(t, "config.v1.toml", `
+name = "billing"
+debug = true
+
+[db]
+host = "db1"
+port = 5432
+`)
+	target := writeTestFile(t, "config.v2.toml", `
+name = "billing"
+
+[db]
+host = "db2"
+port = 5432
+pool = 10
+`)
+
+	stdout, stderr, code := runCLI(t, "", "kv", "--prefix", "myconfig", "--base", base, target)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %s", code, stderr)
+	}
+	assertGolden(t, "diff-txn", stdout)
+
+	// No changes is an empty list of operations.
+	stdout, stderr, code = runCLI(t, "", "kv", "--base", base, base)
+	if code != 0 || stdout != "[]\n" {
+		t.Errorf("unchanged: code = %d, stdout = %q, stderr = %s", code, stdout, stderr)
+	}
+}
+
+func TestDiffKVPairs(t *testing.T) {
+	base := []consulKVPair{testPair("a", "1"), testPair("b", "2"), testPair("c", "3"), testPair("b", "4")}
+	flagged := testPair("c", "3")
+	flagged.Flags = 1
+	target := []consulKVPair{testPair("d", "5"), flagged, testPair("b", "4")}
+
+	var got []string
+	for _, op := range diffKVPairs(base, target) {
+		got = append(got, op.KV.Verb+" "+op.KV.Key)
+	}
+
+	// Flags change is a change, repeated keys use the last value.
+	if want := []string{"set d", "set c", "delete a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ops = %v, want %v", got, want)
+	}
+}
+
+func TestMergeInto(t *testing.T) {
+	// Export of earlier run, with a repeated key as concatenated exports have.
+	existing := writeTestFile(t, "export.json", `[
+  {"key": "myconfig/db/host", "flags": 0, "value": "ImRiMSI="},
+  {"key": "myconfig/name", "flags": 0, "value": "ImJpbGxpbmci"},
+  {"key": "other/debug", "flags": 0, "value": "dHJ1ZQ=="},
+  {"key": "myconfig/name", "flags": 0, "value": "Im9sZCI="}
+]`)
+	config := writeTestFile(t, "config.toml", `
+[db]
+host = "db2"
+port = 5432
+`)
+
+	stdout, stderr, code := runCLI(t, "", "kv", "--prefix", "myconfig", "--merge-into", existing, config)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %s", code, stderr)
+	}
+
+	var pairs []consulKVPair
+	if err := json.Unmarshal([]byte(stdout), &pairs); err != nil {
+		t.Fatal(err)
+	}
+
+	// Converted keys win in place, new keys are appended and other existing keys are kept with the
+	// last of repeated keys.
+	want := `myconfig/db/host="db2"
+other/debug=true
+myconfig/name="old"
+myconfig/db/port=5432`
+	if got := pairLines(t, pairs); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// File which isn't KV JSON fails.
+	_, stderr, code = runCLI(t, "", "kv", "--merge-into", config, config)
+	if code == 0 || !strings.Contains(stderr, "error reading merge into file - invalid KV JSON in "+config) {
+		t.Errorf("code = %d, stderr = %s", code, stderr)
+	}
+}
+
+func TestDiffFormats(t *testing.T) {
+	base := writeTestFile(t, "config.v1.toml", `
+name = "billing"
+debug = true
+
+[db]
+host = "db1"
+port = 5432
+`)
+	target := writeTestFile(t, "config.v2.toml", `
+name = "billing"
+
+[db]
+host = "db2"
+port = 5432
+pool = 10
+`)
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"unified", "--- " + base + "\n+++ " + target + `
+-myconfig/db/host = "db1"
++myconfig/db/host = "db2"
++myconfig/db/pool = 10
+-myconfig/debug = true
+`},
+		{"summary", "added: 1\nchanged: 1\nremoved: 1\nunchanged: 2\n"},
+	}
+
+	for _, tt := range tests {
+		stdout, stderr, code := runCLI(t, "", "kv", "--prefix", "myconfig", "--base", base, "--diff-format", tt.format, target)
+		if code != 0 {
+			t.Fatalf("%s: exit code %d, stderr %s", tt.format, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.format, stdout, tt.want)
+		}
+	}
+
+	stdout, stderr, code := runCLI(t, "", "kv", "--prefix", "myconfig", "--base", base, "--diff-format", "json", target)
+	if code != 0 {
+		t.Fatalf("json: exit code %d, stderr %s", code, stderr)
+	}
+	assertGolden(t, "diff-json", stdout)
+
+	// Diff format is only valid with a base.
+	_, stderr, code = runCLI(t, "", "kv", "--diff-format", "summary", target)
+	if code == 0 || !strings.Contains(stderr, "--diff-format requires --base") {
+		t.Errorf("without base: code = %d, stderr = %s", code, stderr)
+	}
+}
+
+func TestDiffFormatsValues(t *testing.T) {
+	// Values which aren't JSON, ex: Consul templates, and flags changes.
+	template := testPair("tmpl", `{{ key "db/host" }}`)
+	flagged := testPair("port", "5432")
+	flagged.Flags = 2
+	base := []consulKVPair{testPair("port", "5432"), template}
+	target := []consulKVPair{flagged}
+
+	got, err := kvDiffToString("unified", base, target, "old", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `--- old
++++ new
+-port = 5432
++port = 5432 (flags 2)
+-tmpl = {{ key "db/host" }}`
+	if got != want {
+		t.Errorf("unified: got\n%s\nwant\n%s", got, want)
+	}
+
+	got, err = kvDiffToString("json", base, target, "old", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []map[string]interface{}
+	if err := json.Unmarshal([]byte(got), &changes); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0]["old_flags"] != 0.0 || changes[0]["new_flags"] != 2.0 || changes[1]["old"] != `{{ key "db/host" }}` {
+		t.Errorf("json:\n%s", got)
+	}
+	if _, ok := changes[1]["new"]; ok {
+		t.Errorf("json: removed key has new value:\n%s", got)
+	}
+}
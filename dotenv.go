@@ -0,0 +1,57 @@
+// Example custom parser for dotenv files.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/vividvilla/consul-cfg/parser"
+)
+
+func init() {
+	parser.Register("dotenv", dotenvParser{}, ".env")
+}
+
+// Parser for dotenv files with `KEY=value` lines. Empty lines and lines starting with # are ignored,
+// optional `export ` prefix is removed. Double quoted values support \n, \t, \" and \\ escapes,
+// single quoted values are literal. All values are strings.
+type dotenvParser struct{}
+
+// Parse dotenv file to a flat map.
+func (dotenvParser) Parse(r io.Reader) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("line %d: should be of form KEY=value", n)
+		}
+
+		key := strings.TrimSpace(line[:i])
+		val := strings.TrimSpace(line[i+1:])
+		switch {
+		case len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"':
+			val = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(val[1 : len(val)-1])
+		case len(val) >= 2 && val[0] == '\'' && val[len(val)-1] == '\'':
+			val = val[1 : len(val)-1]
+		default:
+			// Remove inline comment from unquoted value.
+			if j := strings.Index(val, " #"); j != -1 {
+				val = strings.TrimSpace(val[:j])
+			}
+		}
+
+		m[key] = val
+	}
+
+	return m, scanner.Err()
+}
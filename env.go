@@ -0,0 +1,81 @@
+// Select values for target environment from multi environment configs.
+
+package main
+
+import (
+	"strings"
+)
+
+// Separator of key name and environment in environment overrides. Ex: host@production
+const envOverrideSeparator = "@"
+
+// Select values of environment in config map. Top level sections named after environments are
+// merged over the rest of the config for the selected environment and removed for other
+// environments. Then keys of form `<key>@<env>` replace `<key>` for the selected environment
+// and are removed for other environments.
+func selectEnv(m map[string]interface{}, env string, sections []string) {
+	env = strings.ToLower(env)
+
+	var selected map[string]interface{}
+	for _, s := range sections {
+		s = strings.ToLower(s)
+		v, ok := m[s]
+		if !ok {
+			continue
+		}
+		delete(m, s)
+
+		if sm, ok := v.(map[string]interface{}); ok && s == env {
+			selected = sm
+		}
+	}
+
+	if selected != nil {
+		mergeMaps(m, selected)
+	}
+
+	// Only environments which are known are overrides, so that keys like admin@example.com are kept.
+	envs := map[string]bool{env: true}
+	for _, s := range sections {
+		envs[strings.ToLower(s)] = true
+	}
+	applyEnvOverrides(m, env, envs)
+}
+
+// Recursively merge src map into dst. Values of src take precedence, nested maps are merged.
+func mergeMaps(dst, src map[string]interface{}) {
+	for k, v := range src {
+		sm, ok := v.(map[string]interface{})
+		dm, dok := dst[k].(map[string]interface{})
+		if ok && dok {
+			mergeMaps(dm, sm)
+			continue
+		}
+
+		dst[k] = v
+	}
+}
+
+// Recursively apply `<key>@<env>` overrides in map and remove overrides of other environments. Keys are
+// overrides only if env is one of the known environments, other keys with `@` are kept as is.
+func applyEnvOverrides(m map[string]interface{}, env string, envs map[string]bool) {
+	for k, v := range m {
+		i := strings.LastIndex(k, envOverrideSeparator)
+		if i <= 0 || !envs[strings.ToLower(k[i+1:])] {
+			if child, ok := v.(map[string]interface{}); ok {
+				applyEnvOverrides(child, env, envs)
+			}
+			continue
+		}
+
+		delete(m, k)
+		if strings.ToLower(k[i+1:]) != env {
+			continue
+		}
+
+		if child, ok := v.(map[string]interface{}); ok {
+			applyEnvOverrides(child, env, envs)
+		}
+		m[k[:i]] = v
+	}
+}
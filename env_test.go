@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectEnv(t *testing.T) {
+	m := map[string]interface{}{
+		"db": map[string]interface{}{
+			"host":            "localhost",
+			"host@production": "db.prod",
+			"host@staging":    "db.staging",
+			"pool@Production": 50,
+		},
+		"production": map[string]interface{}{"debug": false},
+		"staging":    map[string]interface{}{"debug": true},
+		"debug":      true,
+		"admins": map[string]interface{}{
+			"admin@example.com": "ops",
+			"user@host":         "dev",
+		},
+		"notify@qa":   "x",
+		"@handle":     "y",
+		"name@":       "z",
+		"mail@prod.x": "w",
+	}
+
+	selectEnv(m, "production", []string{"development", "staging", "production"})
+
+	want := map[string]interface{}{
+		"db": map[string]interface{}{
+			"host": "db.prod",
+			"pool": 50,
+		},
+		"debug": false,
+		"admins": map[string]interface{}{
+			"admin@example.com": "ops",
+			"user@host":         "dev",
+		},
+		"notify@qa":   "x",
+		"@handle":     "y",
+		"name@":       "z",
+		"mail@prod.x": "w",
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %v\nwant %v", m, want)
+	}
+}
+
+func TestSelectEnvNotInSections(t *testing.T) {
+	// Selected env is an override even if it has no section.
+	m := map[string]interface{}{"host": "localhost", "host@qa": "db.qa", "host@production": "db.prod"}
+	selectEnv(m, "qa", []string{"production"})
+
+	if want := map[string]interface{}{"host": "db.qa"}; !reflect.DeepEqual(m, want) {
+		t.Errorf("got %v, want %v", m, want)
+	}
+}
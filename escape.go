@@ -0,0 +1,73 @@
+// Escape delimiter in key segments.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Available delimiter escape modes.
+var kvDelimiterEscapes = []string{"percent", "backslash"}
+
+// Escape delimiter in a key segment so that it isn't read as a path separator. In percent mode `%` and
+// delimiter are percent encoded, ex: a/b => a%2Fb. In backslash mode `\` and delimiter are escaped
+// with a backslash, ex: a/b => a\/b. Segment is returned as is if escaping is disabled.
+func escapeKeySegment(seg string, delimiter string) string {
+	switch kvDelimiterEscape {
+	case "percent":
+		var enc strings.Builder
+		for i := 0; i < len(delimiter); i++ {
+			fmt.Fprintf(&enc, "%%%02X", delimiter[i])
+		}
+
+		seg = strings.Replace(seg, "%", "%25", -1)
+		return strings.Replace(seg, delimiter, enc.String(), -1)
+
+	case "backslash":
+		seg = strings.Replace(seg, `\`, `\\`, -1)
+		return strings.Replace(seg, delimiter, `\`+delimiter, -1)
+	}
+
+	return seg
+}
+
+// Split key into its segments and unescape them. Reverses escapeKeySegment.
+func splitKey(key string, delimiter string) []string {
+	switch kvDelimiterEscape {
+	case "percent":
+		segments := strings.Split(key, delimiter)
+		for i, seg := range segments {
+			if s, err := url.PathUnescape(seg); err == nil {
+				segments[i] = s
+			}
+		}
+		return segments
+
+	case "backslash":
+		var (
+			segments []string
+			cur      strings.Builder
+		)
+		for i := 0; i < len(key); i++ {
+			switch {
+			case key[i] == '\\' && strings.HasPrefix(key[i+1:], delimiter):
+				cur.WriteString(delimiter)
+				i += len(delimiter)
+			case key[i] == '\\' && i+1 < len(key) && key[i+1] == '\\':
+				cur.WriteByte('\\')
+				i++
+			case strings.HasPrefix(key[i:], delimiter):
+				segments = append(segments, cur.String())
+				cur.Reset()
+				i += len(delimiter) - 1
+			default:
+				cur.WriteByte(key[i])
+			}
+		}
+		return append(segments, cur.String())
+	}
+
+	return strings.Split(key, delimiter)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDelimiterEscape(t *testing.T) {
+	config := writeTestFile(t, "config.json", `{"routes": {"/api": "svc", "50%\\off": "sale"}, "a/b": 1, "a": {"b": 2}}`)
+
+	tests := []struct {
+		escape string
+		keys   []string
+	}{
+		// Key names with the delimiter collide with nested keys.
+		{"", []string{"a/b", "a/b", "routes//api", `routes/50%\off`}},
+		{"percent", []string{"a/b", "a%2Fb", "routes/%2Fapi", `routes/50%25\off`}},
+		{"backslash", []string{"a/b", `a\/b`, `routes/\/api`, `routes/50%\\off`}},
+	}
+
+	for _, tt := range tests {
+		pairs := testKVPairs(t, "--delimiter-escape", tt.escape, config)
+		var keys []string
+		for _, p := range pairs {
+			keys = append(keys, p.Key)
+		}
+		if !reflect.DeepEqual(keys, tt.keys) {
+			t.Errorf("%q: keys = %q, want %q", tt.escape, keys, tt.keys)
+		}
+	}
+}
+
+func TestInvalidDelimiterEscape(t *testing.T) {
+	config := writeTestFile(t, "config.json", `{"a": 1}`)
+	_, stderr, code := runCLI(t, "", "kv", "--delimiter-escape", "url", config)
+	if code == 0 || !strings.Contains(stderr, "Invalid delimiter escape - url") {
+		t.Errorf("code = %d, stderr = %q, want invalid delimiter escape error", code, stderr)
+	}
+}
+
+func TestSplitKeyReversesEscape(t *testing.T) {
+	segments := [][]string{
+		{"routes", "/api"},
+		{"a/b", "c"},
+		{`back\slash`, `ends\`, "50%2F"},
+		{"", "x//y"},
+	}
+
+	for _, delimiter := range []string{"/", "::"} {
+		for _, escape := range kvDelimiterEscapes {
+			testCmd(t, "kv", "--delimiter-escape", escape)
+			for _, segs := range segments {
+				var escaped []string
+				for _, s := range segs {
+					escaped = append(escaped, escapeKeySegment(s, delimiter))
+				}
+
+				key := strings.Join(escaped, delimiter)
+				if got := splitKey(key, delimiter); !reflect.DeepEqual(got, segs) {
+					t.Errorf("%s %q: splitKey(%q) = %q, want %q", escape, delimiter, key, got, segs)
+				}
+			}
+		}
+	}
+}
+
+func TestDelimiterEscapeHelmValues(t *testing.T) {
+	config := writeTestFile(t, "config.json", `{"routes": {"/api": "svc", "/web": {"port": 80}}}`)
+	pairs := testKVPairs(t, "--delimiter-escape", "percent", config)
+
+	got, err := kvPairsToString("helm-values", pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "helm-values-delimiter-escape", got)
+}
@@ -0,0 +1,129 @@
+// Filters applied on generated keys.
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Skip key pattern didn't match any key.
+	warnUnmatchedSkipKey = "unmatched-skip-key"
+)
+
+// Key glob pattern and whether it matched any key.
+type keyPattern struct {
+	pattern string
+	re      *regexp.Regexp
+	matched bool
+}
+
+// Patterns of keys which are skipped.
+var skipKeyPatterns []*keyPattern
+
+// Compiled `--ignore-keys-regex`.
+var ignoreKeysRe *regexp.Regexp
+
+// Compile key glob pattern to regex. `*` matches any characters except delimiter,
+// `**` matches any characters including delimiter and `?` matches a single character except delimiter.
+func compileKeyGlob(pattern string, delimiter string) (*regexp.Regexp, error) {
+	d := regexp.QuoteMeta(delimiter)
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^" + d + "]*")
+		case c == '?':
+			b.WriteString("[^" + d + "]")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+// Load newline separated list of keys or key globs to skip. Empty lines and lines starting with # are ignored.
+func loadSkipKeysFile(fPath string, delimiter string) error {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		re, err := compileKeyGlob(line, delimiter)
+		if err != nil {
+			return err
+		}
+
+		skipKeyPatterns = append(skipKeyPatterns, &keyPattern{pattern: line, re: re})
+	}
+
+	return scanner.Err()
+}
+
+// Check if key should be skipped.
+func skipKey(key string) bool {
+	if ignoreKeysRe != nil && ignoreKeysRe.MatchString(key) {
+		return true
+	}
+
+	skip := false
+	for _, p := range skipKeyPatterns {
+		if p.re.MatchString(key) {
+			p.matched = true
+			skip = true
+		}
+	}
+
+	return skip
+}
+
+// Add warnings for skip patterns which didn't match any key.
+func warnUnmatchedSkipKeys() {
+	for _, p := range skipKeyPatterns {
+		if !p.matched {
+			addWarning(warnUnmatchedSkipKey, "skip key pattern %s didn't match any key", p.pattern)
+		}
+	}
+}
+
+// Get KV pairs whose keys match any of the globs.
+func filterKVPairsByGlobs(pairs []consulKVPair, globs []string) ([]consulKVPair, error) {
+	var res []*regexp.Regexp
+	for _, g := range globs {
+		re, err := compileKeyGlob(g, kvDelimiter)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, re)
+	}
+
+	var out []consulKVPair
+	for _, p := range pairs {
+		for _, re := range res {
+			if re.MatchString(p.Key) {
+				out = append(out, p)
+				break
+			}
+		}
+	}
+
+	return out, nil
+}
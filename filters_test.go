@@ -0,0 +1,86 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSkipKeysFile(t *testing.T) {
+	skip := writeTestFile(t, "skip.txt", `# Managed in Vault.
+billing/db/pool/*
+
+billing/name
+  billing/cache/enabled  
+billing/missing/**
+`)
+
+	pairs := testKVPairs(t, "--prefix", "billing", "--skip-keys-file", skip, filepath.Join("testdata", "config.toml"))
+	want := "billing/db/host=\"db.internal\"\nbilling/db/port=5432\nbilling/debug=false\nbilling/ratio=0.75\nbilling/tags=[\"api\",\"internal\"]"
+	if got := pairLines(t, pairs); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Patterns which matched no key are reported.
+	var unmatched []string
+	for _, w := range warnings {
+		if w.category == warnUnmatchedSkipKey {
+			unmatched = append(unmatched, w.message)
+		}
+	}
+	if want := []string{"skip key pattern billing/missing/** didn't match any key"}; !reflect.DeepEqual(unmatched, want) {
+		t.Errorf("unmatched warnings = %v, want %v", unmatched, want)
+	}
+}
+
+func TestSkipKeysFileMatchesAfterPrefix(t *testing.T) {
+	// Keys without prefix don't match since patterns are matched against full keys.
+	skip := writeTestFile(t, "skip.txt", "name\n")
+
+	pairs := testKVPairs(t, "--prefix", "billing", "--skip-keys-file", skip, filepath.Join("testdata", "config.toml"))
+	if len(pairs) != 9 {
+		t.Errorf("got %d pairs, want all 9 pairs", len(pairs))
+	}
+	if len(warnings) != 1 || warnings[0].category != warnUnmatchedSkipKey {
+		t.Errorf("warnings = %v, want unmatched skip key", warnings)
+	}
+}
+
+func TestIgnoreKeysRegex(t *testing.T) {
+	config := filepath.Join("testdata", "config.toml")
+	skip := writeTestFile(t, "skip.txt", "billing/name\n")
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		// Unanchored regex matches anywhere, so both the db subtree and its pool subtree go.
+		{"subtree", []string{"--ignore-keys-regex", "db/"}, []string{"cache/enabled", "debug", "name", "ratio", "tags"}},
+		{"anchored subtree", []string{"--ignore-keys-regex", "^billing/db/pool/"},
+			[]string{"cache/enabled", "db/host", "db/port", "debug", "name", "ratio", "tags"}},
+		// Keys are matched with prefix, so a regex anchored at a key without it matches nothing.
+		{"anchored without prefix", []string{"--ignore-keys-regex", "^db/"},
+			[]string{"cache/enabled", "db/host", "db/pool/max_conns", "db/pool/timeout", "db/port", "debug", "name", "ratio", "tags"}},
+		{"with skip keys file", []string{"--ignore-keys-regex", "(ratio|tags)$", "--skip-keys-file", skip},
+			[]string{"cache/enabled", "db/host", "db/pool/max_conns", "db/pool/timeout", "db/port", "debug"}},
+	}
+
+	for _, tt := range tests {
+		pairs := testKVPairs(t, append(append([]string{"--prefix", "billing"}, tt.args...), config)...)
+
+		var got []string
+		for _, p := range pairs {
+			got = append(got, strings.TrimPrefix(p.Key, "billing/"))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: keys = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	_, stderr, code := runCLI(t, "", "kv", "--ignore-keys-regex", "db/(", config)
+	if code == 0 || !strings.Contains(stderr, "invalid ignore keys regex") {
+		t.Errorf("invalid regex: code = %d, stderr = %s", code, stderr)
+	}
+}
@@ -0,0 +1,127 @@
+// Firestore documents output of KV pairs.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Firestore document in REST API encoding. Name is relative to the documents root of the database.
+type firestoreDocument struct {
+	Name   string                 `json:"name"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// Reconstruct config from KV pairs as Firestore documents. First key segment is the collection,
+// second the document and rest are fields of the document, with nested keys as map fields.
+// Ex: config/app/db/host => field db.host of document app in collection config.
+func firestoreDocuments(pairs []consulKVPair) (string, error) {
+	m, err := pairsToMap(pairs, kvDelimiter, true)
+	if err != nil {
+		return "", err
+	}
+
+	docs := []firestoreDocument{}
+	for _, coll := range sortedMapKeys(m) {
+		cm, ok := m[coll].(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("key %s has no document, keys should be of form <collection>/<document>/<field>", coll)
+		}
+
+		for _, id := range sortedMapKeys(cm) {
+			name := coll + "/" + id
+			dm, ok := cm[id].(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("key %s has no field, keys should be of form <collection>/<document>/<field>", coll+kvDelimiter+id)
+			}
+			if strings.Contains(coll, "/") || strings.Contains(id, "/") {
+				return "", fmt.Errorf("collection and document IDs can't contain / - %s", name)
+			}
+
+			fields, err := firestoreFields(dm)
+			if err != nil {
+				return "", fmt.Errorf("document %s - %v", name, err)
+			}
+
+			docs = append(docs, firestoreDocument{Name: name, Fields: fields})
+		}
+	}
+
+	b, err := json.MarshalIndent(docs, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func firestoreFields(m map[string]interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		fv, err := firestoreValue(v, false)
+		if err != nil {
+			return nil, fmt.Errorf("field %s - %v", k, err)
+		}
+		fields[k] = fv
+	}
+
+	return fields, nil
+}
+
+// Convert decoded JSON value to typed Firestore value. Integers are strings as in the REST API.
+// Firestore doesn't allow arrays directly inside arrays.
+func firestoreValue(v interface{}, inArray bool) (map[string]interface{}, error) {
+	switch t := v.(type) {
+	case nil:
+		return map[string]interface{}{"nullValue": nil}, nil
+
+	case string:
+		return map[string]interface{}{"stringValue": t}, nil
+
+	case bool:
+		return map[string]interface{}{"booleanValue": t}, nil
+
+	case json.Number:
+		if strings.ContainsAny(string(t), ".eE") {
+			return map[string]interface{}{"doubleValue": t}, nil
+		}
+		return map[string]interface{}{"integerValue": string(t)}, nil
+
+	case []interface{}:
+		if inArray {
+			return nil, fmt.Errorf("nested arrays are not supported")
+		}
+
+		values := make([]interface{}, 0, len(t))
+		for _, item := range t {
+			fv, err := firestoreValue(item, true)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, fv)
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}, nil
+
+	case map[string]interface{}:
+		fields, err := firestoreFields(t)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"mapValue": map[string]interface{}{"fields": fields}}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value %v", v)
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
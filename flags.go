@@ -0,0 +1,207 @@
+// Compute Consul flags value for KV pairs.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Inputs available to flags encoder template.
+type flagsEncoderInput struct {
+	// Full key of the pair including prefix.
+	Key string
+	// Key split by delimiter.
+	Segments []string
+	// Number of segments in the key.
+	Depth int
+	// JSON encoded value of the pair.
+	Value string
+	// Static flags value set by `--flags` or the reserved settings table, or by matching `--flags-from-key-pattern`.
+	Flags uint64
+}
+
+// Flags value set on keys matching the glob.
+type flagsPattern struct {
+	keyRe *regexp.Regexp
+	flags uint64
+}
+
+// Patterns compiled from `--flags-from-key-pattern`.
+var flagsPatterns []flagsPattern
+
+// Compiled flags encoder template. Nil if encoder is not set.
+var flagsEncoderTmpl *template.Template
+
+// Helper functions available to flags encoder template.
+var flagsEncoderFuncs = template.FuncMap{
+	// Check if key matches the glob pattern.
+	"match": func(pattern, s string) (bool, error) {
+		return path.Match(pattern, s)
+	},
+	// Check if string matches the regex.
+	"regex": func(pattern, s string) (bool, error) {
+		return regexp.MatchString(pattern, s)
+	},
+	// Return the first capture group of regex match or empty string.
+	"capture": func(pattern, s string) (string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+
+		m := re.FindStringSubmatch(s)
+		if len(m) < 2 {
+			return "", nil
+		}
+
+		return m[1], nil
+	},
+	"atoi": func(v interface{}) (uint64, error) {
+		return toUint64(v)
+	},
+	"shl": func(a, b interface{}) (uint64, error) {
+		return uintOp(a, b, func(x, y uint64) uint64 { return x << y })
+	},
+	"shr": func(a, b interface{}) (uint64, error) {
+		return uintOp(a, b, func(x, y uint64) uint64 { return x >> y })
+	},
+	"bor": func(a, b interface{}) (uint64, error) {
+		return uintOp(a, b, func(x, y uint64) uint64 { return x | y })
+	},
+	"band": func(a, b interface{}) (uint64, error) {
+		return uintOp(a, b, func(x, y uint64) uint64 { return x & y })
+	},
+	"add": func(a, b interface{}) (uint64, error) {
+		return uintOp(a, b, func(x, y uint64) uint64 { return x + y })
+	},
+}
+
+// Compile flags encoder template.
+func compileFlagsEncoder(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+
+	t, err := template.New("flags").Funcs(flagsEncoderFuncs).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return err
+	}
+
+	flagsEncoderTmpl = t
+	return nil
+}
+
+// Compile flags patterns of form `<key glob>=<flags>`.
+func compileFlagsPatterns(patterns []string, delimiter string) error {
+	for _, p := range patterns {
+		i := strings.LastIndex(p, "=")
+		if i <= 0 {
+			return fmt.Errorf("%s should be of form <key glob>=<flags>", p)
+		}
+
+		f, err := strconv.ParseUint(p[i+1:], 10, 64)
+		if err != nil {
+			return fmt.Errorf("flags of %s should be an unsigned integer", p)
+		}
+
+		re, err := compileKeyGlob(p[:i], delimiter)
+		if err != nil {
+			return err
+		}
+
+		flagsPatterns = append(flagsPatterns, flagsPattern{keyRe: re, flags: f})
+	}
+
+	return nil
+}
+
+// Get flags value for given key and JSON encoded value. Last matching flags pattern overrides
+// the static flags and flags encoder if set overrides both.
+func keyFlags(key string, value string, s kvSettings) (uint64, error) {
+	flags := s.flags
+	for _, p := range flagsPatterns {
+		if p.keyRe.MatchString(key) {
+			flags = p.flags
+		}
+	}
+
+	if flagsEncoderTmpl == nil {
+		return flags, nil
+	}
+
+	segments := splitKey(key, s.delimiter)
+	buf := bytes.NewBufferString("")
+	if err := flagsEncoderTmpl.Execute(buf, flagsEncoderInput{
+		Key:      key,
+		Segments: segments,
+		Depth:    len(segments),
+		Value:    value,
+		Flags:    flags,
+	}); err != nil {
+		return 0, err
+	}
+
+	out := strings.TrimSpace(buf.String())
+	if out == "" {
+		return flags, nil
+	}
+
+	f, err := strconv.ParseUint(out, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("flags encoder output for key %s is not a valid unsigned integer: %q", key, out)
+	}
+
+	return f, nil
+}
+
+// Convert template value to uint64. Negative and fractional numbers are invalid.
+func toUint64(v interface{}) (uint64, error) {
+	switch n := v.(type) {
+	case uint64:
+		return n, nil
+	case int:
+		return toUint64(int64(n))
+	case int64:
+		if n < 0 {
+			return 0, fmt.Errorf("negative number: %d", n)
+		}
+		return uint64(n), nil
+	case float64:
+		if n < 0 || n != math.Trunc(n) || n >= math.MaxUint64 {
+			return 0, fmt.Errorf("not an unsigned integer: %v", n)
+		}
+		return uint64(n), nil
+	case json.Number:
+		return strconv.ParseUint(string(n), 10, 64)
+	case string:
+		if n == "" {
+			return 0, nil
+		}
+		return strconv.ParseUint(n, 10, 64)
+	default:
+		return 0, fmt.Errorf("invalid number: %v", v)
+	}
+}
+
+// Apply binary operation on two template values.
+func uintOp(a, b interface{}, op func(x, y uint64) uint64) (uint64, error) {
+	x, err := toUint64(a)
+	if err != nil {
+		return 0, err
+	}
+
+	y, err := toUint64(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return op(x, y), nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToUint64(t *testing.T) {
+	tests := []struct {
+		in  interface{}
+		out uint64
+		err bool
+	}{
+		{uint64(7), 7, false},
+		{3, 3, false},
+		{int64(42), 42, false},
+		{float64(8), 8, false},
+		{json.Number("16"), 16, false},
+		{"32", 32, false},
+		{"", 0, false},
+		{-1, 0, true},
+		{int64(-5), 0, true},
+		{float64(-1), 0, true},
+		{1.5, 0, true},
+		{"-1", 0, true},
+		{json.Number("1.5"), 0, true},
+		{true, 0, true},
+	}
+
+	for _, tt := range tests {
+		out, err := toUint64(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("toUint64(%#v) error = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+		if out != tt.out {
+			t.Errorf("toUint64(%#v) = %d, want %d", tt.in, out, tt.out)
+		}
+	}
+}
+
+// Convert testdata config with args and get flags of every key.
+func testKeyFlags(t *testing.T, args ...string) map[string]uint64 {
+	t.Helper()
+
+	flags := make(map[string]uint64)
+	for _, p := range testKVPairs(t, append(args, filepath.Join("testdata", "config.toml"))...) {
+		flags[p.Key] = p.Flags
+	}
+
+	return flags
+}
+
+func TestFlagsFromKeyPattern(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want map[string]uint64
+	}{
+		{"no patterns", []string{"--flags", "3"},
+			map[string]uint64{"name": 3, "db/host": 3, "db/pool/timeout": 3}},
+		{"single segment glob", []string{"--flags-from-key-pattern", "db/*=7"},
+			map[string]uint64{"name": 0, "db/host": 7, "db/port": 7, "db/pool/timeout": 0}},
+		{"recursive glob", []string{"--flags-from-key-pattern", "db/**=7"},
+			map[string]uint64{"db/host": 7, "db/pool/timeout": 7, "cache/enabled": 0}},
+		{"single character glob", []string{"--flags-from-key-pattern", "db/?ort=9"},
+			map[string]uint64{"db/port": 9, "db/host": 0}},
+		{"last match wins", []string{"--flags-from-key-pattern", "db/**=7,db/pool/*=8"},
+			map[string]uint64{"db/host": 7, "db/pool/max_conns": 8}},
+		{"broad pattern last overrides specific", []string{"--flags-from-key-pattern", "db/pool/*=8", "--flags-from-key-pattern", "db/**=7"},
+			map[string]uint64{"db/host": 7, "db/pool/max_conns": 7}},
+		{"pattern overrides static flags", []string{"--flags", "3", "--flags-from-key-pattern", "cache/**=5"},
+			map[string]uint64{"cache/enabled": 5, "name": 3}},
+		{"matched against full key", []string{"--prefix", "app", "--flags-from-key-pattern", "db/**=7,app/db/**=6"},
+			map[string]uint64{"app/db/host": 6, "app/name": 0}},
+		{"glob metacharacters are literal", []string{"--flags-from-key-pattern", "d.*=4"},
+			map[string]uint64{"debug": 0, "db/host": 0}},
+		{"encoder overrides patterns", []string{"--flags-from-key-pattern", "db/**=7", "--flags-encoder", `{{ if match "db/pool/*" .Key }}{{ add .Flags 1 }}{{ end }}`},
+			map[string]uint64{"db/host": 7, "db/pool/timeout": 8, "name": 0}},
+		{"encoder with segments and depth", []string{"--flags-encoder", `{{ shl .Depth (atoi (index .Segments 0 | len)) }}`},
+			map[string]uint64{"name": 1 << 4, "db/pool/timeout": 3 << 2}},
+	}
+
+	for _, tt := range tests {
+		got := testKeyFlags(t, tt.args...)
+		for k, want := range tt.want {
+			if f, ok := got[k]; !ok || f != want {
+				t.Errorf("%s: flags of %s = %d (exists %v), want %d", tt.name, k, f, ok, want)
+			}
+		}
+	}
+}
+
+func TestCompileFlagsPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		err     string
+	}{
+		{"db/**=7", ""},
+		{"a=b=7", ""},
+		{"db/**", "should be of form <key glob>=<flags>"},
+		{"=7", "should be of form <key glob>=<flags>"},
+		{"db/**=", "should be an unsigned integer"},
+		{"db/**=-1", "should be an unsigned integer"},
+		{"db/**=1.5", "should be an unsigned integer"},
+		{"db/**=18446744073709551616", "should be an unsigned integer"},
+	}
+
+	for _, tt := range tests {
+		flagsPatterns = nil
+		err := compileFlagsPatterns([]string{tt.pattern}, "/")
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.pattern, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: error = %v, want %q", tt.pattern, err, tt.err)
+		}
+	}
+	flagsPatterns = nil
+
+	// Key glob of pattern keeps everything before last `=`.
+	if err := compileFlagsPatterns([]string{"a=b=7"}, "/"); err != nil || !flagsPatterns[0].keyRe.MatchString("a=b") {
+		t.Errorf("pattern a=b=7 should match key a=b, error %v", err)
+	}
+	flagsPatterns = nil
+}
+
+func TestKeyFlagsEncoderErrors(t *testing.T) {
+	t.Cleanup(func() { flagsEncoderTmpl = nil })
+
+	tests := []struct {
+		tmpl string
+		err  string
+	}{
+		{"{{ .Missing }}", "can't evaluate field Missing"},
+		{"not a number", "is not a valid unsigned integer"},
+		{"{{ atoi .Value }}", "invalid syntax"},
+		{"-1", "is not a valid unsigned integer"},
+	}
+
+	for _, tt := range tests {
+		if err := compileFlagsEncoder(tt.tmpl); err != nil {
+			t.Fatalf("%s: %v", tt.tmpl, err)
+		}
+
+		_, err := keyFlags("db/host", `"db.internal"`, kvSettings{delimiter: "/"})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error = %v, want %q", tt.tmpl, err, tt.err)
+		}
+	}
+
+	if err := compileFlagsEncoder("{{ if }}"); err == nil {
+		t.Errorf("expected error compiling invalid template")
+	}
+}
+
+func TestFlagsFromKeyPatternSubtrees(t *testing.T) {
+	config := writeTestFile(t, "config.toml", `
+port = 8080
+
+[secrets]
+token = "t"
+
+[secrets.public]
+key = "k"
+
+[_consul_cfg]
+flags = 2
+`)
+
+	// Keys which don't match any pattern get flags of the settings table.
+	pairs := testKVPairs(t, "--flags-from-key-pattern", "secrets/**=42", "--flags-from-key-pattern", "secrets/public/**=1", config)
+	got := make(map[string]uint64)
+	for _, p := range pairs {
+		got[p.Key] = p.Flags
+	}
+	if want := map[string]uint64{"port": 2, "secrets/token": 42, "secrets/public/key": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("flags = %v, want %v", got, want)
+	}
+
+	_, stderr, code := runCLI(t, "", "kv", "--flags-from-key-pattern", "secrets/**", config)
+	if code == 0 || !strings.Contains(stderr, "should be of form <key glob>=<flags>") {
+		t.Errorf("invalid pattern: code = %d, stderr = %q", code, stderr)
+	}
+}
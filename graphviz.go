@@ -0,0 +1,97 @@
+// Graphviz DOT output of the key hierarchy.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Max number of characters of values shown in leaf labels. Longer values are truncated with `...`.
+const graphvizMaxValueLength = 32
+
+// Node of key hierarchy. Children are in the order their keys are first seen.
+type graphvizNode struct {
+	id       string
+	segment  string
+	value    *string
+	children []*graphvizNode
+	index    map[string]*graphvizNode
+}
+
+// Write key hierarchy as Graphviz DOT graph. Every key segment is a node with an edge from its parent
+// segment and leaves are labeled with the segment and the value.
+func graphvizDOT(pairs []consulKVPair) (string, error) {
+	n := 0
+	newNode := func(seg string) *graphvizNode {
+		node := &graphvizNode{id: fmt.Sprintf("n%d", n), segment: seg, index: make(map[string]*graphvizNode)}
+		n++
+		return node
+	}
+
+	root := newNode("/")
+	for _, p := range pairs {
+		v, err := pairPlainValue(p)
+		if err != nil {
+			return "", err
+		}
+
+		node := root
+		for _, seg := range splitKey(trimDelimiter(p.Key, kvDelimiter), kvDelimiter) {
+			child, ok := node.index[seg]
+			if !ok {
+				child = newNode(seg)
+				node.index[seg] = child
+				node.children = append(node.children, child)
+			}
+			node = child
+		}
+		node.value = &v
+	}
+
+	buf := bytes.NewBufferString("digraph config {\n")
+	buf.WriteString("  rankdir=LR;\n")
+	buf.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	writeGraphvizNode(buf, root)
+	buf.WriteString("}")
+
+	return buf.String(), nil
+}
+
+// Write node, its edges and its children recursively. Leaves are drawn as rounded boxes.
+func writeGraphvizNode(buf *bytes.Buffer, node *graphvizNode) {
+	if node.value != nil {
+		label := node.segment + " = " + truncateValue(*node.value, graphvizMaxValueLength)
+		fmt.Fprintf(buf, "  %s [label=%s, style=rounded];\n", node.id, dotQuote(label))
+	} else {
+		fmt.Fprintf(buf, "  %s [label=%s];\n", node.id, dotQuote(node.segment))
+	}
+
+	for _, c := range node.children {
+		fmt.Fprintf(buf, "  %s -> %s;\n", node.id, c.id)
+	}
+	for _, c := range node.children {
+		writeGraphvizNode(buf, c)
+	}
+}
+
+// Truncate string to max characters, appending `...` if it's truncated.
+func truncateValue(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+
+	return string(r[:max]) + "..."
+}
+
+// Quote string as DOT string. `"` and `\` are escaped and new lines are written as `\n` line breaks.
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\r", "", -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+
+	return `"` + s + `"`
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestGraphvizOutput(t *testing.T) {
+	fPath := writeTestFile(t, "config.toml", `name = "billing \"prod\""
+motd = "Welcome to the billing service, maintained by the payments team"
+
+[db]
+host = "db.internal"
+port = 5432
+password = "hunter2"
+`)
+
+	// Filtered keys aren't drawn and prefix segments are nodes.
+	pairs := testKVPairs(t, "--prefix", "app/billing", "--ignore-keys-regex", "/password$", fPath)
+	got, err := kvPairsToString("graphviz", pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, "graphviz", got)
+}
+
+func TestDOTQuote(t *testing.T) {
+	tests := map[string]string{
+		`plain`:              `"plain"`,
+		`say "hi"`:           `"say \"hi\""`,
+		`C:\temp`:            `"C:\\temp"`,
+		"line 1\r\nline 2\n": `"line 1\nline 2\n"`,
+	}
+	for in, want := range tests {
+		if got := dotQuote(in); got != want {
+			t.Errorf("dotQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+
+	if got := truncateValue("héllo wörld", 5); got != "héllo..." {
+		t.Errorf("truncated by runes = %q", got)
+	}
+}
@@ -0,0 +1,595 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Run import command.
+func runImportCmd(cmd *cobra.Command, args []string) {
+	if importBatchSize < 1 || importBatchSize > consulMaxTxnOps {
+		errLog.Fatalf("Invalid import batch size - %d. Should be between 1 and %d", importBatchSize, consulMaxTxnOps)
+	}
+
+	if importReadonlyCheck && (importPrefixLock || importRollbackFile != "") {
+		errLog.Fatalf("Error: --readonly-check doesn't write keys, it can't be used with --prefix-lock or --rollback-file")
+	}
+
+	client := newConsulClient(importConsulAddr, importConsulToken)
+
+	// Read KV pairs as is from KV JSON files else convert configs.
+	var pairs []consulKVPair
+	if importFromKV {
+		var err error
+		if pairs, err = readKVPairInputs(args); err != nil {
+			errLog.Fatalf("Error: error reading KV pairs - %v", err)
+		}
+	} else {
+		pairs = convertKVInputs(cmd, args)
+	}
+
+	if err := importKVPairs(client, pairs, args); err != nil {
+		errLog.Fatalf("Error: %v", err)
+	}
+}
+
+// Import pairs to Consul. Prefix lock if enabled is held till all batches are written and released
+// before returning, also on errors.
+func importKVPairs(client *consulClient, pairs []consulKVPair, args []string) error {
+	// Serialize imports of overlapping prefixes.
+	if importPrefixLock {
+		lock, err := acquirePrefixLock(client, resolvedImportPrefixes(pairs), pairs, importPrefixLockTimeout)
+		if err != nil {
+			return err
+		}
+		defer lock.unlock()
+	}
+
+	// Merge pairs over keys of parent prefix.
+	if importInheritFrom != "" {
+		live, err := client.list(trimDelimiter(importInheritFrom, kvDelimiter))
+		if err != nil {
+			return fmt.Errorf("error reading keys of %s - %v", importInheritFrom, err)
+		}
+
+		pairs = inheritKVPairs(live, pairs, importInheritFrom, importPrefixes(pairs), kvDelimiter)
+	}
+
+	// Only write keys matching update only globs if given.
+	if len(importUpdateOnly) > 0 {
+		var err error
+		if pairs, err = filterKVPairsByGlobs(pairs, importUpdateOnly); err != nil {
+			return fmt.Errorf("invalid update only pattern - %v", err)
+		}
+	}
+
+	// Check pairs and print collected warnings.
+	checkKVPairs(pairs)
+	if err := flushWarnings(); err != nil {
+		return err
+	}
+
+	// Keys given more than once are written once with the last value so that every key is in a single batch.
+	pairs = dedupeKVPairs(pairs)
+
+	// Report keys which differ only by case from other keys or live keys.
+	if importCaseInsensitiveDedupe {
+		live, err := client.keys("")
+		if err != nil {
+			return fmt.Errorf("error listing keys - %v", err)
+		}
+
+		if conflicts := caseConflicts(pairs, live); len(conflicts) > 0 {
+			for _, c := range conflicts {
+				errLog.Printf("Conflict: %s", c)
+			}
+			return fmt.Errorf("%d key(s) differ only by case, nothing is imported", len(conflicts))
+		}
+	}
+
+	// Only compare keys with Consul without writing anything.
+	if importReadonlyCheck {
+		// Empty scope would compare the whole KV store.
+		scopes := readonlyScopes(resolvedImportPrefixes(pairs), kvDelimiter)
+		if len(scopes) == 0 {
+			return fmt.Errorf("keys share no path prefix, set --prefix or check inputs of every prefix separately")
+		}
+		scope := strings.Join(scopes, ", ")
+
+		var live []consulKVPair
+		for _, s := range scopes {
+			l, err := client.list(s)
+			if err != nil {
+				return fmt.Errorf("error reading keys of %s - %v", s, err)
+			}
+			live = append(live, l...)
+		}
+
+		diff, n, err := readonlyCheck(pairs, live, scopes, args)
+		if err != nil {
+			return fmt.Errorf("error comparing keys - %v", err)
+		}
+		if n > 0 {
+			if err := writeOutput(importOutput, diff); err != nil {
+				return fmt.Errorf("error writing output - %v", err)
+			}
+			return fmt.Errorf("%d key(s) under %q differ from Consul", n, scope)
+		}
+
+		sysLog.Printf("%d key(s) under %q are in sync with Consul", len(pairs), scope)
+		return nil
+	}
+
+	// Save operations which restore current state of keys before changing them.
+	if importRollbackFile != "" {
+		live, err := rollbackSnapshot(client, pairs, kvDelimiter)
+		if err != nil {
+			return fmt.Errorf("error reading current keys - %v", err)
+		}
+
+		if err := writeOpsFile(importRollbackFile, rollbackOps(pairs, live)); err != nil {
+			return fmt.Errorf("error writing rollback file - %v", err)
+		}
+	}
+
+	batches := batchKVPairs(pairs, importBatchSize)
+	if err := validateBatches(pairs, batches); err != nil {
+		return fmt.Errorf("invalid import batches - %v", err)
+	}
+
+	// Write every batch in a single transaction.
+	importedPairs, failedPairs, failed := importBatches(client, batches)
+
+	// Save imported keys for audit or rollback.
+	if importAlsoWrite != "" {
+		if err := writeKVPairsFile(importAlsoWrite, importedPairs); err != nil {
+			errLog.Printf("Error: error writing imported keys - %v", err)
+		}
+	}
+
+	// Save failed keys so that they can be retried later. Stale retry file is removed if all batches succeed.
+	if importRetryFile != "" {
+		if err := writeRetryFile(importRetryFile, failedPairs); err != nil {
+			errLog.Printf("Error: error writing retry file - %v", err)
+		} else if len(failedPairs) > 0 {
+			errLog.Printf("Failed keys written to %s, retry with: consul-cfg import --from-kv %s", importRetryFile, importRetryFile)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d batches failed", failed, len(batches))
+	}
+
+	return nil
+}
+
+// Write every batch in a single transaction. Batches which fail are logged and their pairs returned as
+// failed pairs, so that other batches are still written. Returns written pairs (except deleted keys),
+// failed pairs and the number of failed batches.
+func importBatches(client *consulClient, batches [][]consulKVPair) (imported []consulKVPair, failedPairs []consulKVPair, failed int) {
+	for i, b := range batches {
+		ops, sets, deletes := batchOps(b)
+		if err := client.txn(ops); err != nil {
+			errLog.Printf("Batch %d/%d: failed to import %d keys - %v", i+1, len(batches), len(b), err)
+			failed++
+			failedPairs = append(failedPairs, b...)
+			continue
+		}
+		imported = append(imported, sets...)
+
+		if deletes > 0 {
+			sysLog.Printf("Batch %d/%d: imported %d keys, deleted %d keys", i+1, len(batches), len(b)-deletes, deletes)
+		} else {
+			sysLog.Printf("Batch %d/%d: imported %d keys", i+1, len(batches), len(b))
+		}
+	}
+
+	return imported, failedPairs, failed
+}
+
+// Get transaction operations of batch. Returns operations, pairs which are set and number of deleted keys.
+func batchOps(b []consulKVPair) ([]consulTxnOp, []consulKVPair, int) {
+	ops := make([]consulTxnOp, 0, len(b))
+	sets := make([]consulKVPair, 0, len(b))
+	deletes := 0
+	for _, p := range b {
+		// Null values delete the key instead of writing null.
+		if importMapNullToDelete && isNullPair(p) {
+			ops = append(ops, consulTxnOp{KV: consulTxnKVOp{Verb: "delete", Key: p.Key}})
+			deletes++
+			continue
+		}
+
+		ops = append(ops, consulTxnOp{KV: consulTxnKVOp{
+			Verb:  "set",
+			Key:   p.Key,
+			Value: p.Value,
+			Flags: p.Flags,
+		}})
+		sets = append(sets, p)
+	}
+
+	return ops, sets, deletes
+}
+
+// Get path prefixes compared by readonly check from resolved prefixes of imported pairs. Prefixes nested in
+// another prefix are left out since their keys are listed with it. Returns nil if any prefix is empty.
+func readonlyScopes(prefixes []string, delimiter string) []string {
+	var scopes []string
+	for _, p := range prefixes {
+		p = trimDelimiter(p, delimiter)
+		if p == "" {
+			return nil
+		}
+		scopes = append(scopes, p)
+	}
+	sort.Strings(scopes)
+
+	var out []string
+	for _, s := range scopes {
+		nested := false
+		for _, o := range out {
+			if hasPathPrefix(s, o, delimiter) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+// Compare pairs with live pairs under scope path prefixes, as if pairs were imported and keys of scopes not in
+// pairs were removed. Pairs deleted by --map-null-to-delete should be missing from Consul and only live keys
+// matching --update-only are compared. Returns differences in unified diff format and number of changed keys.
+func readonlyCheck(pairs []consulKVPair, live []consulKVPair, scopes []string, args []string) (string, int, error) {
+	expected := make([]consulKVPair, 0, len(pairs))
+	for _, p := range pairs {
+		if !(importMapNullToDelete && isNullPair(p)) {
+			expected = append(expected, p)
+		}
+	}
+
+	// Consul lists keys by string prefix, ex: app also lists apple/name.
+	inScope := make([]consulKVPair, 0, len(live))
+	for _, p := range live {
+		for _, scope := range scopes {
+			if hasPathPrefix(p.Key, scope, kvDelimiter) {
+				inScope = append(inScope, p)
+				break
+			}
+		}
+	}
+	if len(importUpdateOnly) > 0 {
+		var err error
+		if inScope, err = filterKVPairsByGlobs(inScope, importUpdateOnly); err != nil {
+			return "", 0, err
+		}
+	}
+
+	changes, _ := kvChanges(inScope, expected)
+	if len(changes) == 0 {
+		return "", 0, nil
+	}
+
+	diff, err := unifiedDiff(inScope, expected, "consul", diffInputsName(args))
+
+	return diff, len(changes), err
+}
+
+// Copy parent pairs under parent prefix to every target prefix and add pairs after them, so that pairs
+// win over parent pairs of same key when deduped. Parent prefix itself and keys outside it are ignored.
+func inheritKVPairs(parent []consulKVPair, pairs []consulKVPair, from string, to []string, delimiter string) []consulKVPair {
+	from = trimDelimiter(from, delimiter)
+
+	out := make([]consulKVPair, 0, len(parent)*len(to)+len(pairs))
+	for _, t := range to {
+		for _, p := range parent {
+			if p.Key == from || !hasPathPrefix(p.Key, from, delimiter) {
+				continue
+			}
+
+			rel := trimDelimiter(strings.TrimPrefix(p.Key, from), delimiter)
+			out = append(out, consulKVPair{Key: joinKey(t, rel, delimiter), Flags: p.Flags, Value: p.Value})
+		}
+	}
+
+	return append(out, pairs...)
+}
+
+// Get prefixes of imported pairs. Converted configs have the resolved prefix of every input, ex: from
+// settings or hostname, and KV JSON inputs the common path prefix of their pairs.
+func importPrefixes(pairs []consulKVPair) []string {
+	if importFromKV {
+		return []string{commonPathPrefix(pairs, kvDelimiter)}
+	}
+
+	return inputPrefixes
+}
+
+// Get prefixes of imported pairs with inputs without prefix resolved to the path prefix shared by the keys.
+func resolvedImportPrefixes(pairs []consulKVPair) []string {
+	var prefixes []string
+	for _, prefix := range importPrefixes(pairs) {
+		if prefix == "" {
+			prefix = commonPathPrefix(pairs, kvDelimiter)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	if len(prefixes) == 0 {
+		prefixes = []string{commonPathPrefix(pairs, kvDelimiter)}
+	}
+
+	return prefixes
+}
+
+// Get operations which undo import of pairs given live pairs. Changed and deleted keys are set
+// to their live value and flags, and added keys are deleted. Unchanged keys are left out.
+func rollbackOps(pairs []consulKVPair, live []consulKVPair) []consulTxnOp {
+	liveByKey := make(map[string]consulKVPair, len(live))
+	for _, p := range live {
+		liveByKey[p.Key] = p
+	}
+
+	ops := []consulTxnOp{}
+	for _, p := range pairs {
+		deleted := importMapNullToDelete && isNullPair(p)
+		l, ok := liveByKey[p.Key]
+		switch {
+		case !ok && !deleted:
+			ops = append(ops, consulTxnOp{KV: consulTxnKVOp{Verb: "delete", Key: p.Key}})
+		case ok && (deleted || l.Value != p.Value || l.Flags != p.Flags):
+			ops = append(ops, consulTxnOp{KV: consulTxnKVOp{Verb: "set", Key: l.Key, Value: l.Value, Flags: l.Flags}})
+		}
+	}
+
+	return ops
+}
+
+// Get live pairs needed to undo import of pairs. Keys under the common path prefix of pairs are read
+// at once. If pairs don't share a prefix, keys under every top-level prefix of pairs and top-level keys
+// are read separately, so that the whole KV isn't read.
+func rollbackSnapshot(client *consulClient, pairs []consulKVPair, delimiter string) ([]consulKVPair, error) {
+	if prefix := commonPathPrefix(pairs, delimiter); prefix != "" {
+		live, err := client.list(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("error reading keys of %s - %v", prefix, err)
+		}
+
+		return live, nil
+	}
+
+	var (
+		live []consulKVPair
+		seen = make(map[string]bool)
+	)
+	for _, p := range pairs {
+		var (
+			l   []consulKVPair
+			err error
+		)
+		if i := strings.Index(p.Key, delimiter); i >= 0 {
+			prefix := p.Key[:i+len(delimiter)]
+			if seen[prefix] {
+				continue
+			}
+			seen[prefix] = true
+			l, err = client.list(prefix)
+		} else {
+			if seen[p.Key] {
+				continue
+			}
+			seen[p.Key] = true
+			l, err = client.get(p.Key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading keys of %s - %v", p.Key, err)
+		}
+
+		live = append(live, l...)
+	}
+
+	return live, nil
+}
+
+// Get longest prefix of whole path segments shared by keys of all pairs.
+func commonPathPrefix(pairs []consulKVPair, delimiter string) string {
+	var common []string
+	for i, p := range pairs {
+		segs := strings.Split(p.Key, delimiter)
+		// Last segment is the key itself.
+		segs = segs[:len(segs)-1]
+		if i == 0 {
+			common = segs
+			continue
+		}
+
+		n := 0
+		for n < len(common) && n < len(segs) && common[n] == segs[n] {
+			n++
+		}
+		common = common[:n]
+	}
+
+	return strings.Join(common, delimiter)
+}
+
+// Write Consul transaction operations to file as JSON.
+func writeOpsFile(fPath string, ops []consulTxnOp) error {
+	b, err := json.MarshalIndent(ops, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fPath, b, 0644)
+}
+
+// Check if value of KV pair is null.
+func isNullPair(p consulKVPair) bool {
+	v, err := pairValue(p)
+	return err == nil && v == "null"
+}
+
+// Split KV pairs into batches of given size.
+func batchKVPairs(pairs []consulKVPair, size int) [][]consulKVPair {
+	var batches [][]consulKVPair
+	for len(pairs) > size {
+		batches = append(batches, pairs[:size])
+		pairs = pairs[size:]
+	}
+
+	if len(pairs) > 0 {
+		batches = append(batches, pairs)
+	}
+
+	return batches
+}
+
+// Remove pairs whose key is repeated later, so that last value of every key is kept.
+func dedupeKVPairs(pairs []consulKVPair) []consulKVPair {
+	last := make(map[string]int, len(pairs))
+	for i, p := range pairs {
+		last[p.Key] = i
+	}
+
+	out := make([]consulKVPair, 0, len(last))
+	for i, p := range pairs {
+		if last[p.Key] == i {
+			out = append(out, p)
+		}
+	}
+
+	return out
+}
+
+// Get conflicts between keys which differ only by case, among pairs and between pairs and live keys.
+func caseConflicts(pairs []consulKVPair, live []string) []string {
+	var (
+		conflicts []string
+		seen      = make(map[string]string, len(pairs))
+		liveLower = make(map[string][]string)
+	)
+	for _, k := range live {
+		liveLower[strings.ToLower(k)] = append(liveLower[strings.ToLower(k)], k)
+	}
+
+	for _, p := range pairs {
+		lower := strings.ToLower(p.Key)
+		if k, ok := seen[lower]; ok {
+			conflicts = append(conflicts, fmt.Sprintf("keys %s and %s differ only by case", k, p.Key))
+			continue
+		}
+		seen[lower] = p.Key
+
+		for _, k := range liveLower[lower] {
+			if k != p.Key {
+				conflicts = append(conflicts, fmt.Sprintf("key %s differs only by case from live key %s", p.Key, k))
+			}
+		}
+	}
+
+	return conflicts
+}
+
+// Check that batches cover exactly the keys of the pairs and no key is in more than one batch, since
+// writing a key in two batches isn't atomic and the earlier value may be left behind if a later batch fails.
+// Batches are also checked against limits Consul enforces on transactions, so that a batch isn't rejected
+// after other batches are written. Keys shouldn't be longer than --max-key-length, values not bigger than
+// Consul's default max value size and JSON payload of every transaction not bigger than Consul's
+// default max transaction request size.
+func validateBatches(pairs []consulKVPair, batches [][]consulKVPair) error {
+	keys := make(map[string]bool, len(pairs))
+	for _, p := range pairs {
+		keys[p.Key] = true
+	}
+
+	seen := make(map[string]int, len(pairs))
+	for i, b := range batches {
+		for _, p := range b {
+			if j, ok := seen[p.Key]; ok {
+				return fmt.Errorf("key %s is in batches %d and %d", p.Key, j+1, i+1)
+			}
+			if !keys[p.Key] {
+				return fmt.Errorf("key %s of batch %d isn't imported", p.Key, i+1)
+			}
+			seen[p.Key] = i
+		}
+	}
+
+	if len(seen) != len(keys) {
+		for _, p := range pairs {
+			if _, ok := seen[p.Key]; !ok {
+				return fmt.Errorf("key %s isn't in any batch", p.Key)
+			}
+		}
+	}
+
+	var errs []string
+	for i, b := range batches {
+		for _, p := range b {
+			if kvMaxKeyLength > 0 && len(p.Key) > kvMaxKeyLength {
+				errs = append(errs, fmt.Sprintf("key %s is %d bytes, max key length is %d bytes", p.Key, len(p.Key), kvMaxKeyLength))
+			}
+
+			v, err := pairValue(p)
+			if err != nil {
+				return err
+			}
+			if len(v) > consulMaxValueSize {
+				errs = append(errs, fmt.Sprintf("value of key %s is %d bytes, Consul allows values of at most %d bytes", p.Key, len(v), consulMaxValueSize))
+			}
+		}
+
+		ops, _, _ := batchOps(b)
+		payload, err := json.Marshal(ops)
+		if err != nil {
+			return err
+		}
+		if len(payload) > consulMaxTxnSize {
+			errs = append(errs, fmt.Sprintf("batch %d is %d bytes, Consul allows transactions of at most %d bytes, use a smaller --import-batch-size", i+1, len(payload), consulMaxTxnSize))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// Write failed KV pairs to retry file in KV JSON format. Removes the file if there are no failed pairs.
+func writeRetryFile(fPath string, pairs []consulKVPair) error {
+	if len(pairs) == 0 {
+		if err := os.Remove(fPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	return writeKVPairsFile(fPath, pairs)
+}
+
+// Write KV pairs to file in KV JSON format.
+func writeKVPairsFile(fPath string, pairs []consulKVPair) error {
+	if pairs == nil {
+		pairs = []consulKVPair{}
+	}
+
+	b, err := json.MarshalIndent(pairs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fPath, b, 0644)
+}
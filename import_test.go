@@ -0,0 +1,764 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Mock Consul with a KV store, the txn endpoint and session locks. Transactions with a key containing
+// `fail` are rolled back unless recovered is set.
+type mockConsul struct {
+	mu       sync.Mutex
+	kv       map[string]consulKVPair
+	txns     [][]consulTxnOp
+	calls    []string
+	sessions int
+	// Session holding lock of key.
+	locks map[string]string
+	// Failures are over, ex: a transient error of a retried import.
+	recovered bool
+}
+
+func newMockConsul(t *testing.T) (*mockConsul, *consulClient) {
+	m := &mockConsul{kv: make(map[string]consulKVPair), locks: make(map[string]string)}
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+
+	return m, newConsulClient(srv.URL, "")
+}
+
+func (m *mockConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, r.Method+" "+r.URL.Path)
+
+	switch {
+	case r.URL.Path == "/v1/txn" && r.Method == http.MethodPut:
+		var ops []consulTxnOp
+		if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.txns = append(m.txns, ops)
+
+		var errs []consulTxnError
+		for i, op := range ops {
+			if strings.Contains(op.KV.Key, "fail") && !m.recovered {
+				errs = append(errs, consulTxnError{OpIndex: i, What: "forced failure"})
+			}
+		}
+		if len(errs) > 0 {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{"Errors": errs})
+			return
+		}
+
+		for _, op := range ops {
+			switch op.KV.Verb {
+			case "set":
+				m.kv[op.KV.Key] = consulKVPair{Key: op.KV.Key, Flags: op.KV.Flags, Value: op.KV.Value}
+			case "delete":
+				delete(m.kv, op.KV.Key)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"Results": []interface{}{}})
+
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/") && r.Method == http.MethodGet:
+		prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		if _, ok := r.URL.Query()["keys"]; ok {
+			var keys []string
+			for _, k := range sortedKVKeys(m.kv) {
+				if strings.HasPrefix(k, prefix) {
+					keys = append(keys, k)
+				}
+			}
+			if len(keys) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(keys)
+			return
+		}
+
+		_, recurse := r.URL.Query()["recurse"]
+		var out []map[string]interface{}
+		for _, k := range sortedKVKeys(m.kv) {
+			if k == prefix || (recurse && strings.HasPrefix(k, prefix)) {
+				p := m.kv[k]
+				out = append(out, map[string]interface{}{"Key": p.Key, "Flags": p.Flags, "Value": p.Value, "CreateIndex": 1, "ModifyIndex": 2})
+			}
+		}
+		// Lock keys have the session holding them.
+		lockKeys := make([]string, 0, len(m.locks))
+		for k := range m.locks {
+			lockKeys = append(lockKeys, k)
+		}
+		sort.Strings(lockKeys)
+		for _, k := range lockKeys {
+			if k == prefix || (recurse && strings.HasPrefix(k, prefix)) {
+				out = append(out, map[string]interface{}{"Key": k, "Flags": 0, "Value": "", "Session": m.locks[k]})
+			}
+		}
+		if len(out) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(out)
+
+	case r.URL.Path == "/v1/session/create" && r.Method == http.MethodPut:
+		m.sessions++
+		json.NewEncoder(w).Encode(map[string]string{"ID": "session-" + strconv.Itoa(m.sessions)})
+
+	case strings.HasPrefix(r.URL.Path, "/v1/session/renew/") && r.Method == http.MethodPut:
+		w.Write([]byte("[]"))
+
+	case strings.HasPrefix(r.URL.Path, "/v1/session/destroy/") && r.Method == http.MethodPut:
+		id := strings.TrimPrefix(r.URL.Path, "/v1/session/destroy/")
+		for k, s := range m.locks {
+			if s == id {
+				delete(m.locks, k)
+			}
+		}
+		w.Write([]byte("true"))
+
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/") && r.Method == http.MethodPut:
+		key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		q := r.URL.Query()
+		switch {
+		case q.Get("acquire") != "":
+			if s, ok := m.locks[key]; ok && s != q.Get("acquire") {
+				w.Write([]byte("false"))
+				return
+			}
+			m.locks[key] = q.Get("acquire")
+			w.Write([]byte("true"))
+		case q.Get("release") != "":
+			if m.locks[key] == q.Get("release") {
+				delete(m.locks, key)
+			}
+			w.Write([]byte("true"))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func sortedKVKeys(kv map[string]consulKVPair) []string {
+	m := make(map[string]interface{}, len(kv))
+	for k := range kv {
+		m[k] = nil
+	}
+
+	return sortedMapKeys(m)
+}
+
+// KV pair of JSON value.
+func testPair(key string, value string) consulKVPair {
+	return consulKVPair{Key: key, Value: base64.StdEncoding.EncodeToString([]byte(value))}
+}
+
+// Discard logs of the test.
+func quietLogs(t *testing.T) {
+	s, e := sysLog, errLog
+	sysLog = log.New(ioutil.Discard, "", 0)
+	errLog = log.New(ioutil.Discard, "", 0)
+	t.Cleanup(func() { sysLog, errLog = s, e })
+}
+
+func TestImportBatchesPartialFailure(t *testing.T) {
+	quietLogs(t)
+	m, client := newMockConsul(t)
+
+	pairs := []consulKVPair{
+		testPair("app/a", "1"),
+		testPair("app/b", `"x"`),
+		testPair("app/fail", "true"),
+		testPair("app/c", "3"),
+		testPair("app/d", "4"),
+	}
+	imported, failedPairs, failed := importBatches(client, batchKVPairs(pairs, 2))
+
+	if failed != 1 {
+		t.Errorf("failed batches = %d, want 1", failed)
+	}
+	if len(m.txns) != 3 {
+		t.Errorf("transactions = %d, want 3", len(m.txns))
+	}
+	if want := []consulKVPair{pairs[0], pairs[1], pairs[4]}; !reflect.DeepEqual(imported, want) {
+		t.Errorf("imported = %v, want %v", imported, want)
+	}
+	if want := pairs[2:4]; !reflect.DeepEqual(failedPairs, want) {
+		t.Errorf("failed pairs = %v, want %v", failedPairs, want)
+	}
+
+	// Failed batch is rolled back as a whole.
+	if _, ok := m.kv["app/c"]; ok {
+		t.Errorf("key app/c of failed batch is written")
+	}
+	if got := m.kv["app/d"]; !reflect.DeepEqual(got, pairs[4]) {
+		t.Errorf("app/d = %v, want %v", got, pairs[4])
+	}
+}
+
+func TestImportBatchesNullToDelete(t *testing.T) {
+	quietLogs(t)
+	m, client := newMockConsul(t)
+	m.kv["app/old"] = testPair("app/old", "1")
+
+	importMapNullToDelete = true
+	t.Cleanup(func() { importMapNullToDelete = false })
+
+	imported, _, failed := importBatches(client, [][]consulKVPair{{testPair("app/old", "null"), testPair("app/new", "2")}})
+	if failed != 0 {
+		t.Fatalf("failed batches = %d, want 0", failed)
+	}
+
+	ops := m.txns[0]
+	if ops[0].KV.Verb != "delete" || ops[1].KV.Verb != "set" {
+		t.Errorf("verbs = %s, %s, want delete, set", ops[0].KV.Verb, ops[1].KV.Verb)
+	}
+	if _, ok := m.kv["app/old"]; ok {
+		t.Errorf("app/old isn't deleted")
+	}
+	if len(imported) != 1 || imported[0].Key != "app/new" {
+		t.Errorf("imported = %v, want only app/new", imported)
+	}
+}
+
+func TestImportMapNullToDelete(t *testing.T) {
+	quietLogs(t)
+	m, client := newMockConsul(t)
+	for _, k := range []string{"myconfig/app/db/host", "myconfig/app/db/replica", "myconfig/app/db/replica/port", "myconfig/app/name"} {
+		m.kv[k] = testPair(k, `"old"`)
+	}
+	config := writeTestFile(t, "config.json", `{"name": "app", "db": {"host": "pg", "replica": null}}`)
+
+	// Without the flag null keys are left out and nothing is deleted.
+	cmd, args := testCmd(t, "import", "--prefix", "myconfig/app", config)
+	if err := importKVPairs(client, convertKVInputs(cmd, args), args); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.kv["myconfig/app/db/replica"]; !ok {
+		t.Errorf("null key is deleted without --map-null-to-delete")
+	}
+
+	m.txns = nil
+	cmd, args = testCmd(t, "import", "--prefix", "myconfig/app", "--map-null-to-delete", config)
+	if err := importKVPairs(client, convertKVInputs(cmd, args), args); err != nil {
+		t.Fatal(err)
+	}
+
+	var ops []string
+	for _, op := range m.txns[0] {
+		ops = append(ops, op.KV.Verb+" "+op.KV.Key)
+	}
+	want := []string{"set myconfig/app/db/host", "delete myconfig/app/db/replica", "set myconfig/app/name"}
+	if len(m.txns) != 1 || !reflect.DeepEqual(ops, want) {
+		t.Errorf("operations = %v, want a single transaction of %v", ops, want)
+	}
+
+	// Only the exact key is deleted.
+	if got := sortedKVKeys(m.kv); !reflect.DeepEqual(got, []string{"myconfig/app/db/host", "myconfig/app/db/replica/port", "myconfig/app/name"}) {
+		t.Errorf("keys = %v", got)
+	}
+	testCmd(t, "import")
+}
+
+func TestTxnError(t *testing.T) {
+	_, client := newMockConsul(t)
+
+	err := client.txn([]consulTxnOp{{KV: consulTxnKVOp{Verb: "set", Key: "ok"}}, {KV: consulTxnKVOp{Verb: "set", Key: "fail/me"}}})
+	if err == nil || !strings.Contains(err.Error(), "fail/me: forced failure") {
+		t.Errorf("error = %v, want rolled back error with failed key", err)
+	}
+
+	ops := make([]consulTxnOp, consulMaxTxnOps+1)
+	if err := client.txn(ops); err == nil {
+		t.Errorf("expected error for more than %d operations", consulMaxTxnOps)
+	}
+}
+
+func TestWriteRetryFile(t *testing.T) {
+	quietLogs(t)
+	_, client := newMockConsul(t)
+	fPath := filepath.Join(t.TempDir(), "retry.json")
+
+	pairs := []consulKVPair{testPair("app/a", "1"), testPair("app/fail", `"x"`)}
+	_, failedPairs, _ := importBatches(client, batchKVPairs(pairs, 1))
+	if err := writeRetryFile(fPath, failedPairs); err != nil {
+		t.Fatal(err)
+	}
+
+	// Retry file is a KV JSON file which can be imported with --from-kv.
+	got, err := readKVPairInputs([]string{fPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := pairs[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("retry file pairs = %v, want %v", got, want)
+	}
+
+	// Stale retry file is removed once nothing fails.
+	if err := writeRetryFile(fPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fPath); !os.IsNotExist(err) {
+		t.Errorf("retry file isn't removed - %v", err)
+	}
+}
+
+func TestImportRetryFileResume(t *testing.T) {
+	quietLogs(t)
+	m, client := newMockConsul(t)
+	retryFile := filepath.Join(t.TempDir(), "retry.json")
+
+	pairs := []consulKVPair{
+		testPair("app/a", "1"),
+		testPair("app/b", "2"),
+		testPair("app/c", "3"),
+		testPair("app/fail", "4"),
+		testPair("app/e", "5"),
+	}
+	_, args := testCmd(t, "import", "--import-batch-size", "2", "--retry-file", retryFile)
+	if err := importKVPairs(client, pairs, args); err == nil || err.Error() != "1 of 3 batches failed" {
+		t.Fatalf("error = %v, want 1 of 3 batches failed", err)
+	}
+	if got := sortedKVKeys(m.kv); !reflect.DeepEqual(got, []string{"app/a", "app/b", "app/e"}) {
+		t.Errorf("keys after partial failure = %v", got)
+	}
+
+	// Resume with the retry file once the failure is over, only failed keys are written.
+	m.recovered = true
+	m.txns = nil
+	_, args = testCmd(t, "import", "--from-kv", "--retry-file", retryFile, retryFile)
+	retry, err := readKVPairInputs(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := importKVPairs(client, retry, args); err != nil {
+		t.Fatal(err)
+	}
+
+	var written []string
+	for _, op := range m.txns[0] {
+		written = append(written, op.KV.Key)
+	}
+	if len(m.txns) != 1 || !reflect.DeepEqual(written, []string{"app/c", "app/fail"}) {
+		t.Errorf("retried transactions = %v, want a single transaction of app/c and app/fail", m.txns)
+	}
+	if got := sortedKVKeys(m.kv); !reflect.DeepEqual(got, []string{"app/a", "app/b", "app/c", "app/e", "app/fail"}) {
+		t.Errorf("keys after resume = %v", got)
+	}
+	if _, err := os.Stat(retryFile); !os.IsNotExist(err) {
+		t.Errorf("retry file isn't removed after resume - %v", err)
+	}
+	testCmd(t, "import")
+}
+
+func TestValidateBatches(t *testing.T) {
+	testCmd(t, "import")
+
+	big := testPair("app/big", `"`+strings.Repeat("x", consulMaxValueSize)+`"`)
+	// Values within the max value size which together exceed the max transaction size.
+	large := make([]consulKVPair, 3)
+	for i := range large {
+		large[i] = testPair("app/large"+strconv.Itoa(i), `"`+strings.Repeat("y", consulMaxValueSize/2)+`"`)
+	}
+
+	pairs := []consulKVPair{testPair("app/a", "1"), testPair("app/b", "2"), testPair("app/c", "3")}
+	tests := []struct {
+		name    string
+		pairs   []consulKVPair
+		batches [][]consulKVPair
+		err     string
+	}{
+		{"valid", nil, [][]consulKVPair{{testPair("app/a", "1"), testPair("app/b", "2")}}, ""},
+		{"chunked", pairs, batchKVPairs(pairs, 2), ""},
+		{"key in two batches", pairs, [][]consulKVPair{pairs[:2], pairs[1:]}, "key app/b is in batches 1 and 2"},
+		{"missing key", pairs, [][]consulKVPair{pairs[:1], pairs[2:]}, "key app/b isn't in any batch"},
+		{"unknown key", pairs[:2], batchKVPairs(pairs, 2), "key app/c of batch 2 isn't imported"},
+		{"long key", nil, [][]consulKVPair{{testPair("app/"+strings.Repeat("k", defaultMaxKeyLength), "1")}}, "max key length is 512 bytes"},
+		{"big value", nil, [][]consulKVPair{{big}}, "Consul allows values of at most"},
+		{"big transaction", nil, [][]consulKVPair{{testPair("app/a", "1")}, large}, "batch 2 is"},
+		{"small batches of large values", nil, [][]consulKVPair{large[:1], large[1:2], large[2:]}, ""},
+		{"invalid value", nil, [][]consulKVPair{{{Key: "app/a", Value: "not base64"}}}, "invalid base64"},
+	}
+
+	for _, tt := range tests {
+		// Batches of the pairs unless pairs are given.
+		if tt.pairs == nil {
+			for _, b := range tt.batches {
+				tt.pairs = append(tt.pairs, b...)
+			}
+		}
+
+		err := validateBatches(tt.pairs, tt.batches)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	// Keys over custom max key length are rejected.
+	testCmd(t, "import", "--max-key-length", "4")
+	if err := validateBatches(pairs[:1], [][]consulKVPair{pairs[:1]}); err == nil {
+		t.Errorf("expected error for key longer than --max-key-length")
+	}
+}
+
+func TestRollbackSnapshot(t *testing.T) {
+	m, client := newMockConsul(t)
+	for _, k := range []string{"app/a", "app/b", "db/host", "port", "other/x", "ports/x"} {
+		m.kv[k] = testPair(k, "1")
+	}
+
+	tests := []struct {
+		name  string
+		pairs []consulKVPair
+		calls []string
+		want  []string
+	}{
+		{
+			"common prefix",
+			[]consulKVPair{testPair("app/a", "2"), testPair("app/c", "2")},
+			[]string{"GET /v1/kv/app"},
+			[]string{"app/a", "app/b"},
+		},
+		{
+			"disjoint prefixes",
+			[]consulKVPair{testPair("app/a", "2"), testPair("db/host", "2"), testPair("app/c", "2"), testPair("port", "2"), testPair("missing", "2")},
+			[]string{"GET /v1/kv/app/", "GET /v1/kv/db/", "GET /v1/kv/port", "GET /v1/kv/missing"},
+			[]string{"app/a", "app/b", "db/host", "port"},
+		},
+	}
+
+	for _, tt := range tests {
+		m.calls = nil
+		live, err := rollbackSnapshot(client, tt.pairs, "/")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var keys []string
+		for _, p := range live {
+			keys = append(keys, p.Key)
+		}
+		if !reflect.DeepEqual(keys, tt.want) {
+			t.Errorf("%s: keys = %v, want %v", tt.name, keys, tt.want)
+		}
+		if !reflect.DeepEqual(m.calls, tt.calls) {
+			t.Errorf("%s: requests = %v, want %v", tt.name, m.calls, tt.calls)
+		}
+	}
+}
+
+func TestImportUpdateOnly(t *testing.T) {
+	quietLogs(t)
+	m, client := newMockConsul(t)
+	m.kv["app/db/host"] = testPair("app/db/host", `"old"`)
+	m.kv["app/name"] = testPair("app/name", `"old"`)
+
+	pairs := []consulKVPair{
+		testPair("app/db/host", `"new"`),
+		testPair("app/db/port", "5432"),
+		testPair("app/name", `"new"`),
+		testPair("app/debug", "true"),
+	}
+	_, args := testCmd(t, "import", "--update-only", "app/db/*")
+	if err := importKVPairs(client, pairs, args); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only matching keys are in the transactions.
+	var written []string
+	for _, txn := range m.txns {
+		for _, op := range txn {
+			written = append(written, op.KV.Verb+" "+op.KV.Key)
+		}
+	}
+	if want := []string{"set app/db/host", "set app/db/port"}; !reflect.DeepEqual(written, want) {
+		t.Errorf("written = %v, want %v", written, want)
+	}
+
+	// Keys not matching are left as is and new keys not matching aren't created.
+	want := map[string]string{"app/db/host": `"new"`, "app/db/port": "5432", "app/name": `"old"`}
+	got := make(map[string]string)
+	for k, p := range m.kv {
+		v, err := base64.StdEncoding.DecodeString(p.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[k] = string(v)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("kv = %v, want %v", got, want)
+	}
+
+	testCmd(t, "import")
+}
+
+func TestImportReadonlyCheck(t *testing.T) {
+	quietLogs(t)
+	m, client := newMockConsul(t)
+	m.kv["app/a"] = testPair("app/a", "1")
+	m.kv["app/b"] = testPair("app/b", "2")
+	m.kv["apple/x"] = testPair("apple/x", "1")
+
+	out := filepath.Join(t.TempDir(), "diff.txt")
+	tests := []struct {
+		name  string
+		args  []string
+		pairs []consulKVPair
+		err   string
+		diff  string
+	}{
+		{"in sync", []string{"--prefix", "app"}, []consulKVPair{testPair("app/a", "1"), testPair("app/b", "2")}, "", ""},
+		{"drifted", []string{"--prefix", "app"}, []consulKVPair{testPair("app/a", "3")}, `2 key(s) under "app" differ from Consul`,
+			"--- consul\n+++ -\n-app/a = 1\n+app/a = 3\n-app/b = 2\n"},
+		{"empty scope", nil, []consulKVPair{testPair("app/a", "1"), testPair("db/host", "1")}, "keys share no path prefix", ""},
+	}
+
+	for _, tt := range tests {
+		os.Remove(out)
+		m.calls = nil
+
+		_, args := testCmd(t, append([]string{"import", "--readonly-check", "--output", out}, tt.args...)...)
+		err := importKVPairs(client, tt.pairs, args)
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		} else if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+		}
+
+		b, err := ioutil.ReadFile(out)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		if string(b) != tt.diff {
+			t.Errorf("%s: diff = %q, want %q", tt.name, b, tt.diff)
+		}
+
+		// Nothing is written and empty scope isn't read.
+		for _, c := range m.calls {
+			if c == "PUT /v1/txn" || tt.name == "empty scope" {
+				t.Errorf("%s: unexpected request %s", tt.name, c)
+			}
+		}
+	}
+	testCmd(t, "import")
+}
+
+func TestImportReadonlyCheckOfInputs(t *testing.T) {
+	quietLogs(t)
+	m, client := newMockConsul(t)
+	m.kv["myconfig/auth/port"] = testPair("myconfig/auth/port", "1")
+	m.kv["myconfig/auth/stale"] = testPair("myconfig/auth/stale", "1")
+	m.kv["myconfig/billing/port"] = testPair("myconfig/billing/port", "2")
+	m.kv["myconfig/name"] = testPair("myconfig/name", `"myconfig"`)
+
+	// Scope is the prefix of the input from its settings, not the common prefix of its keys.
+	auth := writeTestFile(t, "auth.toml", "[db]\nport = 1\n[_consul_cfg]\nprefix = \"myconfig/auth\"\n")
+	out := filepath.Join(t.TempDir(), "diff.txt")
+	cmd, args := testCmd(t, "import", "--readonly-check", "--output", out, auth)
+	err := importKVPairs(client, convertKVInputs(cmd, args), args)
+	if err == nil || err.Error() != `3 key(s) under "myconfig/auth" differ from Consul` {
+		t.Errorf("error = %v", err)
+	}
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- consul\n+++ " + auth + "\n+myconfig/auth/db/port = 1\n-myconfig/auth/port = 1\n-myconfig/auth/stale = 1\n"
+	if string(b) != want {
+		t.Errorf("diff = %q, want %q", b, want)
+	}
+
+	// Every input is compared under its own prefix, other keys of the shared parent are left out.
+	billing := writeTestFile(t, "billing.toml", "port = 2\n[_consul_cfg]\nprefix = \"myconfig/billing\"\n")
+	synced := writeTestFile(t, "auth-synced.toml", "port = 1\nstale = 1\n[_consul_cfg]\nprefix = \"myconfig/auth\"\n")
+	cmd, args = testCmd(t, "import", "--readonly-check", "--output", out, synced, billing)
+	if err := importKVPairs(client, convertKVInputs(cmd, args), args); err != nil {
+		t.Errorf("in sync: %v", err)
+	}
+	for _, c := range m.calls {
+		if c == "PUT /v1/txn" {
+			t.Errorf("unexpected request %s", c)
+		}
+	}
+	testCmd(t, "import")
+}
+
+func TestReadonlyScopes(t *testing.T) {
+	got := readonlyScopes([]string{"app/db/", "app-x", "app", "billing", "app"}, "/")
+	if want := []string{"app", "app-x", "billing"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("scopes = %v, want %v", got, want)
+	}
+
+	if got := readonlyScopes([]string{"app", ""}, "/"); got != nil {
+		t.Errorf("with empty prefix scopes = %v, want nil", got)
+	}
+}
+
+func TestImportCaseInsensitiveDedupe(t *testing.T) {
+	quietLogs(t)
+
+	tests := []struct {
+		name  string
+		live  []string
+		pairs []string
+		err   string
+	}{
+		{"no conflicts", []string{"app/name", "other/Name"}, []string{"app/name", "app/port"}, ""},
+		{"among pairs", nil, []string{"app/Name", "app/name"}, "1 key(s) differ only by case"},
+		{"with live keys", []string{"App/name", "app/PORT"}, []string{"app/name", "app/port"}, "2 key(s) differ only by case"},
+	}
+
+	for _, tt := range tests {
+		m, client := newMockConsul(t)
+		for _, k := range tt.live {
+			m.kv[k] = testPair(k, `"live"`)
+		}
+
+		var pairs []consulKVPair
+		for _, k := range tt.pairs {
+			pairs = append(pairs, testPair(k, `"new"`))
+		}
+
+		_, args := testCmd(t, "import", "--prefix-case-insensitive-dedupe")
+		err := importKVPairs(client, pairs, args)
+		if tt.err == "" {
+			if err != nil || len(m.txns) != 1 {
+				t.Errorf("%s: err = %v, txns = %d", tt.name, err, len(m.txns))
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %s", tt.name, err, tt.err)
+		}
+		if len(m.txns) != 0 {
+			t.Errorf("%s: %d transactions written after conflicts", tt.name, len(m.txns))
+		}
+	}
+	testCmd(t, "import")
+}
+
+func TestCaseConflicts(t *testing.T) {
+	pairs := []consulKVPair{testPair("app/Host", "1"), testPair("app/host", "2"), testPair("app/port", "3")}
+	got := caseConflicts(pairs, []string{"app/port", "APP/PORT", "app/Port"})
+	want := []string{
+		"keys app/Host and app/host differ only by case",
+		"key app/port differs only by case from live key APP/PORT",
+		"key app/port differs only by case from live key app/Port",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestImportInheritFrom(t *testing.T) {
+	quietLogs(t)
+	m, client := newMockConsul(t)
+	for _, k := range []string{"shared", "shared/db/host", "shared/db/port", "sharedx/key"} {
+		m.kv[k] = testPair(k, `"db.internal"`)
+	}
+	host := testPair("shared/db/host", `"db.internal"`)
+	host.Flags = 3
+	m.kv["shared/db/host"] = host
+
+	// Prefix is set by settings of the input, not --prefix.
+	config := writeTestFile(t, "config.toml", "[db]\nport = 6432\n\n[_consul_cfg]\nprefix = \"production/app\"\n")
+	cmd, args := testCmd(t, "import", "--inherit-from", "shared/", config)
+	if err := importKVPairs(client, convertKVInputs(cmd, args), args); err != nil {
+		t.Fatal(err)
+	}
+
+	var ops []string
+	for _, op := range m.txns[0] {
+		v, _ := base64.StdEncoding.DecodeString(op.KV.Value)
+		ops = append(ops, fmt.Sprintf("%s %s=%s flags=%d", op.KV.Verb, op.KV.Key, v, op.KV.Flags))
+	}
+	sort.Strings(ops)
+	want := []string{
+		`set production/app/db/host="db.internal" flags=3`,
+		"set production/app/db/port=6432 flags=0",
+	}
+	if len(m.txns) != 1 || !reflect.DeepEqual(ops, want) {
+		t.Errorf("operations = %q, want a single transaction of %q", ops, want)
+	}
+	testCmd(t, "import")
+}
+
+func TestInheritKVPairs(t *testing.T) {
+	parent := []consulKVPair{testPair("shared", "0"), testPair("shared/a", "1"), testPair("shared/b/c", "2"), testPair("sharedx", "3")}
+	pairs := []consulKVPair{testPair("x/a", "4")}
+
+	var got []string
+	for _, p := range dedupeKVPairs(inheritKVPairs(parent, pairs, "shared/", []string{"x", "y/z"}, "/")) {
+		v, _ := pairValue(p)
+		got = append(got, p.Key+"="+v)
+	}
+	sort.Strings(got)
+
+	// Every target prefix gets the parent keys and pairs win over them.
+	want := []string{"x/a=4", "x/b/c=2", "y/z/a=1", "y/z/b/c=2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestImportAlsoWrite(t *testing.T) {
+	quietLogs(t)
+	m, client := newMockConsul(t)
+	fPath := filepath.Join(t.TempDir(), "imported.json")
+
+	// Repeated key is deduped and keys of the failed batch aren't in the file.
+	pairs := []consulKVPair{
+		testPair("app/a", "1"),
+		testPair("app/b", "2"),
+		testPair("app/fail", "3"),
+		testPair("app/c", "4"),
+		testPair("app/a", "5"),
+	}
+	_, args := testCmd(t, "import", "--import-batch-size", "2", "--also-write", fPath)
+	if err := importKVPairs(client, pairs, args); err == nil || !strings.Contains(err.Error(), "1 of 2 batches failed") {
+		t.Fatalf("err = %v, want a failed batch", err)
+	}
+
+	// File is the same as keys in Consul and can be imported as is with --from-kv.
+	written, err := readKVPairInputs([]string{fPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var imported []consulKVPair
+	for _, k := range sortedKVKeys(m.kv) {
+		imported = append(imported, m.kv[k])
+	}
+	sort.Slice(written, func(i, j int) bool { return written[i].Key < written[j].Key })
+	if !reflect.DeepEqual(written, imported) {
+		t.Errorf("written = %v, want imported %v", written, imported)
+	}
+	if len(written) != 2 || written[0].Key != "app/a" || written[0].Value != testPair("app/a", "5").Value {
+		t.Errorf("written = %v, want app/a=5 and app/c", written)
+	}
+	testCmd(t, "import")
+}
@@ -0,0 +1,322 @@
+// Open config inputs from files and other sources.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/vividvilla/consul-cfg/parser"
+)
+
+// Input spec prefix for reading files from git refs. Ex: git:https://github.com/org/repo.git#v1.0.0:config.toml
+const gitInputPrefix = "git:"
+
+// Config input along with its format type.
+type configInput struct {
+	name  string
+	cType string
+	r     io.Reader
+	// Prefix joined to the prefix of the input. Set by stdin section markers.
+	prefix string
+}
+
+// Section marker in stdin stream. Ex: #--- type=yaml prefix=db ---
+var sectionMarkerRe = regexp.MustCompile(`^#---\s+(.*?)\s*---\s*$`)
+
+// Built-in file extension to format mapping used when format type is not given.
+var inputTypeExts = map[string]string{
+	".toml":       "toml",
+	".yaml":       "yaml",
+	".yml":        "yaml",
+	".json":       "json",
+	".hcl":        "hcl",
+	".props":      "props",
+	".properties": "props",
+}
+
+// Custom file extension to format mapping from `--input-type-map`.
+var customInputTypeExts = make(map[string]string)
+
+// In memory clones of remote git repos made in current invocation.
+var gitClones = make(map[string]*git.Repository)
+
+func init() {
+	// Serve file:// remotes in process instead of running git-upload-pack.
+	client.InstallProtocol("file", server.NewServer(gitFileLoader{}))
+}
+
+// Load repos of file:// remotes. Both bare repos and worktrees are supported.
+type gitFileLoader struct{}
+
+func (gitFileLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	r, err := git.PlainOpen(ep.Path)
+	if err != nil {
+		return nil, transport.ErrRepositoryNotFound
+	}
+
+	return r.Storer, nil
+}
+
+// Open input file or spec.
+func openInput(name string) (io.Reader, error) {
+	if strings.HasPrefix(name, gitInputPrefix) {
+		return openGitInput(strings.TrimPrefix(name, gitInputPrefix))
+	}
+
+	if isObjectStoreInput(name) {
+		return openObjectStoreInput(name)
+	}
+
+	return os.Open(name)
+}
+
+// Load custom extension to format mappings of form `.ext=type`.
+func loadInputTypeMap(mappings []string) error {
+	for _, m := range mappings {
+		parts := strings.SplitN(m, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], ".") {
+			return fmt.Errorf("%s should be of form .ext=type", m)
+		}
+
+		if !isValidInputFormat(parts[1], inputFormats()) {
+			return fmt.Errorf("invalid format %s for %s. Available options are: %s", parts[1], parts[0], formatsToString(inputFormats()))
+		}
+
+		customInputTypeExts[strings.ToLower(parts[0])] = parts[1]
+	}
+
+	return nil
+}
+
+// Get format type of input. Given type takes precedence, then custom extension mapping, then extensions of
+// registered parsers and then built-in mappings.
+func inputType(name string, cType string) (string, error) {
+	if cType != "" {
+		return cType, nil
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := customInputTypeExts[ext]; ok {
+		return t, nil
+	}
+
+	if t, ok := parser.FormatForExt(ext); ok {
+		return t, nil
+	}
+
+	if t, ok := inputTypeExts[ext]; ok {
+		return t, nil
+	}
+
+	return "", fmt.Errorf("can't detect format type of %s, use --type or --input-type-map", name)
+}
+
+// Split stream into sections if it starts with a section marker. Each section has options
+// `type` and `prefix` and is converted independently. Stream without markers is a single input.
+func splitSections(name string, r io.Reader, cType string) ([]configInput, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimLeft(b, " \t\r\n")
+	firstLine := string(bytes.SplitN(trimmed, []byte("\n"), 2)[0])
+	if !sectionMarkerRe.MatchString(strings.TrimSpace(firstLine)) {
+		return []configInput{{name: name, cType: cType, r: bytes.NewReader(b)}}, nil
+	}
+
+	var (
+		inputs []configInput
+		cur    *configInput
+		buf    bytes.Buffer
+	)
+
+	// Add current section to inputs.
+	flush := func() {
+		if cur != nil {
+			cur.r = bytes.NewReader(append([]byte{}, buf.Bytes()...))
+			inputs = append(inputs, *cur)
+		}
+		buf.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(string(trimmed), "\n") {
+		m := sectionMarkerRe.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			buf.WriteString(line)
+			continue
+		}
+
+		flush()
+		cur = &configInput{name: fmt.Sprintf("%s section %d", name, len(inputs)+1), cType: cType}
+		for _, opt := range strings.Fields(m[1]) {
+			kv := strings.SplitN(opt, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid option %s in section marker: %s", opt, strings.TrimSpace(line))
+			}
+
+			switch kv[0] {
+			case "type":
+				cur.cType = kv[1]
+			case "prefix":
+				cur.prefix = kv[1]
+			default:
+				return nil, fmt.Errorf("unknown option %s in section marker: %s", kv[0], strings.TrimSpace(line))
+			}
+		}
+
+		if cur.cType == "" {
+			return nil, fmt.Errorf("type is required in section marker when --type is not given: %s", strings.TrimSpace(line))
+		}
+
+		if !isValidInputFormat(cur.cType, inputFormats()) {
+			return nil, fmt.Errorf("invalid format %s in section marker. Available options are: %s", cur.cType, formatsToString(inputFormats()))
+		}
+	}
+	flush()
+
+	return inputs, nil
+}
+
+// Read KV pairs from files in KV JSON format (same as `consul kv export`) or stdin if no files are given.
+func readKVPairInputs(args []string) ([]consulKVPair, error) {
+	var readers []io.Reader
+	if len(args) == 0 {
+		readers = append(readers, os.Stdin)
+	}
+
+	for _, fname := range args {
+		f, err := openInput(fname)
+		if err != nil {
+			return nil, err
+		}
+
+		readers = append(readers, f)
+	}
+	defer cleanupInputs()
+
+	var pairs []consulKVPair
+	for i, r := range readers {
+		var p []consulKVPair
+		if err := json.NewDecoder(r).Decode(&p); err != nil {
+			name := "stdin"
+			if len(args) > 0 {
+				name = args[i]
+			}
+
+			return nil, fmt.Errorf("invalid KV JSON in %s - %v", name, err)
+		}
+
+		pairs = append(pairs, p...)
+	}
+
+	return pairs, nil
+}
+
+// Read file from git ref. Spec format is <repo>#<ref>:<path> where repo is a local path or remote URL.
+func openGitInput(spec string) (io.Reader, error) {
+	i := strings.LastIndex(spec, "#")
+	if i == -1 {
+		return nil, fmt.Errorf("invalid git input %s, should be git:<repo>#<ref>:<path>", spec)
+	}
+
+	repo := spec[:i]
+	refPath := strings.SplitN(spec[i+1:], ":", 2)
+	if repo == "" || len(refPath) != 2 || refPath[0] == "" || refPath[1] == "" {
+		return nil, fmt.Errorf("invalid git input %s, should be git:<repo>#<ref>:<path>", spec)
+	}
+
+	if err := validateGitRef(refPath[0]); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(repo, "-") {
+		return nil, fmt.Errorf("invalid git repo %s, can't start with -", repo)
+	}
+
+	r, err := openGitRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := r.ResolveRevision(plumbing.Revision(refPath[0]))
+	if err != nil {
+		return nil, fmt.Errorf("error resolving git ref %s in %s: %v", refPath[0], repo, err)
+	}
+
+	commit, err := r.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("error reading git commit %s in %s: %v", refPath[0], repo, err)
+	}
+
+	f, err := commit.File(refPath[1])
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s at git ref %s in %s: %v", refPath[1], refPath[0], repo, err)
+	}
+
+	content, err := f.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s at git ref %s in %s: %v", refPath[1], refPath[0], repo, err)
+	}
+
+	return strings.NewReader(content), nil
+}
+
+// Open git repo. Local repos are used as is and remote repos are cloned in memory once per invocation.
+func openGitRepo(repo string) (*git.Repository, error) {
+	if fi, err := os.Stat(repo); err == nil && fi.IsDir() {
+		r, err := git.PlainOpen(repo)
+		if err != nil {
+			return nil, fmt.Errorf("error opening git repo %s: %v", repo, err)
+		}
+		return r, nil
+	}
+
+	if r, ok := gitClones[repo]; ok {
+		return r, nil
+	}
+
+	r, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{URL: repo})
+	if err != nil {
+		return nil, fmt.Errorf("error cloning git repo %s: %v", repo, err)
+	}
+
+	gitClones[repo] = r
+	return r, nil
+}
+
+// Check that ref is a branch, tag, commit or revision expression (ex: main~1).
+func validateGitRef(ref string) error {
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid git ref %s, can't start with -", ref)
+	}
+
+	for _, c := range ref {
+		if c <= ' ' || c == 0x7f {
+			return fmt.Errorf("invalid git ref %q, can't have spaces or control characters", ref)
+		}
+	}
+
+	return nil
+}
+
+// Remove clones made while opening inputs.
+func cleanupInputs() {
+	for repo := range gitClones {
+		delete(gitClones, repo)
+	}
+}
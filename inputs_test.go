@@ -0,0 +1,279 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Create git repo with config.toml committed twice, first commit is tagged v1.
+func testGitRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	r, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit := func(content, msg string) plumbing.Hash {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, "config.toml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wt.Add("config.toml"); err != nil {
+			t.Fatal(err)
+		}
+		h, err := wt.Commit(msg, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Unix(0, 0)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	v1 := commit("port = 1\n", "v1")
+	if _, err := r.CreateTag("v1", v1, nil); err != nil {
+		t.Fatal(err)
+	}
+	commit("port = 2\n", "v2")
+
+	return dir
+}
+
+func readGitInput(t *testing.T, spec string) (string, error) {
+	t.Helper()
+
+	r, err := openGitInput(spec)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := ioutil.ReadAll(r)
+	return string(b), err
+}
+
+func TestGitInputLocal(t *testing.T) {
+	dir := testGitRepo(t)
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"v1", "port = 1\n"},
+		{"main", "port = 2\n"},
+		{"main~1", "port = 1\n"},
+		{"HEAD", "port = 2\n"},
+	}
+	for _, tt := range tests {
+		got, err := readGitInput(t, dir+"#"+tt.ref+":config.toml")
+		if err != nil {
+			t.Errorf("ref %s: %v", tt.ref, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ref %s = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+
+	if _, err := readGitInput(t, dir+"#v1:missing.toml"); err == nil {
+		t.Errorf("expected error for missing path")
+	}
+	if _, err := readGitInput(t, dir+"#v9:config.toml"); err == nil {
+		t.Errorf("expected error for missing ref")
+	}
+}
+
+func TestGitInputClone(t *testing.T) {
+	dir := testGitRepo(t)
+	t.Cleanup(cleanupInputs)
+
+	url := "file://" + dir
+	for i := 0; i < 2; i++ {
+		got, err := readGitInput(t, url+"#v1:config.toml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "port = 1\n" {
+			t.Errorf("got %q, want %q", got, "port = 1\n")
+		}
+	}
+
+	// Repo is cloned once per invocation.
+	if _, ok := gitClones[url]; !ok || len(gitClones) != 1 {
+		t.Fatalf("clones = %v, want a single clone of %s", gitClones, url)
+	}
+
+	cleanupInputs()
+	if len(gitClones) != 0 {
+		t.Errorf("clones aren't removed: %v", gitClones)
+	}
+}
+
+func TestGitInputOptionInjection(t *testing.T) {
+	dir := testGitRepo(t)
+	marker := filepath.Join(t.TempDir(), "pwned")
+
+	specs := []string{
+		dir + "#--output=" + marker + ":config.toml",
+		dir + "#-p:config.toml",
+		dir + "#v1 --help:config.toml",
+		"--upload-pack=touch " + marker + "#v1:config.toml",
+		"ext::sh -c touch% " + marker + "#v1:config.toml",
+	}
+	for _, spec := range specs {
+		if _, err := readGitInput(t, spec); err == nil {
+			t.Errorf("expected error for %s", spec)
+		}
+	}
+	cleanupInputs()
+
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("git ran an injected option")
+	}
+}
+
+func TestInputTypeMap(t *testing.T) {
+	cfg := writeTestFile(t, "app.cfg", "port = 1\n")
+	conf := writeTestFile(t, "nginx.CONF", "workers = 2\n")
+	// YAML content in a file with a built-in extension.
+	yamlJSON := writeTestFile(t, "legacy.json", "debug: true\n")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--input-type-map", ".cfg=toml", cfg}, "port=1"},
+		{[]string{"--input-type-map", ".cfg=toml,.conf=toml", cfg, conf}, "port=1\nworkers=2"},
+		{[]string{"--input-type-map", ".json=yaml", yamlJSON}, "debug=true"},
+		{[]string{"--input-type-map", ".cfg=yaml", "--type", "toml", cfg}, "port=1"},
+	}
+	for _, tt := range tests {
+		if got := pairLines(t, testKVPairs(t, tt.args...)); got != tt.want {
+			t.Errorf("%v: got\n%s\nwant\n%s", tt.args, got, tt.want)
+		}
+	}
+
+	errs := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{cfg}, "can't detect format type of " + cfg + ", use --type or --input-type-map"},
+		{[]string{"--input-type-map", "cfg=toml", cfg}, "cfg=toml should be of form .ext=type"},
+		{[]string{"--input-type-map", ".cfg=ini", cfg}, "invalid format ini for .cfg"},
+	}
+	for _, tt := range errs {
+		_, stderr, code := runCLI(t, "", append([]string{"kv"}, tt.args...)...)
+		if code == 0 || !strings.Contains(stderr, tt.err) {
+			t.Errorf("%v: exit code %d, stderr %q, want error %q", tt.args, code, stderr, tt.err)
+		}
+	}
+}
+
+func TestSplitSections(t *testing.T) {
+	stream := "\n#--- type=yaml prefix=web ---\nport: 80\nhosts:\n  - a\n#--- type=toml prefix=db ---\nport = 5432\n"
+	inputs, err := splitSections("stdin", strings.NewReader(stream), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, in := range inputs {
+		b, err := ioutil.ReadAll(in.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, in.name+"|"+in.cType+"|"+in.prefix+"|"+string(b))
+	}
+	want := []string{
+		"stdin section 1|yaml|web|port: 80\nhosts:\n  - a\n",
+		"stdin section 2|toml|db|port = 5432\n",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sections = %q, want %q", got, want)
+	}
+
+	// Stream without markers is a single input of given type.
+	inputs, err = splitSections("stdin", strings.NewReader("port = 1\n#--- type=yaml ---\n"), "toml")
+	if err != nil || len(inputs) != 1 || inputs[0].cType != "toml" || inputs[0].prefix != "" {
+		t.Errorf("stream without leading marker = %+v, %v", inputs, err)
+	}
+
+	// Marker type defaults to --type.
+	inputs, err = splitSections("stdin", strings.NewReader("#--- prefix=a ---\nport = 1\n"), "toml")
+	if err != nil || len(inputs) != 1 || inputs[0].cType != "toml" || inputs[0].prefix != "a" {
+		t.Errorf("marker without type = %+v, %v", inputs, err)
+	}
+
+	errs := []struct {
+		stream string
+		err    string
+	}{
+		{"#--- prefix=a ---\nport = 1\n", "type is required in section marker when --type is not given"},
+		{"#--- type=ini ---\nport = 1\n", "invalid format ini in section marker"},
+		{"#--- type=toml env=prod ---\n", "unknown option env in section marker"},
+		{"#--- type=toml prod ---\n", "invalid option prod in section marker"},
+	}
+	for _, tt := range errs {
+		if _, err := splitSections("stdin", strings.NewReader(tt.stream), ""); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: error = %v, want %q", tt.stream, err, tt.err)
+		}
+	}
+}
+
+func TestStdinSections(t *testing.T) {
+	stream := "#--- type=yaml prefix=myconfig/web ---\nport: 80\ndebug: true\n#--- type=toml prefix=myconfig/db ---\nhost = \"localhost\"\nport = 5432\n"
+	stdout, stderr, code := runCLI(t, stream, "kv", "--output-format", "env-export")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	assertGolden(t, "stdin-sections", stdout)
+}
+
+func TestCombineWithStdin(t *testing.T) {
+	base := writeTestFile(t, "base.toml", `name = "billing"
+debug = false
+
+[db]
+host = "db.internal"
+port = 5432
+`)
+
+	// Stdin overrides keys of files in place and adds its other keys after them.
+	stdout, stderr, code := runCLI(t, "db:\n  host: localhost\ndebug: true\nlocal: true\n",
+		"kv", "--combine-with-stdin", "--stdin-type", "yaml", "--output-format", "env-export", base)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	want := "export DB_HOST='localhost'\nexport DB_PORT='5432'\nexport DEBUG='true'\nexport NAME='billing'\nexport LOCAL='true'\n"
+	if stdout != want {
+		t.Errorf("got\n%s\nwant\n%s", stdout, want)
+	}
+
+	// Stdin type defaults to --type and sections of stdin are supported.
+	stream := "#--- prefix=db ---\nport = 6432\n"
+	stdout, stderr, code = runCLI(t, stream, "kv", "--combine-with-stdin", "--type", "toml", "--output-format", "env-export", base)
+	if code != 0 || !strings.Contains(stdout, "export DB_PORT='6432'\n") {
+		t.Errorf("sections: code = %d, stdout = %s, stderr = %s", code, stdout, stderr)
+	}
+
+	_, stderr, code = runCLI(t, "debug: true\n", "kv", "--combine-with-stdin", base)
+	if code == 0 || !strings.Contains(stderr, "input format type is required for stdin, use --stdin-type or --type") {
+		t.Errorf("without type: code = %d, stderr = %s", code, stderr)
+	}
+}
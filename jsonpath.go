@@ -0,0 +1,212 @@
+// Minimal JSONPath evaluation on parsed configs.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Parsed `--prefix-from-json-path` expression.
+var prefixJSONPathSteps []jsonPathStep
+
+// Step of a JSONPath expression.
+type jsonPathStep struct {
+	// Member name, empty for index and wildcard steps.
+	name string
+	// Array index if it's an index step. Negative indexes count from the end.
+	index    int
+	isIndex  bool
+	wildcard bool
+	// Match at any depth (`..`).
+	recursive bool
+}
+
+// Parse JSONPath expression. Supported syntax is `$` root, `.name` and `['name']` members,
+// `[n]` array indexes, `*` and `[*]` wildcards and `..` recursive descent.
+func parseJSONPath(expr string) ([]jsonPathStep, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("JSONPath should start with $")
+	}
+
+	var steps []jsonPathStep
+	p := expr[1:]
+	for p != "" {
+		recursive := false
+		switch {
+		case strings.HasPrefix(p, ".."):
+			recursive = true
+			p = p[2:]
+		case p[0] == '.':
+			p = p[1:]
+		case p[0] != '[':
+			return nil, fmt.Errorf("unexpected %q at %s", p[0], p)
+		}
+
+		var step jsonPathStep
+		switch {
+		case strings.HasPrefix(p, "["):
+			end := strings.Index(p, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ at %s", p)
+			}
+
+			sel := strings.TrimSpace(p[1:end])
+			p = p[end+1:]
+
+			switch {
+			case sel == "*":
+				step.wildcard = true
+			case len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0]:
+				step.name = sel[1 : len(sel)-1]
+			default:
+				i, err := strconv.Atoi(sel)
+				if err != nil {
+					return nil, fmt.Errorf("unsupported selector [%s], only names, indexes and * are supported", sel)
+				}
+				step.index, step.isIndex = i, true
+			}
+
+		case strings.HasPrefix(p, "*"):
+			step.wildcard = true
+			p = p[1:]
+
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty member name in %s", expr)
+			}
+
+			step.name = p[:end]
+			p = p[end:]
+		}
+
+		step.recursive = recursive
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+// Evaluate JSONPath steps on value and return all matching values.
+func evalJSONPath(v interface{}, steps []jsonPathStep) []interface{} {
+	if len(steps) == 0 {
+		return []interface{}{v}
+	}
+
+	step := steps[0]
+	var out []interface{}
+	for _, c := range jsonPathSelect(v, step) {
+		out = append(out, evalJSONPath(c, steps[1:])...)
+	}
+
+	// Recursive descent also matches the step in every descendant.
+	if step.recursive {
+		for _, c := range jsonPathChildren(v) {
+			out = append(out, evalJSONPath(c, steps)...)
+		}
+	}
+
+	return out
+}
+
+// Select children of value matching the step.
+func jsonPathSelect(v interface{}, step jsonPathStep) []interface{} {
+	switch {
+	case step.wildcard:
+		return jsonPathChildren(v)
+
+	case step.isIndex:
+		rv := reflect.ValueOf(v)
+		if v == nil || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+			return nil
+		}
+
+		i := step.index
+		if i < 0 {
+			i += rv.Len()
+		}
+		if i < 0 || i >= rv.Len() {
+			return nil
+		}
+		return []interface{}{rv.Index(i).Interface()}
+	}
+
+	// Config keys are lower cased when parsed.
+	name := strings.ToLower(step.name)
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if c, ok := t[name]; ok {
+			return []interface{}{c}
+		}
+	case map[interface{}]interface{}:
+		for k, c := range t {
+			if fmt.Sprintf("%v", k) == name {
+				return []interface{}{c}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Get children of maps (in key order) and arrays.
+func jsonPathChildren(v interface{}) []interface{} {
+	var out []interface{}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			out = append(out, t[k])
+		}
+
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, c := range t {
+			m[fmt.Sprintf("%v", k)] = c
+		}
+		return jsonPathChildren(m)
+
+	default:
+		rv := reflect.ValueOf(v)
+		if v != nil && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) {
+			for i := 0; i < rv.Len(); i++ {
+				out = append(out, rv.Index(i).Interface())
+			}
+		}
+	}
+
+	return out
+}
+
+// Get prefix from the single scalar value matched by JSONPath expression in config map.
+func prefixFromJSONPath(m map[string]interface{}, steps []jsonPathStep, expr string) (string, error) {
+	matches := evalJSONPath(m, steps)
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("JSONPath %s didn't match any value", expr)
+	case 1:
+	default:
+		return "", fmt.Errorf("JSONPath %s matched %d values, should match exactly one", expr, len(matches))
+	}
+
+	// Only scalar values can be used as prefix.
+	switch v := matches[0].(type) {
+	case string, bool, int, int64, uint64, float64, json.Number:
+		return fmt.Sprintf("%v", v), nil
+	}
+
+	return "", fmt.Errorf("JSONPath %s should match a scalar value", expr)
+}
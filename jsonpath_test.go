@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrefixFromJSONPathFile(t *testing.T) {
+	fPath := writeTestFile(t, "service.yaml", `metadata:
+  name: billing
+  labels:
+    - name: team
+      value: payments
+spec:
+  port: 8080
+`)
+
+	pairs := testKVPairs(t, "--prefix", "services", "--prefix-from-json-path", "$.metadata.name", fPath)
+	if got := pairLines(t, pairs); !strings.HasPrefix(got, `services/billing/metadata/labels=`) || !strings.HasSuffix(got, "services/billing/spec/port=8080") {
+		t.Errorf("got\n%s", got)
+	}
+
+	// Both prefix options are joined, key first.
+	pairs = testKVPairs(t, "--prefix-from-key", "spec.port", "--prefix-from-json-path", "$.metadata.labels[0].value", fPath)
+	if len(pairs) == 0 || !strings.HasPrefix(pairs[0].Key, "8080/payments/") {
+		t.Errorf("pairs = %v, want keys under 8080/payments", pairs)
+	}
+
+	_, stderr, code := runCLI(t, "", "kv", "--prefix-from-json-path", "$..name", fPath)
+	if code == 0 || !strings.Contains(stderr, "JSONPath $..name matched 2 values, should match exactly one") {
+		t.Errorf("multiple matches: code = %d, stderr = %s", code, stderr)
+	}
+	_, stderr, code = runCLI(t, "", "kv", "--prefix-from-json-path", "metadata.name", fPath)
+	if code == 0 || !strings.Contains(stderr, "invalid prefix JSONPath metadata.name - JSONPath should start with $") {
+		t.Errorf("invalid expression: code = %d, stderr = %s", code, stderr)
+	}
+}
+
+func TestPrefixFromJSONPath(t *testing.T) {
+	m := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "billing", "labels": map[string]interface{}{"tier": "backend"}},
+		"replicas": []interface{}{"a", "b", "c"},
+		"spec":     map[string]interface{}{"name": "api"},
+	}
+
+	tests := []struct {
+		expr string
+		want string
+		err  string
+	}{
+		{"$.metadata.name", "billing", ""},
+		{"$['metadata'][\"labels\"].tier", "backend", ""},
+		{"$.Metadata.Name", "billing", ""},
+		{"$.replicas[-1]", "c", ""},
+		{"$.replicas[1]", "b", ""},
+		{"$.metadata.labels.*", "backend", ""},
+		{"$..tier", "backend", ""},
+		{"$..name", "", "matched 2 values"},
+		{"$.replicas[*]", "", "matched 3 values"},
+		{"$.replicas[3]", "", "didn't match any value"},
+		{"$.metadata.missing", "", "didn't match any value"},
+		{"$.metadata", "", "should match a scalar value"},
+	}
+
+	for _, tt := range tests {
+		steps, err := parseJSONPath(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+
+		got, err := prefixFromJSONPath(m, steps, tt.expr)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want %q", tt.expr, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: prefix = %q, error = %v, want %q", tt.expr, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseJSONPathErrors(t *testing.T) {
+	tests := map[string]string{
+		"$.a[?(@.b)]": "unsupported selector [?(@.b)]",
+		"$.a[0":       "unclosed [",
+		"$a":          `unexpected 'a'`,
+		"$.a..":       "empty member name",
+	}
+	for expr, want := range tests {
+		if _, err := parseJSONPath(expr); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error = %v, want %q", expr, err, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Resolve JSON references (`$ref`) in JSON configs.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Key of JSON reference objects.
+const jsonRefKey = "$ref"
+
+// Resolve same document `$ref` pointers in JSON config and return JSON with referenced values inlined.
+// Objects having a `$ref` are replaced by the referenced value and their other members are ignored.
+func resolveJSONRefs(b []byte) ([]byte, error) {
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	res, err := resolveJSONRefValue(doc, doc, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(res)
+}
+
+// Recursively resolve references in value. Refs being resolved are tracked to detect cycles.
+func resolveJSONRefValue(doc interface{}, v interface{}, resolving []string) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := t[jsonRefKey]; ok {
+			s, ok := ref.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s should be a string", jsonRefKey)
+			}
+
+			for _, r := range resolving {
+				if r == s {
+					return nil, fmt.Errorf("circular reference %s", strings.Join(append(resolving, s), " -> "))
+				}
+			}
+
+			target, err := jsonPointerValue(doc, s)
+			if err != nil {
+				return nil, err
+			}
+
+			return resolveJSONRefValue(doc, target, append(resolving, s))
+		}
+
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			r, err := resolveJSONRefValue(doc, val, resolving)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = r
+		}
+		return m, nil
+
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, val := range t {
+			r, err := resolveJSONRefValue(doc, val, resolving)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = r
+		}
+		return s, nil
+
+	default:
+		return v, nil
+	}
+}
+
+// Get value at same document reference. Ex: #/definitions/db
+func jsonPointerValue(doc interface{}, ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported reference %s, only same document references starting with # are supported", ref)
+	}
+
+	ptr, err := url.PathUnescape(strings.TrimPrefix(ref, "#"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference %s - %v", ref, err)
+	}
+
+	if ptr == "" {
+		return doc, nil
+	}
+
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("invalid reference %s, pointer should start with /", ref)
+	}
+
+	cur := doc
+	for _, tok := range strings.Split(ptr[1:], "/") {
+		tok = strings.Replace(strings.Replace(tok, "~1", "/", -1), "~0", "~", -1)
+
+		switch t := cur.(type) {
+		case map[string]interface{}:
+			v, ok := t[tok]
+			if !ok {
+				return nil, fmt.Errorf("reference %s not found", ref)
+			}
+			cur = v
+
+		case []interface{}:
+			i, err := strconv.Atoi(tok)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, fmt.Errorf("reference %s not found", ref)
+			}
+			cur = t[i]
+
+		default:
+			return nil, fmt.Errorf("reference %s not found", ref)
+		}
+	}
+
+	return cur, nil
+}
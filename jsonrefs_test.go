@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveJSONRefs(t *testing.T) {
+	config := writeTestFile(t, "config.json", `{
+  "definitions": {"db": {"host": "localhost", "port": 5432}, "hosts": ["a", "b"]},
+  "primary": {"$ref": "#/definitions/db", "ignored": true},
+  "replica": {"db": {"$ref": "#/primary"}},
+  "first_host": {"$ref": "#/definitions/hosts/0"}
+}`)
+
+	got := pairLines(t, testKVPairs(t, "--resolve-json-refs", config))
+	want := strings.Join([]string{
+		`definitions/db/host="localhost"`,
+		`definitions/db/port=5432`,
+		`definitions/hosts=["a","b"]`,
+		`first_host="a"`,
+		`primary/host="localhost"`,
+		`primary/port=5432`,
+		`replica/db/host="localhost"`,
+		`replica/db/port=5432`,
+	}, "\n")
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Without the flag $ref is an ordinary key.
+	if got := pairLines(t, testKVPairs(t, config)); !strings.Contains(got, `primary/$ref="#/definitions/db"`) {
+		t.Errorf("refs are resolved without --resolve-json-refs:\n%s", got)
+	}
+}
+
+func TestResolveJSONRefsErrors(t *testing.T) {
+	tests := []struct {
+		doc string
+		err string
+	}{
+		{`{"a": {"$ref": "#/b"}, "b": {"$ref": "#/a"}}`, "circular reference #/"},
+		{`{"a": {"$ref": "#/missing"}}`, "reference #/missing not found"},
+		{`{"a": {"$ref": "#/list/5"}, "list": [1]}`, "reference #/list/5 not found"},
+		{`{"a": {"$ref": "other.json#/b"}}`, "unsupported reference other.json#/b"},
+		{`{"a": {"$ref": "#b"}}`, "pointer should start with /"},
+		{`{"a": {"$ref": 1}}`, "$ref should be a string"},
+	}
+
+	for _, tt := range tests {
+		if _, err := resolveJSONRefs([]byte(tt.doc)); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error = %v, want %q", tt.doc, err, tt.err)
+		}
+	}
+
+	// Escaped pointer tokens.
+	b, err := resolveJSONRefs([]byte(`{"a/b": {"c~d": 1}, "x": {"$ref": "#/a~1b/c~0d"}}`))
+	if err != nil || !strings.Contains(string(b), `"x":1`) {
+		t.Errorf("escaped pointer = %s, %v", b, err)
+	}
+}
@@ -2,110 +2,1291 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
-	"io"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
 	"os"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/text/unicode/norm"
 )
 
 // Run KV commands.
 func runKVCmd(cmd *cobra.Command, args []string) {
-	// Check if input format is supported.
-	if !isValidInputFormat(kvInputType, kvAvailableFormats) {
-		errLog.Fatalf("Invalid input file format - %s. Available options are: %s", kvInputType, formatsToString(kvAvailableFormats))
+	// Check if output format is supported.
+	if !isValidInputFormat(kvOutputFormat, kvOutputFormats) {
+		errLog.Fatalf("Invalid output format - %s. Available options are: %s", kvOutputFormat, formatsToString(kvOutputFormats))
 	}
 
-	var inputs []io.Reader
+	// Diff is written as Consul transaction operations.
+	if kvBase != "" && kvOutputFormat != "json" {
+		errLog.Fatalf("Error: --base is supported only for json output format")
+	}
+
+	// Check SQL dialect and that table name is an identifier, since it's written to SQL as is.
+	if kvOutputFormat == "sql" {
+		if !isValidInputFormat(kvSQLDialect, kvSQLDialects) {
+			errLog.Fatalf("Invalid SQL dialect - %s. Available options are: %s", kvSQLDialect, formatsToString(kvSQLDialects))
+		}
+		if !sqlTableRe.MatchString(kvSQLTable) {
+			errLog.Fatalf("Error: invalid SQL table name %q, should be an identifier or schema.table", kvSQLTable)
+		}
+	}
+
+	// Check if diff format is supported.
+	if !isValidInputFormat(kvDiffFormat, kvDiffFormats) {
+		errLog.Fatalf("Invalid diff format - %s. Available options are: %s", kvDiffFormat, formatsToString(kvDiffFormats))
+	}
+	if kvBase == "" && cmd.Flags().Changed("diff-format") {
+		errLog.Fatalf("Error: --diff-format requires --base")
+	}
+
+	output := convertKVInputs(cmd, args)
+
+	// Overlay pairs on existing KV JSON.
+	if kvMergeInto != "" {
+		existing, err := readKVPairInputs([]string{kvMergeInto})
+		if err != nil {
+			errLog.Fatalf("Error: error reading merge into file - %v", err)
+		}
+
+		output = overlayKVPairs(existing, output)
+	}
+
+	// Convert base config with the same settings.
+	var base []consulKVPair
+	if kvBase != "" {
+		base = kvInputPairs(cmd, []string{kvBase})
+	}
+
+	// Check output and print collected warnings.
+	checkKVPairs(output)
+	if err := flushWarnings(); err != nil {
+		errLog.Fatalf("Error: %v", err)
+	}
+
+	// Print output in given format or only the diff from base config.
+	var (
+		out string
+		err error
+	)
+	if kvBase != "" {
+		out, err = kvDiffToString(kvDiffFormat, base, output, kvBase, diffInputsName(args))
+	} else {
+		out, err = kvPairsToString(kvOutputFormat, output)
+	}
+	if err != nil {
+		errLog.Fatalf("error marshelling output: %v", err)
+	}
+
+	if err := writeOutput(kvOutput, out); err != nil {
+		errLog.Fatalf("Error: error writing output - %v", err)
+	}
+}
+
+// Run check command. Inputs are converted same as KV command but output is discarded.
+func runCheckCmd(cmd *cobra.Command, args []string) {
+	output := convertKVInputs(cmd, args)
+
+	// Check output and print collected warnings.
+	checkKVPairs(output)
+	if err := flushWarnings(); err != nil {
+		errLog.Fatalf("Error: %v", err)
+	}
+}
+
+// Convert input files or stdin to KV pairs.
+func convertKVInputs(cmd *cobra.Command, args []string) []consulKVPair {
+	// Check if input format is supported. If not given it's detected from file extension.
+	if kvInputType != "" && !isValidInputFormat(kvInputType, inputFormats()) {
+		errLog.Fatalf("Invalid input file format - %s. Available options are: %s", kvInputType, formatsToString(inputFormats()))
+	}
+
+	// Load custom extension to format mapping.
+	if err := loadInputTypeMap(kvInputTypeMap); err != nil {
+		errLog.Fatalf("Error: invalid input type map - %v", err)
+	}
+
+	// Check if array mode is supported.
+	if !isValidInputFormat(kvArrayMode, kvArrayModes) {
+		errLog.Fatalf("Invalid array mode - %s. Available options are: %s", kvArrayMode, formatsToString(kvArrayModes))
+	}
+
+	// Parse template of record prefixes.
+	if kvRecordPrefixTemplate != "" {
+		tmpl, err := template.New("record-prefix").Option("missingkey=error").Parse(kvRecordPrefixTemplate)
+		if err != nil {
+			errLog.Fatalf("Error: invalid record prefix template - %v", err)
+		}
+
+		recordPrefixTmpl = tmpl
+	}
+
+	// Parse JSONPath of prefix.
+	if kvPrefixFromJSONPath != "" {
+		steps, err := parseJSONPath(kvPrefixFromJSONPath)
+		if err != nil {
+			errLog.Fatalf("Error: invalid prefix JSONPath %s - %v", kvPrefixFromJSONPath, err)
+		}
+
+		prefixJSONPathSteps = steps
+	}
+
+	if kvIndexPadding < 0 {
+		errLog.Fatalf("Invalid index padding - %d. Should be 0 or more", kvIndexPadding)
+	}
+
+	// Check if merge strategy is supported.
+	if !isValidInputFormat(kvMergeStrategy, kvMergeStrategies) {
+		errLog.Fatalf("Invalid merge strategy - %s. Available options are: %s", kvMergeStrategy, formatsToString(kvMergeStrategies))
+	}
+
+	// Check if short keys mode is supported.
+	if !isValidInputFormat(kvDropPrefixShortKeys, kvDropPrefixShortKeysModes) {
+		errLog.Fatalf("Invalid drop prefix short keys mode - %s. Available options are: %s", kvDropPrefixShortKeys, formatsToString(kvDropPrefixShortKeysModes))
+	}
+
+	// Check if delimiter escape mode is supported.
+	if kvDelimiterEscape != "" && !isValidInputFormat(kvDelimiterEscape, kvDelimiterEscapes) {
+		errLog.Fatalf("Invalid delimiter escape - %s. Available options are: %s", kvDelimiterEscape, formatsToString(kvDelimiterEscapes))
+	}
+
+	// Check if key normalization form is supported.
+	if kvKeyNormalization != "" && !isValidInputFormat(kvKeyNormalization, kvKeyNormalizations) {
+		errLog.Fatalf("Invalid key normalization - %s. Available options are: %s", kvKeyNormalization, formatsToString(kvKeyNormalizations))
+	}
+
+	// Check if excluded value kinds are supported.
+	for _, t := range kvExcludeTypes {
+		if !isValidInputFormat(t, kvExcludeTypeKinds) {
+			errLog.Fatalf("Invalid exclude type - %s. Available options are: %s", t, formatsToString(kvExcludeTypeKinds))
+		}
+	}
+
+	// Check if Consul path style is supported.
+	if kvConsulPathStyle != "" && !isValidInputFormat(kvConsulPathStyle, kvConsulPathStyles) {
+		errLog.Fatalf("Invalid consul path style - %s. Available options are: %s", kvConsulPathStyle, formatsToString(kvConsulPathStyles))
+	}
+
+	// Load keys to skip.
+	if kvSkipKeysFile != "" {
+		if err := loadSkipKeysFile(kvSkipKeysFile, kvDelimiter); err != nil {
+			errLog.Fatalf("Error: error reading skip keys file - %v", err)
+		}
+	}
+
+	// Compile regex of keys to skip.
+	if kvIgnoreKeysRegex != "" {
+		re, err := regexp.Compile(kvIgnoreKeysRegex)
+		if err != nil {
+			errLog.Fatalf("Error: invalid ignore keys regex - %v", err)
+		}
+
+		ignoreKeysRe = re
+	}
+
+	// Compile keys ignored for secret detection.
+	for _, g := range kvDetectSecretsIgnore {
+		re, err := compileKeyGlob(g, kvDelimiter)
+		if err != nil {
+			errLog.Fatalf("Error: invalid secret ignore pattern %s - %v", g, err)
+		}
+
+		secretIgnorePatterns = append(secretIgnorePatterns, re)
+	}
+
+	// Compile keys whose values are moved to Vault.
+	if len(kvExternalizeSecrets) > 0 && kvSecretsFile == "" {
+		errLog.Fatalf("Error: --secrets-file is required with --externalize-secrets")
+	}
+	for _, g := range kvExternalizeSecrets {
+		re, err := compileKeyGlob(g, kvDelimiter)
+		if err != nil {
+			errLog.Fatalf("Error: invalid externalize secrets pattern %s - %v", g, err)
+		}
+
+		externalizePatterns = append(externalizePatterns, re)
+	}
+
+	// Load value transforms.
+	if kvTransformValuesFile != "" {
+		if err := loadTransformValuesFile(kvTransformValuesFile, kvDelimiter); err != nil {
+			errLog.Fatalf("Error: error reading transform values file - %v", err)
+		}
+	}
+
+	// Compile flags patterns.
+	if err := compileFlagsPatterns(kvFlagsFromKeyPattern, kvDelimiter); err != nil {
+		errLog.Fatalf("Error: invalid flags from key pattern - %v", err)
+	}
+
+	// Compile flags encoder if given.
+	if err := compileFlagsEncoder(kvFlagsEncoder); err != nil {
+		errLog.Fatalf("Error: invalid flags encoder - %v", err)
+	}
+
+	output := kvInputPairs(cmd, args)
+
+	warnUnmatchedSkipKeys()
+
+	if err := validateKVPairs(output); err != nil {
+		errLog.Fatalf("Error: %v", err)
+	}
+
+	if kvSecretsFile != "" {
+		if err := writeSecretsFile(kvSecretsFile); err != nil {
+			errLog.Fatalf("Error: error writing secrets file - %v", err)
+		}
+	}
+
+	if kvEmitTypeMap != "" {
+		if err := writeTypeMapFile(kvEmitTypeMap); err != nil {
+			errLog.Fatalf("Error: error writing type map - %v", err)
+		}
+	}
+
+	if kvKeyDepthHistogram && !quiet {
+		printKeyDepthHistogram(output, kvDelimiter)
+	}
+
+	if kvEmitValueLengths && !quiet {
+		printValueLengths(output)
+	}
+
+	return output
+}
+
+// Set once stdin is read with `--combine-with-stdin`.
+var stdinCombined bool
+
+// Distinct prefixes of inputs of last conversion, after settings, prefix options and section prefixes
+// are applied. Import uses them to find keys of the inputs in Consul.
+var inputPrefixes []string
+
+// Convert input files or stdin to KV pairs without validating them.
+func kvInputPairs(cmd *cobra.Command, args []string) []consulKVPair {
+	var inputs []configInput
 	var output []consulKVPair
 
+	// Settings of distinct input prefixes which get a marker key if no keys are under them.
+	var markers []kvSettings
+	markerPrefixes := make(map[string]bool)
+
+	inputPrefixes = nil
+	seenPrefixes := make(map[string]bool)
+
+	// Arrays are merged only across inputs of this conversion.
+	mergedArrays = make(map[string][]interface{})
+
+	// Errors of an input are reported and remaining inputs are converted unless fail fast is set.
+	failed := 0
+	inputFailed := func(format string, args ...interface{}) {
+		if kvFailFast {
+			errLog.Fatalf(format, args...)
+		}
+
+		errLog.Printf(format, args...)
+		failed++
+	}
+
 	// Add stdin as default input if files are not provided else add given input files.
 	if len(args) == 0 {
-		inputs = append(inputs, os.Stdin)
+		sections, err := splitSections("stdin", os.Stdin, kvInputType)
+		if err != nil {
+			errLog.Fatalf("Error: error reading stdin - %v", err)
+		}
+
+		// Format type is required for stdin without section markers.
+		if len(sections) == 1 && sections[0].cType == "" {
+			errLog.Fatalf("Error: input format type is required for stdin")
+		}
+
+		inputs = append(inputs, sections...)
 	} else {
 		// Add all files as inputs
 		for _, fname := range args {
-			f, err := os.Open(fname)
+			// Every member of tar archive is a separate input.
+			if isTarArchive(fname) {
+				f, err := openInput(fname)
+				if err != nil {
+					inputFailed("Error: error opening input file - %v", err)
+					continue
+				}
+
+				members, err := tarArchiveInputs(fname, f, kvDelimiter)
+				if err != nil {
+					inputFailed("Error: error reading archive %s - %v", fname, err)
+					continue
+				}
+
+				inputs = append(inputs, members...)
+				continue
+			}
+
+			cType, err := inputType(fname, kvInputType)
+			if err != nil {
+				inputFailed("Error: %v", err)
+				continue
+			}
+
+			f, err := openInput(fname)
 			if err != nil {
-				errLog.Fatalf("Error: error opening input file - %v", err)
+				inputFailed("Error: error opening input file - %v", err)
+				continue
 			}
 
-			inputs = append(inputs, f)
+			inputs = append(inputs, configInput{name: fname, cType: cType, r: f})
+		}
+	}
+	cleanupInputs()
+
+	// Read stdin after files so that its pairs override pairs of files. Stdin is read only once,
+	// so base config of diff doesn't include it.
+	fileInputs := len(inputs)
+	if len(args) > 0 && kvCombineWithStdin && !stdinCombined {
+		stdinCombined = true
+
+		cType := kvStdinType
+		if cType == "" {
+			cType = kvInputType
+		}
+
+		sections, err := splitSections("stdin", os.Stdin, cType)
+		if err != nil {
+			errLog.Fatalf("Error: error reading stdin - %v", err)
+		}
+
+		if len(sections) == 1 && sections[0].cType == "" {
+			errLog.Fatalf("Error: input format type is required for stdin, use --stdin-type or --type")
 		}
+
+		inputs = append(inputs, sections...)
 	}
 
-	for _, i := range inputs {
-		// Process toml inputs
-		m, err := configToMap(kvInputType, i)
+	// Hash content of all inputs.
+	var contentHash string
+	if kvPrefixFromContentHash {
+		h, err := inputsContentHash(inputs)
 		if err != nil {
-			errLog.Fatalf("Error: error parsing input - %v", err)
+			errLog.Fatalf("Error: error hashing inputs - %v", err)
+		}
+
+		contentHash = h
+	}
+
+	stdinStart := -1
+	for i, pi := range parseKVInputs(inputs, kvParallel) {
+		in, m := pi.input, pi.m
+		if i == fileInputs && stdinStart < 0 {
+			stdinStart = len(output)
+		}
+
+		var err error
+
+		if pi.err != nil {
+			inputFailed("Error: %v", pi.err)
+			continue
+		}
+
+		// Namespace records by prefix rendered from their fields.
+		if recordPrefixTmpl != nil && isRecordFormat(in.cType) {
+			if m, err = prefixRecords(m, recordPrefixTmpl, kvDelimiter); err != nil {
+				inputFailed("Error: error getting record prefix in %s - %v", in.name, err)
+				continue
+			}
+		}
+
+		// Select values of target environment.
+		if kvEnv != "" {
+			selectEnv(m, kvEnv, kvEnvSections)
+		}
+
+		// Get conversion settings for the input.
+		settings, err := inputSettings(cmd, m)
+		if err != nil {
+			inputFailed("Error: invalid %s table in %s - %v", reservedSettingsKey, in.name, err)
+			continue
+		}
+
+		settings.order = pi.order
+
+		// Join hostname of the machine.
+		if kvPrefixFromHostname {
+			h, err := hostnamePrefix(settings.delimiter)
+			if err != nil {
+				errLog.Fatalf("Error: error getting prefix from hostname - %v", err)
+			}
+
+			settings.prefix = joinKey(settings.prefix, h, settings.delimiter)
+		}
+
+		// Join content hash of inputs.
+		if contentHash != "" {
+			settings.prefix = joinKey(settings.prefix, contentHash, settings.delimiter)
+		}
+
+		// Join prefix read from config.
+		if kvPrefixFromKey != "" {
+			p, err := prefixFromKey(m, kvPrefixFromKey, kvPrefixFromKeyRemove)
+			if err != nil {
+				inputFailed("Error: error getting prefix from %s - %v", in.name, err)
+				continue
+			}
+
+			settings.prefix = joinKey(settings.prefix, p, settings.delimiter)
+		}
+
+		// Join prefix selected by JSONPath.
+		if kvPrefixFromJSONPath != "" {
+			p, err := prefixFromJSONPath(m, prefixJSONPathSteps, kvPrefixFromJSONPath)
+			if err != nil {
+				inputFailed("Error: error getting prefix from %s - %v", in.name, err)
+				continue
+			}
+
+			settings.prefix = joinKey(settings.prefix, p, settings.delimiter)
+		}
+
+		// Join section prefix.
+		if in.prefix != "" {
+			settings.prefix = joinKey(settings.prefix, in.prefix, settings.delimiter)
+		}
+
+		if p := trimDelimiter(settings.prefix, settings.delimiter); !seenPrefixes[p] {
+			seenPrefixes[p] = true
+			inputPrefixes = append(inputPrefixes, p)
+		}
+
+		if kvEnsurePrefixKey && !markerPrefixes[settings.prefix] {
+			markerPrefixes[settings.prefix] = true
+			markers = append(markers, kvSettings{prefix: settings.prefix, delimiter: settings.delimiter, flags: settings.flags})
 		}
 
+		// Concatenate arrays with arrays of the same key in earlier inputs.
+		if kvMergeStrategy == "concat-arrays" {
+			concatArrays(settings.prefix, m, settings.delimiter)
+		}
+
+		// Add comments as doc keys.
+		addDocKeys(m, pi.docs)
+
 		// Recursively parse map and add KV pairs
-		mapToKVPairs(&output, kvKeyPrefix, m)
+		mapToKVPairs(&output, settings.prefix, m, settings)
+	}
+
+	if failed > 0 {
+		errLog.Fatalf("Error: %d input(s) failed", failed)
+	}
+
+	// Overlay pairs of stdin on pairs of files.
+	if stdinStart >= 0 {
+		output = overlayKVPairs(output[:stdinStart], output[stdinStart:])
+	}
+
+	// Write a marker key at prefixes with no keys under them.
+	if kvEnsurePrefixKey {
+		ensurePrefixKeys(&output, markers)
+	}
+
+	return output
+}
+
+// Parsed config input.
+type parsedInput struct {
+	input configInput
+	m     map[string]interface{}
+	// Comments above keys of TOML input.
+	docs map[string]string
+	// Document order of keys of JSON input.
+	order *keyOrder
+	// Error reading or parsing the input.
+	err error
+}
+
+// Parse inputs using given number of workers. Results are in the same order as inputs
+// irrespective of which worker finishes first, so output is deterministic.
+func parseKVInputs(inputs []configInput, workers int) []parsedInput {
+	results := make([]parsedInput, len(inputs))
+	if workers <= 1 {
+		for i, in := range inputs {
+			// Rest of the inputs are not parsed since conversion stops at the error.
+			if results[i] = parseKVInput(in); results[i].err != nil && kvFailFast {
+				break
+			}
+		}
+
+		return results
+	}
+
+	var (
+		wg   sync.WaitGroup
+		jobs = make(chan int)
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = parseKVInput(inputs[i])
+			}
+		}()
+	}
+
+	for i := range inputs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// Parse input to config map. Input is pre processed to read comments, key order and resolve references if enabled.
+// Errors are returned in result so that errors of all inputs can be reported.
+func parseKVInput(in configInput) parsedInput {
+	i := in.r
+
+	// Read comments above keys from TOML input.
+	var docs map[string]string
+	if kvPreserveComments {
+		// Comments are supported only for TOML.
+		if in.cType != "toml" {
+			return parsedInput{input: in, err: fmt.Errorf("--preserve-comments-as-metadata is supported only for toml inputs - %s", in.name)}
+		}
+
+		b, err := ioutil.ReadAll(i)
+		if err != nil {
+			return parsedInput{input: in, err: fmt.Errorf("error reading input %s - %v", in.name, err)}
+		}
+
+		docs = tomlKeyComments(b)
+		i = bytes.NewReader(b)
+	}
+
+	// Read document order of keys from JSON input.
+	var order *keyOrder
+	if kvPreserveJSONKeyOrder && in.cType == "json" {
+		b, err := ioutil.ReadAll(i)
+		if err != nil {
+			return parsedInput{input: in, err: fmt.Errorf("error reading input %s - %v", in.name, err)}
+		}
+
+		if order, err = jsonKeyOrder(b); err != nil {
+			return parsedInput{input: in, err: fmt.Errorf("error parsing input %s - %v", in.name, err)}
+		}
+		i = bytes.NewReader(b)
+	}
+
+	// Inline same document references in JSON input.
+	if kvResolveJSONRefs && in.cType == "json" {
+		b, err := ioutil.ReadAll(i)
+		if err != nil {
+			return parsedInput{input: in, err: fmt.Errorf("error reading input %s - %v", in.name, err)}
+		}
+
+		if b, err = resolveJSONRefs(b); err != nil {
+			return parsedInput{input: in, err: fmt.Errorf("error resolving JSON references in %s - %v", in.name, err)}
+		}
+		i = bytes.NewReader(b)
 	}
 
-	// Print JSON output
-	bytes, err := json.MarshalIndent(output, "", "  ")
+	// Process inputs. Null values are kept so that they can be deleted on import.
+	m, err := parseConfig(in.cType, i, importMapNullToDelete)
 	if err != nil {
-		errLog.Fatalf("error marshelling output: %v", err)
+		return parsedInput{input: in, err: fmt.Errorf("error parsing input %s - %v", in.name, err)}
 	}
 
-	sysLog.Println(string(bytes[:]))
+	return parsedInput{input: in, m: m, docs: docs, order: order}
 }
 
 // Recursively traverse map and insert KV Pair to output if it can't be further traversed.
-func mapToKVPairs(ckv *[]consulKVPair, prefix string, inp map[string]interface{}) {
-	for k, v := range inp {
+func mapToKVPairs(ckv *[]consulKVPair, prefix string, inp map[string]interface{}, s kvSettings) {
+	keys := orderedKeys(inp, s.order)
+
+	// Write names of children as index of the node.
+	if kvEmitParentsAsIndex && prefix != "" && len(keys) > 0 {
+		index := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			index = append(index, escapeKeySegment(k, s.delimiter))
+		}
+		is := s
+		is.sidecar = true
+		appendKVPair(ckv, prefix, index, is)
+	}
+
+	for _, k := range keys {
 		var newPrefix string
 
-		// If prefix is empty then don't append "/" else form a new prefix with current key.
+		// If prefix is empty then don't append delimiter else form a new prefix with current key.
+		seg := escapeKeySegment(k, s.delimiter)
 		if prefix == "" {
-			newPrefix = k
+			newPrefix = seg
 		} else {
-			newPrefix = prefix + "/" + k
+			newPrefix = prefix + s.delimiter + seg
+		}
+
+		cs := s
+		cs.order = s.order.child(k)
+		// Comments are written as doc keys on purpose.
+		if kvPreserveComments && strings.HasSuffix(k, docKeySuffix) {
+			cs.sidecar = true
+		}
+		valueToKVPairs(ckv, newPrefix, inp[k], cs)
+	}
+}
+
+// Insert KV pairs for the value under given key. Maps and arrays (in indexed array mode) are traversed further.
+func valueToKVPairs(ckv *[]consulKVPair, key string, v interface{}, s kvSettings) {
+	// Values of excluded kinds aren't written.
+	if len(kvExcludeTypes) > 0 && isExcludedKind(v) {
+		return
+	}
+
+	switch t := v.(type) {
+	// Scalars and nil (written as null) are written as is. Time is written as RFC 3339 string.
+	case nil, string, bool, time.Time,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		appendKVPair(ckv, key, v, s)
+
+	// Arbitrary precision numbers (ex: JSON numbers and from custom parsers) are formatted exactly, see coerceNumbers.
+	case json.Number, *big.Int, *big.Float:
+		appendKVPair(ckv, key, v, s)
+
+	case map[string]interface{}:
+		mapToKVPairs(ckv, key, t, s)
+
+	// Maps with non string keys (ex: nested YAML maps) are traversed with keys formatted as strings.
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprintf("%v", k)] = val
+		}
+		mapToKVPairs(ckv, key, m, s)
+
+	case []interface{}:
+		arrayToKVPairs(ckv, key, reflect.ValueOf(t), s)
+
+	// Typed slices and arrays (ex: []map[string]interface{} from HCL) are traversed as arrays,
+	// other maps are not supported and any other value is written as is.
+	default:
+		switch reflect.TypeOf(v).Kind() {
+		case reflect.Slice, reflect.Array:
+			arrayToKVPairs(ckv, key, reflect.ValueOf(v), s)
+		case reflect.Map:
+			errLog.Fatalf("Error: unsupported map type %T at key %s", v, key)
+		default:
+			appendKVPair(ckv, key, v, s)
+		}
+	}
+}
+
+// Insert KV pairs for array based on array mode.
+func arrayToKVPairs(ckv *[]consulKVPair, key string, arr reflect.Value, s kvSettings) {
+	// Empty arrays are always written as `[]` in json mode but skipped in indexed mode unless asked to preserve.
+	if arr.Len() == 0 {
+		if kvArrayMode == "json" && kvNoJSONArrayFallback {
+			errLog.Fatalf("Error: array at key %s would be JSON encoded, use an array mode other than json or remove --no-json-array-fallback", key)
+		}
+
+		if kvArrayMode == "json" || kvPreserveEmptyArrays {
+			appendKVPair(ckv, key, []interface{}{}, s)
 		}
 
-		// Check if value is a map. If map then traverse further else write to output as a KVPair.
-		vKind := reflect.TypeOf(v).Kind()
-		if vKind == reflect.Map {
-			// Check if map value is of interface type and keys are string.
-			m, ok := v.(map[string]interface{})
-			if !ok {
-				errLog.Fatalf("not ok: %v - %v\n", k, v)
+		return
+	}
+
+	// Array of maps are written under value of identifier field of every item. Ex: servers/web/host
+	if kvFlattenArraysWithKeys && isArrayOfMaps(arr) {
+		keyedArrayToKVPairs(ckv, key, arr, s)
+		return
+	}
+
+	// CAVEAT: TOML supports array of maps but consul KV doesn't support this so it will be JSON marshalled in json mode.
+	if kvArrayMode == "json" {
+		if kvNoJSONArrayFallback {
+			errLog.Fatalf("Error: array at key %s would be JSON encoded, use an array mode other than json or remove --no-json-array-fallback", key)
+		}
+
+		for i := 0; i < arr.Len(); i++ {
+			if item := arr.Index(i).Interface(); item != nil && reflect.TypeOf(item).Kind() == reflect.Map {
+				addWarning(warnArrayBlob, "array of maps at key %s is encoded as a single JSON value", key)
+				break
 			}
+		}
 
-			// Recursion.
-			mapToKVPairs(ckv, newPrefix, m)
-		} else {
-			// If its not  string then encode it using JSON
-			// CAVEAT: TOML supports array of maps but consul KV doesn't support this so it will be JSON marshalled.
+		appendKVPair(ckv, key, arr.Interface(), s)
+		return
+	}
+
+	// Indexed mode, every item is written under its index. Ex: servers/0/host
+	if kvEmitParentsAsIndex {
+		index := make([]interface{}, 0, arr.Len())
+		for i := 0; i < arr.Len(); i++ {
+			index = append(index, indexSegment(i))
+		}
+		is := s
+		is.sidecar = true
+		appendKVPair(ckv, key, index, is)
+	}
+
+	for i := 0; i < arr.Len(); i++ {
+		cs := s
+		cs.order = s.order.item(i)
+		valueToKVPairs(ckv, key+s.delimiter+indexSegment(i), arr.Index(i).Interface(), cs)
+	}
+}
+
+// Get key segment of array index with index prefix and zero padding. Ex: item-007
+func indexSegment(i int) string {
+	return kvIndexPrefix + fmt.Sprintf("%0*d", kvIndexPadding, i)
+}
+
+// Check if all items of the array are string keyed maps.
+func isArrayOfMaps(arr reflect.Value) bool {
+	for i := 0; i < arr.Len(); i++ {
+		if _, ok := arr.Index(i).Interface().(map[string]interface{}); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Insert KV pairs for array of maps using value of array key field as path segment of every item.
+func keyedArrayToKVPairs(ckv *[]consulKVPair, key string, arr reflect.Value, s kvSettings) {
+	seen := make(map[string]bool)
+	segs := make([]string, arr.Len())
+	for i := 0; i < arr.Len(); i++ {
+		m := arr.Index(i).Interface().(map[string]interface{})
+		id, ok := m[kvArrayKeyField]
+		if !ok {
+			errLog.Fatalf("Error: item %d of array %s doesn't have key field %s", i, key, kvArrayKeyField)
+		}
+
+		// Only scalar values can be used as identifier.
+		var seg string
+		switch id.(type) {
+		case string, bool, int, int64, uint64, float64, json.Number:
+			seg = fmt.Sprintf("%v", id)
+		default:
+			errLog.Fatalf("Error: key field %s of item %d of array %s should be a scalar value", kvArrayKeyField, i, key)
+		}
+
+		if seen[seg] {
+			errLog.Fatalf("Error: duplicate value %s for key field %s in array %s", seg, kvArrayKeyField, key)
+		}
+		seen[seg] = true
+		segs[i] = escapeKeySegment(seg, s.delimiter)
+	}
+
+	// Write identifiers of items as index of the array.
+	if kvEmitParentsAsIndex {
+		index := make([]interface{}, 0, len(segs))
+		for _, seg := range segs {
+			index = append(index, seg)
+		}
+		is := s
+		is.sidecar = true
+		appendKVPair(ckv, key, index, is)
+	}
+
+	for i, seg := range segs {
+		cs := s
+		cs.order = s.order.item(i)
+		mapToKVPairs(ckv, key+s.delimiter+seg, arr.Index(i).Interface().(map[string]interface{}), cs)
+	}
+}
+
+// Encode value and append it to output as a KV pair.
+func appendKVPair(ckv *[]consulKVPair, key string, v interface{}, s kvSettings) {
+	// Drop leading levels of the key.
+	if kvDropPrefixLevels > 0 {
+		segs := splitKey(key, s.delimiter)
+		if len(segs) <= kvDropPrefixLevels {
+			if kvDropPrefixShortKeys == "skip" {
+				return
+			}
+			errLog.Fatalf("Error: key %s has %d level(s), can't drop %d", key, len(segs), kvDropPrefixLevels)
+		}
+
+		for i, seg := range segs {
+			segs[i] = escapeKeySegment(seg, s.delimiter)
+		}
+		key = strings.Join(segs[kvDropPrefixLevels:], s.delimiter)
+	}
+
+	// Append suffix to the key with leading and trailing delimiters of suffix trimmed.
+	if sfx := trimDelimiter(kvKeySuffix, s.delimiter); sfx != "" {
+		key = key + s.delimiter + sfx
+	}
+
+	// Normalize unicode form of the key so that visually identical keys have the same bytes.
+	switch kvKeyNormalization {
+	case "nfc":
+		key = norm.NFC.String(key)
+	case "nfd":
+		key = norm.NFD.String(key)
+	}
+
+	// Leading slashes are stripped in modern path style.
+	if kvConsulPathStyle == "modern" {
+		if key = strings.TrimLeft(key, "/"); key == "" {
+			errLog.Fatalf("Error: key is empty after stripping leading slashes for modern consul path style")
+		}
+	}
+
+	if skipKey(key) {
+		return
+	}
+
+	// Kind of the value in the config for type suffix and type map.
+	kind := valueKind(v)
+
+	// Remove surrounding quotes added by upstream tooling.
+	if kvStripQuotes {
+		v = stripQuotes(v)
+	}
+
+	// Consul template values are written verbatim unless asked to escape them.
+	tmpl := !kvEscapeTemplates && isTemplateValue(v)
+
+	// Rewrite value with matching transform.
+	if len(valueTransforms) > 0 && !tmpl {
+		t, err := transformValue(key, v)
+		if err != nil {
+			errLog.Fatalf("error transforming value of key: %v err: %v", key, err)
+		}
+
+		v = t
+	}
+
+	// Wrap value with fixed prefix and suffix.
+	if (kvValuePrefix != "" || kvValueSuffix != "") && !tmpl {
+		w, err := wrapValue(v)
+		if err != nil {
+			errLog.Fatalf("error wrapping value of key: %v err: %v", key, err)
+		}
+
+		v = w
+	}
+
+	// Write whole number floats as integers unless float notation is kept.
+	v = coerceNumbers(v)
+
+	// Move secret value to Vault and reference it from the template.
+	sidecar := s.sidecar
+	if ref, ok := externalizeSecret(key, v, s.delimiter); ok {
+		v = ref
+		tmpl = true
+		sidecar = true
+	}
+
+	// Append type of the value to the key. Ex: port:int
+	if kvTypeSuffixKeys && kind != "" {
+		key = key + typeSuffixSeparator + kind
+	}
+
+	// Replace value with placeholder of its type.
+	if kvRedactValues {
+		v = redactedValue(kind)
+		tmpl = false
+	}
+
+	// Canonicalize arrays and maps so that semantically equal values have same JSON encoding.
+	if kvCanonicalizeJSON {
+		if k := reflect.TypeOf(v); k != nil && (k.Kind() == reflect.Slice || k.Kind() == reflect.Array || k.Kind() == reflect.Map) {
+			c, err := canonicalJSONValue(v)
+			if err != nil {
+				errLog.Fatalf("error canonicalizing value of key: %v err: %v", key, err)
+			}
+
+			v = c
+		}
+	}
+
+	// JSON encode value to preserve the type. Common scalars are encoded directly since creating an
+	// encoder per value dominates conversion time of large configs.
+	trimmed, ok := scalarJSON(v)
+	if !ok {
+		// Custom JSON marshaller with safe escaped html is disabled. Since default JSON marshaller escapes &, > and <.
+		val := bytes.NewBufferString("")
+		jEncoder := json.NewEncoder(val)
+		jEncoder.SetEscapeHTML(false)
+
+		// Numbers are formatted by strconv which doesn't depend on host locale, so decimal separator
+		// is always `.` and digits are never grouped. Ex: 1.5 and 1000000, never 1,5 or 1.000.000
+		if err := jEncoder.Encode(v); err != nil {
+			errLog.Fatalf("error while marshalling value: %v err: %v", v, err)
+		}
+
+		// Trim new lines if any at the end
+		trimmed = strings.TrimSuffix(val.String(), "\n")
+	}
+	if tmpl {
+		trimmed = v.(string)
+	}
+
+	// Base64 encode JSON encoded values since Consul reads only base64 encoded values.
+	b64Encoded := base64.StdEncoding.EncodeToString([]byte(trimmed))
+
+	// Compute flags for the pair.
+	flags, err := keyFlags(key, trimmed, s)
+	if err != nil {
+		errLog.Fatalf("error computing flags for key: %v err: %v", key, err)
+	}
+
+	// Append KV pair to results.
+	*ckv = append(*ckv, consulKVPair{
+		Flags: flags,
+		Key:   key,
+		Value: b64Encoded,
+	})
+	logEmittedPair(key, len(trimmed), flags)
+	if sidecar {
+		sidecarKeys[key] = true
+	}
+
+	if kvEmitTypeMap != "" {
+		typeMap[key] = kind
+	}
+
+	// Append checksum of the value as a sidecar pair.
+	if kvWithChecksum {
+		sum := `"` + valueChecksum(trimmed) + `"`
+		*ckv = append(*ckv, consulKVPair{
+			Flags: flags,
+			Key:   key + checksumKeySuffix,
+			Value: base64.StdEncoding.EncodeToString([]byte(sum)),
+		})
+		logEmittedPair(key+checksumKeySuffix, len(sum), flags)
+		sidecarKeys[key+checksumKeySuffix] = true
+	}
+}
+
+// Wrap string value with value prefix and suffix. Other values are wrapped as their JSON
+// encoding if wrap all is set, else returned as is.
+func wrapValue(v interface{}) (interface{}, error) {
+	str, ok := v.(string)
+	if !ok {
+		if !kvWrapAll {
+			return v, nil
+		}
+
+		b, err := json.Marshal(stringKeyedValue(v))
+		if err != nil {
+			return nil, err
+		}
+		str = string(b)
+	}
+
+	return kvValuePrefix + str + kvValueSuffix, nil
+}
+
+// Remove a single layer of matching single or double quotes around string value.
+func stripQuotes(v interface{}) interface{} {
+	str, ok := v.(string)
+	if !ok || len(str) < 2 {
+		return v
+	}
+
+	if q := str[0]; (q == '"' || q == '\'') && str[len(str)-1] == q {
+		return str[1 : len(str)-1]
+	}
 
-			// Custom JSON marshaller with safe escaped html is disabled. Since default JSON marshaller escapes &, > and <.
-			val := bytes.NewBufferString("")
-			jEncoder := json.NewEncoder(val)
-			jEncoder.SetEscapeHTML(false)
+	return v
+}
+
+// Separator of key and type suffix.
+const typeSuffixSeparator = ":"
+
+// Check if value is a string which looks like a consul-template template, i.e. has `{{` followed by `}}`.
+func isTemplateValue(v interface{}) bool {
+	str, ok := v.(string)
+	if !ok {
+		return false
+	}
 
-			// JSON encode value to preserve the type.
-			if err := jEncoder.Encode(v); err != nil {
-				errLog.Fatalf("error while marshalling value: %v err: %v", v, err)
+	i := strings.Index(str, "{{")
+	return i != -1 && strings.Contains(str[i+2:], "}}")
+}
+
+// Get placeholder for value of kind. Ex: <string>, <int>
+func redactedValue(k string) string {
+	if k == "" {
+		k = "redacted"
+	}
+
+	return "<" + k + ">"
+}
+
+// Encode bools, integers and strings of printable ASCII characters other than `"` and `\` as JSON,
+// same as the JSON encoder does. Returns false for other values which need the encoder.
+func scalarJSON(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case bool:
+		return strconv.FormatBool(t), true
+	case int:
+		return strconv.Itoa(t), true
+	case int64:
+		return strconv.FormatInt(t, 10), true
+	case string:
+		for i := 0; i < len(t); i++ {
+			if c := t[i]; c < 0x20 || c > 0x7e || c == '"' || c == '\\' {
+				return "", false
 			}
+		}
+		return `"` + t + `"`, true
+	}
+
+	return "", false
+}
+
+// Get kind name of value. Ex: string, int, array. Empty for values of unknown kind.
+func valueKind(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "datetime"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "int"
+	case float32, float64, *big.Float:
+		return "float"
+	case *big.Int:
+		return "int"
+	case json.Number:
+		if strings.ContainsAny(string(t), ".eE") {
+			return "float"
+		}
+		return "int"
+	}
+
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map:
+		return "map"
+	}
+
+	return ""
+}
+
+// Check if value is of an excluded kind. `number` excludes both int and float.
+func isExcludedKind(v interface{}) bool {
+	k := valueKind(v)
+	for _, e := range kvExcludeTypes {
+		if e == k || (e == "number" && (k == "int" || k == "float")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Recursively coerce whole number floats to integers, ex: 3.0 => 3. If float notation is kept
+// whole number floats are written with a decimal point instead, ex: 3 => 3.0.
+func coerceNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case float32:
+		return coerceFloat(float64(t), v)
+
+	case float64:
+		return coerceFloat(t, v)
+
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil || !strings.ContainsAny(string(t), ".eE") {
+			return t
+		}
+		return coerceFloat(f, v)
+
+	case *big.Int:
+		if t == nil {
+			return nil
+		}
+		return json.Number(t.String())
+
+	case *big.Float:
+		return coerceBigFloat(t)
+
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, val := range t {
+			s[i] = coerceNumbers(val)
+		}
+		return s
+
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[k] = coerceNumbers(val)
+		}
+		return m
+	}
+
+	return v
+}
+
+// Coerce float to integer if it's a whole number in int64 range. Other floats are returned as is.
+func coerceFloat(f float64, v interface{}) interface{} {
+	whole := f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64
+	if !whole {
+		return v
+	}
+
+	if kvKeepFloatNotation {
+		return json.Number(strconv.FormatFloat(f, 'f', -1, 64) + ".0")
+	}
+
+	return int64(f)
+}
+
+// Format arbitrary precision float exactly as JSON number without going through float64. Whole numbers
+// are written as integers unless float notation is kept. Infinities are not valid JSON numbers and fail to encode.
+func coerceBigFloat(f *big.Float) interface{} {
+	if f == nil {
+		return nil
+	}
+
+	if f.IsInt() {
+		if kvKeepFloatNotation {
+			return json.Number(f.Text('f', 0) + ".0")
+		}
+		return json.Number(f.Text('f', 0))
+	}
+
+	return json.Number(f.Text('g', -1))
+}
+
+// Short checksum of value. First 16 hex characters of SHA-256 hash.
+func valueChecksum(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// Convert value to its canonical JSON form. Maps with non string keys are converted to string keyed maps
+// and value is decoded back from JSON so that it has only JSON types. Numbers and strings are normalized
+// so that equal values are written the same way. Encoding canonical value gives compact JSON with sorted object keys.
+func canonicalJSONValue(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(stringKeyedValue(v))
+	if err != nil {
+		return nil, err
+	}
+
+	var c interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&c); err != nil {
+		return nil, err
+	}
+
+	return normalizeJSONValue(c), nil
+}
 
-			// Trim new lines if any at the end
-			trimmed := strings.TrimSuffix(val.String(), "\n")
+// Recursively normalize decoded JSON value. Strings are converted to Unicode NFC so that composed and
+// decomposed characters are equal, ex: "é" written as a single code point or as "e" and a combining accent.
+func normalizeJSONValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		return norm.NFC.String(t)
 
-			// Base64 encode JSON encoded values since Consul reads only base64 encoded values.
-			b64Encoded := base64.StdEncoding.EncodeToString([]byte(trimmed))
+	case json.Number:
+		return canonicalNumber(t)
 
-			// Append KV pair to results.
-			*ckv = append(*ckv, consulKVPair{
-				Flags: 0,
-				Key:   newPrefix,
-				Value: b64Encoded,
-			})
+	case []interface{}:
+		for i, val := range t {
+			t[i] = normalizeJSONValue(val)
 		}
+		return t
+
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[norm.NFC.String(k)] = normalizeJSONValue(val)
+		}
+		return m
+	}
+
+	return v
+}
+
+// Write number in its shortest form, ex: 1.50 => 1.5, 1E2 => 100 and -0 => 0. Integers are kept exact
+// irrespective of size. Whole number floats keep a decimal point if float notation is kept.
+func canonicalNumber(n json.Number) json.Number {
+	if !strings.ContainsAny(string(n), ".eE") {
+		if i, ok := new(big.Int).SetString(string(n), 10); ok {
+			return json.Number(i.String())
+		}
+		return n
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return n
+	}
+	if f == 0 {
+		f = 0 // Drop sign of negative zero.
+	}
+
+	if f == math.Trunc(f) && math.Abs(f) < 1e21 {
+		if kvKeepFloatNotation {
+			return json.Number(strconv.FormatFloat(f, 'f', -1, 64) + ".0")
+		}
+		return json.Number(strconv.FormatFloat(f, 'f', -1, 64))
+	}
+
+	// Encoding float gives the shortest representation which parses back to it.
+	b, err := json.Marshal(f)
+	if err != nil {
+		return n
+	}
+
+	return json.Number(b)
+}
+
+// Recursively convert maps with interface keys (ex: YAML) to string keyed maps.
+func stringKeyedValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprintf("%v", k)] = stringKeyedValue(val)
+		}
+		return m
+
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[k] = stringKeyedValue(val)
+		}
+		return m
+
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, val := range t {
+			s[i] = stringKeyedValue(val)
+		}
+		return s
+
+	default:
+		return v
 	}
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Reset flags to their defaults.
+func benchSetup() {
+	newRootCmd()
+}
+
+// Large nested config, mostly strings like typical app configs. 50 sections x 20 tables x 10 keys.
+func benchConfig() map[string]interface{} {
+	m := make(map[string]interface{})
+	for i := 0; i < 50; i++ {
+		section := make(map[string]interface{})
+		for j := 0; j < 20; j++ {
+			table := make(map[string]interface{})
+			for k := 0; k < 10; k++ {
+				key := fmt.Sprintf("key_%d", k)
+				switch k {
+				case 7:
+					table[key] = int64(k * j)
+				case 8:
+					table[key] = k%2 == 0
+				case 9:
+					table[key] = float64(j) + 0.5
+				default:
+					table[key] = fmt.Sprintf("value-%d-%d-%d", i, j, k)
+				}
+			}
+			section[fmt.Sprintf("table_%d", j)] = table
+		}
+		m[fmt.Sprintf("section_%d", i)] = section
+	}
+
+	return m
+}
+
+func BenchmarkKVPairs(b *testing.B) {
+	benchSetup()
+	m := benchConfig()
+	s := kvSettings{prefix: "app", delimiter: "/"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var pairs []consulKVPair
+		mapToKVPairs(&pairs, s.prefix, m, s)
+		if len(pairs) != 50*20*10 {
+			b.Fatalf("got %d pairs", len(pairs))
+		}
+	}
+}
@@ -0,0 +1,970 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Encode value with JSON encoder as appendKVPair does for values without a fast path.
+func encoderJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	e := json.NewEncoder(buf)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func TestScalarJSON(t *testing.T) {
+	values := []interface{}{
+		true, false, 0, -1, math.MaxInt64, int64(math.MinInt64),
+		"", "plain", "with space", "a&b<c>d", "~!@#$%^*()_+`-={}[]|:;',./?",
+	}
+	for _, v := range values {
+		got, ok := scalarJSON(v)
+		if !ok {
+			t.Errorf("scalarJSON(%#v) has no fast path", v)
+			continue
+		}
+		if want := encoderJSON(t, v); got != want {
+			t.Errorf("scalarJSON(%#v) = %s, want %s", v, got, want)
+		}
+	}
+
+	// Values which need escaping or special formatting use the encoder.
+	for _, v := range []interface{}{`q"uote`, `back\slash`, "new\nline", "tab\t", "del\x7f", "ünïcode", "line\u2028separator", 1.5, uint64(1), nil} {
+		if got, ok := scalarJSON(v); ok {
+			t.Errorf("scalarJSON(%#v) = %s, should use the encoder", v, got)
+		}
+	}
+}
+
+func TestOrderedKeys(t *testing.T) {
+	m := map[string]interface{}{"b": 1, "a": 2, "c": 3}
+	if got := strings.Join(orderedKeys(m, nil), ","); got != "a,b,c" {
+		t.Errorf("keys without order = %s, want a,b,c", got)
+	}
+	if got := strings.Join(orderedKeys(m, &keyOrder{keys: []string{"c", "x", "a"}}), ","); got != "c,a,b" {
+		t.Errorf("keys with document order = %s, want c,a,b", got)
+	}
+}
+
+// Format pairs as key=value lines with decoded values.
+func pairLines(t *testing.T, pairs []consulKVPair) string {
+	t.Helper()
+
+	var lines []string
+	for _, p := range pairs {
+		v, err := pairValue(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, p.Key+"="+v)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func TestValueToKVPairs(t *testing.T) {
+	bigInt, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	bigFloat, _ := new(big.Float).SetPrec(128).SetString("3.14159265358979323846")
+
+	tests := []struct {
+		name  string
+		flags []string
+		value interface{}
+		want  string
+	}{
+		{"string", nil, "x", `k="x"`},
+		{"bool", nil, true, `k=true`},
+		{"int", nil, 42, `k=42`},
+		{"int64", nil, int64(-7), `k=-7`},
+		{"uint64", nil, uint64(math.MaxUint64), `k=18446744073709551615`},
+		{"float", nil, 1.5, `k=1.5`},
+		{"whole float", nil, 3.0, `k=3`},
+		{"nil", nil, nil, `k=null`},
+		{"time", nil, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), `k="2020-01-02T03:04:05Z"`},
+		{"big int", nil, bigInt, `k=123456789012345678901234567890`},
+		{"big float", nil, bigFloat, `k=3.14159265358979323846`},
+		{"nil big int", nil, (*big.Int)(nil), `k=null`},
+		{"map", nil, map[string]interface{}{"b": 1, "a": map[string]interface{}{"c": "x"}}, "k/a/c=\"x\"\nk/b=1"},
+		{"interface keyed map", nil, map[interface{}]interface{}{1: "one", "two": 2}, "k/1=\"one\"\nk/two=2"},
+		{"empty map", nil, map[string]interface{}{}, ""},
+		{"array", nil, []interface{}{"a", 1}, `k=["a",1]`},
+		{"typed array", nil, []string{"a", "b"}, `k=["a","b"]`},
+		{"empty array", nil, []interface{}{}, `k=[]`},
+		{"indexed array", []string{"--array-mode", "indexed"}, []interface{}{"a", []interface{}{true}}, "k/0=\"a\"\nk/1/0=true"},
+		{"indexed typed array of maps", []string{"--array-mode", "indexed"}, []map[string]interface{}{{"a": 1}}, "k/0/a=1"},
+		{"empty indexed array", []string{"--array-mode", "indexed"}, []interface{}{}, ""},
+		{"keyed array", []string{"--flatten-arrays-with-keys"}, []interface{}{map[string]interface{}{"name": "web", "port": 80}, map[string]interface{}{"name": "db", "port": 5432}},
+			"k/web/name=\"web\"\nk/web/port=80\nk/db/name=\"db\"\nk/db/port=5432"},
+	}
+
+	for _, tt := range tests {
+		testCmd(t, append([]string{"kv"}, tt.flags...)...)
+		quietLogs(t)
+
+		var pairs []consulKVPair
+		valueToKVPairs(&pairs, "k", tt.value, kvSettings{delimiter: "/"})
+		if got := pairLines(t, pairs); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParallelOutputIsDeterministic(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for i := 0; i < 24; i++ {
+		// Inputs of different sizes so that workers finish out of order.
+		var b strings.Builder
+		fmt.Fprintf(&b, "[input%02d]\n", i)
+		for j := 0; j < (i%5+1)*40; j++ {
+			fmt.Fprintf(&b, "key%d = \"value %d %d\"\n", j, i, j)
+		}
+
+		fPath := filepath.Join(dir, fmt.Sprintf("input%02d.toml", i))
+		if err := ioutil.WriteFile(fPath, []byte(b.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, fPath)
+	}
+
+	output := func(parallel string) string {
+		pairs := testKVPairs(t, append([]string{"--prefix", "app", "--parallel", parallel}, files...)...)
+		out, err := kvPairsToString("json", pairs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	want := output("1")
+	for i := 0; i < 20; i++ {
+		if got := output("8"); got != want {
+			t.Fatalf("run %d: parallel output differs from sequential output", i)
+		}
+	}
+}
+
+func TestEmptyArrays(t *testing.T) {
+	toml := writeTestFile(t, "config.toml", "tags = []\nports = [80]\n\n[db]\nhosts = []\n")
+	jsonFile := writeTestFile(t, "config.json", `{"tags": [], "ports": [80], "db": {"hosts": []}, "nested": [[], [1]]}`)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"json mode", []string{toml}, "db/hosts=[]\nports=[80]\ntags=[]"},
+		{"json mode with preserve", []string{"--preserve-empty-arrays", toml}, "db/hosts=[]\nports=[80]\ntags=[]"},
+		{"indexed mode skips", []string{"--array-mode", "indexed", toml}, "ports/0=80"},
+		{"indexed mode with preserve", []string{"--array-mode", "indexed", "--preserve-empty-arrays", toml}, "db/hosts=[]\nports/0=80\ntags=[]"},
+		{"json input indexed mode", []string{"--array-mode", "indexed", jsonFile}, "nested/1/0=1\nports/0=80"},
+		{"json input indexed mode with preserve", []string{"--array-mode", "indexed", "--preserve-empty-arrays", jsonFile},
+			"db/hosts=[]\nnested/0=[]\nnested/1/0=1\nports/0=80\ntags=[]"},
+	}
+
+	for _, tt := range tests {
+		if got := pairLines(t, testKVPairs(t, tt.args...)); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalizeJSONValues(t *testing.T) {
+	// Decomposed é, "e" followed by a combining acute accent.
+	decomposed := "cafe\u0301"
+	value := []interface{}{json.Number("1.50"), json.Number("2.5e1"), json.Number("9007199254740993"), decomposed,
+		map[interface{}]interface{}{"b": json.Number("1.0e-7"), 1: true}}
+
+	tests := []struct {
+		name  string
+		flags []string
+		want  string
+	}{
+		{"as parsed", nil, `k=[1.50,25,9007199254740993,"` + decomposed + `",{"1":true,"b":1.0e-7}]`},
+		{"canonical", []string{"--canonicalize-json-values"}, `k=[1.5,25,9007199254740993,"` + "caf\u00e9" + `",{"1":true,"b":1e-7}]`},
+	}
+
+	for _, tt := range tests {
+		testCmd(t, append([]string{"kv"}, tt.flags...)...)
+		quietLogs(t)
+
+		var pairs []consulKVPair
+		valueToKVPairs(&pairs, "k", value, kvSettings{delimiter: "/"})
+		if got := pairLines(t, pairs); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalNumber(t *testing.T) {
+	tests := []struct {
+		n, want, keepFloat string
+	}{
+		{"1", "1", "1"},
+		{"-0", "0", "0"},
+		{"123456789012345678901234567890", "123456789012345678901234567890", "123456789012345678901234567890"},
+		{"1.50", "1.5", "1.5"},
+		{"3.0", "3", "3.0"},
+		{"1E2", "100", "100.0"},
+		{"-0.0", "0", "0.0"},
+		{"1e21", "1e+21", "1e+21"},
+		{"0.0000001", "1e-7", "1e-7"},
+	}
+
+	for _, tt := range tests {
+		testCmd(t, "kv")
+		if got := canonicalNumber(json.Number(tt.n)); string(got) != tt.want {
+			t.Errorf("canonicalNumber(%s) = %s, want %s", tt.n, got, tt.want)
+		}
+
+		testCmd(t, "kv", "--keep-float-notation")
+		if got := canonicalNumber(json.Number(tt.n)); string(got) != tt.keepFloat {
+			t.Errorf("canonicalNumber(%s) with float notation = %s, want %s", tt.n, got, tt.keepFloat)
+		}
+	}
+}
+
+func TestFlattenArraysWithKeys(t *testing.T) {
+	servers := writeTestFile(t, "servers.toml", `
+[[servers]]
+name = "web"
+host = "10.0.0.1"
+
+[[servers]]
+name = "db"
+host = "10.0.0.2"
+id = 2
+
+[[servers]]
+name = "cache"
+id = 3
+`)
+
+	got := pairLines(t, testKVPairs(t, "--flatten-arrays-with-keys", "--prefix", "app", servers))
+	want := "app/servers/web/host=\"10.0.0.1\"\napp/servers/web/name=\"web\"\n" +
+		"app/servers/db/host=\"10.0.0.2\"\napp/servers/db/id=2\napp/servers/db/name=\"db\"\n" +
+		"app/servers/cache/id=3\napp/servers/cache/name=\"cache\""
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Arrays which aren't arrays of maps follow array mode.
+	tags := writeTestFile(t, "tags.toml", "tags = [\"a\", \"b\"]\n")
+	if got := pairLines(t, testKVPairs(t, "--flatten-arrays-with-keys", "--array-mode", "indexed", tags)); got != "tags/0=\"a\"\ntags/1=\"b\"" {
+		t.Errorf("scalar array: got\n%s", got)
+	}
+
+	errs := []struct {
+		name    string
+		content string
+		args    []string
+		err     string
+	}{
+		{"missing field", "[[servers]]\nname = \"web\"\n\n[[servers]]\nhost = \"h\"\n", nil, "item 1 of array servers doesn't have key field name"},
+		{"custom field missing", "[[servers]]\nname = \"web\"\n", []string{"--array-key-field", "id"}, "item 0 of array servers doesn't have key field id"},
+		{"duplicate", "[[servers]]\nname = \"web\"\n\n[[servers]]\nname = \"web\"\n", nil, "duplicate value web for key field name in array servers"},
+		{"non scalar", "[[servers]]\nname = [\"web\"]\n", nil, "key field name of item 0 of array servers should be a scalar value"},
+	}
+	for _, tt := range errs {
+		fPath := writeTestFile(t, "config.toml", tt.content)
+		args := append(append([]string{"kv", "--flatten-arrays-with-keys"}, tt.args...), fPath)
+		_, stderr, code := runCLI(t, "", args...)
+		if code == 0 || !strings.Contains(stderr, tt.err) {
+			t.Errorf("%s: exit code %d, stderr %q, want error %q", tt.name, code, stderr, tt.err)
+		}
+	}
+}
+
+func TestKeySuffix(t *testing.T) {
+	fPath := writeTestFile(t, "config.toml", "name = \"app\"\n\n[db]\nport = 5432\n")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--key-suffix", "v1"}, "db/port/v1=5432\nname/v1=\"app\""},
+		{[]string{"--prefix", "myconfig/app", "--key-suffix", "/v1/"}, "myconfig/app/db/port/v1=5432\nmyconfig/app/name/v1=\"app\""},
+		{[]string{"--prefix", "myconfig", "--key-suffix", "v1/live"}, "myconfig/db/port/v1/live=5432\nmyconfig/name/v1/live=\"app\""},
+		{[]string{"--delimiter", ".", "--prefix", "myconfig", "--key-suffix", ".v1."}, "myconfig.db.port.v1=5432\nmyconfig.name.v1=\"app\""},
+		{[]string{"--key-suffix", "/"}, "db/port=5432\nname=\"app\""},
+	}
+
+	for _, tt := range tests {
+		if got := pairLines(t, testKVPairs(t, append(tt.args, fPath)...)); got != tt.want {
+			t.Errorf("%v: got\n%s\nwant\n%s", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestWithChecksum(t *testing.T) {
+	fPath := writeTestFile(t, "config.toml", "name = \"app\"\ntags = [\"a\", \"b\"]\n\n[db]\nport = 5432\n")
+	pairs := testKVPairs(t, "--with-checksum", fPath)
+
+	values := make(map[string]string)
+	for _, p := range pairs {
+		v, err := pairValue(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values[p.Key] = v
+	}
+	if len(values) != 6 {
+		t.Fatalf("got pairs %v, want a checksum pair for every key", values)
+	}
+
+	for k, v := range values {
+		if strings.HasSuffix(k, checksumKeySuffix) {
+			continue
+		}
+
+		sum := sha256.Sum256([]byte(v))
+		want := `"` + hex.EncodeToString(sum[:8]) + `"`
+		if got := values[k+checksumKeySuffix]; got != want {
+			t.Errorf("checksum of %s = %s, want %s", k, got, want)
+		}
+	}
+
+	// Same as the example in README.
+	if got := values["db/port__sum"]; got != `"4aeb7ad6d5d37a04"` {
+		t.Errorf("checksum of db/port = %s", got)
+	}
+}
+
+func TestNoJSONArrayFallback(t *testing.T) {
+	tags := writeTestFile(t, "tags.toml", "name = \"app\"\n\n[db]\nhosts = [\"a\", \"b\"]\n")
+	empty := writeTestFile(t, "empty.toml", "tags = []\n")
+	servers := writeTestFile(t, "servers.toml", "[[servers]]\nname = \"web\"\nport = 80\n")
+	plain := writeTestFile(t, "plain.toml", "name = \"app\"\n")
+
+	fails := []struct {
+		fPath string
+		key   string
+	}{
+		{tags, "db/hosts"},
+		{empty, "tags"},
+		{servers, "servers"},
+	}
+	for _, tt := range fails {
+		_, stderr, code := runCLI(t, "", "kv", "--no-json-array-fallback", tt.fPath)
+		if want := "array at key " + tt.key + " would be JSON encoded"; code == 0 || !strings.Contains(stderr, want) {
+			t.Errorf("%s: exit code %d, stderr %q, want error %q", tt.key, code, stderr, want)
+		}
+	}
+
+	// Explicit array handling is allowed.
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--array-mode", "indexed", tags}, "db/hosts/0=\"a\"\ndb/hosts/1=\"b\"\nname=\"app\""},
+		{[]string{"--array-mode", "indexed", empty}, ""},
+		{[]string{"--flatten-arrays-with-keys", servers}, "servers/web/name=\"web\"\nservers/web/port=80"},
+		{[]string{plain}, "name=\"app\""},
+	}
+	for _, tt := range tests {
+		if got := pairLines(t, testKVPairs(t, append([]string{"--no-json-array-fallback"}, tt.args...)...)); got != tt.want {
+			t.Errorf("%v: got\n%s\nwant\n%s", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestWrapValues(t *testing.T) {
+	fPath := writeTestFile(t, "config.toml", "name = \"app\"\ntags = [\"a\"]\n\n[db]\nhost = \"localhost\"\nport = 5432\n")
+	transforms := writeTestFile(t, "transforms.txt", "db/host s/local/remote/\n")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--value-prefix", `{{ env "`, "--value-suffix", `" }}`},
+			`db/host="{{ env \"localhost\" }}"` + "\n" + `db/port=5432` + "\n" + `name="{{ env \"app\" }}"` + "\n" + `tags=["a"]`},
+		{[]string{"--value-prefix", "<"}, `db/host="<localhost"` + "\n" + `db/port=5432` + "\n" + `name="<app"` + "\n" + `tags=["a"]`},
+		{[]string{"--value-suffix", ">"}, `db/host="localhost>"` + "\n" + `db/port=5432` + "\n" + `name="app>"` + "\n" + `tags=["a"]`},
+		{[]string{"--value-prefix", "<", "--value-suffix", ">", "--wrap-all"},
+			`db/host="<localhost>"` + "\n" + `db/port="<5432>"` + "\n" + `name="<app>"` + "\n" + `tags="<[\"a\"]>"`},
+		// Values are wrapped after transforms.
+		{[]string{"--value-prefix", "<", "--value-suffix", ">", "--transform-values-file", transforms},
+			`db/host="<remotehost>"` + "\n" + `db/port=5432` + "\n" + `name="<app>"` + "\n" + `tags=["a"]`},
+	}
+
+	for _, tt := range tests {
+		if got := pairLines(t, testKVPairs(t, append(tt.args, fPath)...)); got != tt.want {
+			t.Errorf("%v: got\n%s\nwant\n%s", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	valid := writeTestFile(t, "valid.toml", "name = \"app\"\n\n[db]\nport = 5432\n")
+	invalid := writeTestFile(t, "invalid.toml", "name = \n")
+
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+		code  int
+		err   string
+	}{
+		{"valid file", "", []string{valid}, 0, ""},
+		{"valid stdin", "port: 1\n", []string{"--type", "yaml"}, 0, ""},
+		{"invalid file", "", []string{invalid}, 1, "invalid.toml"},
+		{"one invalid input", "", []string{valid, invalid}, 1, "1 input(s) failed"},
+		{"missing file", "", []string{"missing.toml"}, 1, "missing.toml"},
+		{"stdin without type", "port = 1\n", nil, 1, "input format type is required for stdin"},
+		{"validation", "", []string{"--enforce-prefix", "app", valid}, 1, "keys outside enforced prefix app"},
+	}
+
+	for _, tt := range tests {
+		stdout, stderr, code := runCLI(t, tt.stdin, append([]string{"check"}, tt.args...)...)
+		if code != tt.code || !strings.Contains(stderr, tt.err) {
+			t.Errorf("%s: exit code %d, stderr %q, want exit code %d and error %q", tt.name, code, stderr, tt.code, tt.err)
+		}
+		// Nothing is printed on success or failure.
+		if stdout != "" {
+			t.Errorf("%s: output = %q", tt.name, stdout)
+		}
+		if tt.code == 0 && stderr != "" {
+			t.Errorf("%s: stderr = %q", tt.name, stderr)
+		}
+	}
+}
+
+func TestEmitParentsAsIndex(t *testing.T) {
+	config := writeTestFile(t, "config.toml", `
+[app]
+name = "web"
+
+[app.db]
+port = 5432
+
+[[servers]]
+name = "a"
+
+[[servers]]
+name = "b"
+`)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--prefix", "myconfig"}, `myconfig=["app","servers"]
+myconfig/app=["db","name"]
+myconfig/app/db=["port"]
+myconfig/app/db/port=5432
+myconfig/app/name="web"
+myconfig/servers=[{"name":"a"},{"name":"b"}]`},
+		{[]string{"--array-mode", "indexed", "--index-prefix", "item-"}, `app=["db","name"]
+app/db=["port"]
+app/db/port=5432
+app/name="web"
+servers=["item-0","item-1"]
+servers/item-0=["name"]
+servers/item-0/name="a"
+servers/item-1=["name"]
+servers/item-1/name="b"`},
+		{[]string{"--flatten-arrays-with-keys"}, `app=["db","name"]
+app/db=["port"]
+app/db/port=5432
+app/name="web"
+servers=["a","b"]
+servers/a=["name"]
+servers/a/name="a"
+servers/b=["name"]
+servers/b/name="b"`},
+	}
+
+	for _, tt := range tests {
+		args := append(append([]string{"--emit-parents-as-index"}, tt.args...), config)
+		if got := pairLines(t, testKVPairs(t, args...)); got != tt.want {
+			t.Errorf("%v: got\n%s\nwant\n%s", tt.args, got, tt.want)
+		}
+	}
+
+	// Child names are escaped like the keys they name.
+	routes := writeTestFile(t, "routes.json", `{"routes": {"/api": "svc"}}`)
+	got := pairLines(t, testKVPairs(t, "--emit-parents-as-index", "--delimiter-escape", "percent", routes))
+	if want := "routes=[\"%2Fapi\"]\nroutes/%2Fapi=\"svc\""; got != want {
+		t.Errorf("escaped: got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFloatCoercion(t *testing.T) {
+	inputs := map[string]string{
+		"config.json": `{"port": 8080, "replicas": 3.0, "ratio": 0.25, "big": 1e15, "neg": -2.0}`,
+		"config.yaml": "port: 8080\nreplicas: 3.0\nratio: 0.25\nbig: 1.0e+15\nneg: -2.0\n",
+		"config.toml": "port = 8080\nreplicas = 3.0\nratio = 0.25\nbig = 1e15\nneg = -2.0\n",
+	}
+
+	for name, content := range inputs {
+		fPath := writeTestFile(t, name, content)
+
+		got := pairLines(t, testKVPairs(t, fPath))
+		if want := "big=1000000000000000\nneg=-2\nport=8080\nratio=0.25\nreplicas=3"; got != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", name, got, want)
+		}
+
+		// Integers in the input stay integers when float notation is kept, also in JSON where numbers
+		// are told apart by their literal.
+		got = pairLines(t, testKVPairs(t, "--keep-float-notation", fPath))
+		if want := "big=1000000000000000.0\nneg=-2.0\nport=8080\nratio=0.25\nreplicas=3.0"; got != want {
+			t.Errorf("%s keep float notation: got\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
+
+func TestDropPrefixLevels(t *testing.T) {
+	config := writeTestFile(t, "application.yaml", `
+spring:
+  application:
+    name: billing
+  datasource:
+    url: jdbc:h2:mem
+version: 2
+`)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--drop-prefix-levels", "1", "--drop-prefix-short-keys", "skip"}, "application/name=\"billing\"\ndatasource/url=\"jdbc:h2:mem\""},
+		{[]string{"--drop-prefix-levels", "2", "--drop-prefix-short-keys", "skip"}, "name=\"billing\"\nurl=\"jdbc:h2:mem\""},
+		// Segments of prefix are counted too.
+		{[]string{"--drop-prefix-levels", "2", "--prefix", "apps/billing"}, "spring/application/name=\"billing\"\nspring/datasource/url=\"jdbc:h2:mem\"\nversion=2"},
+	}
+	for _, tt := range tests {
+		if got := pairLines(t, testKVPairs(t, append(tt.args, config)...)); got != tt.want {
+			t.Errorf("%v: got\n%s\nwant\n%s", tt.args, got, tt.want)
+		}
+	}
+
+	// Keys which don't have more levels than dropped fail by default.
+	_, stderr, code := runCLI(t, "", "kv", "--drop-prefix-levels", "1", config)
+	if code == 0 || !strings.Contains(stderr, "key version has 1 level(s), can't drop 1") {
+		t.Errorf("short key: code = %d, stderr = %q", code, stderr)
+	}
+
+	_, stderr, code = runCLI(t, "", "kv", "--drop-prefix-levels", "1", "--drop-prefix-short-keys", "keep", config)
+	if code == 0 || !strings.Contains(stderr, "Invalid drop prefix short keys mode - keep") {
+		t.Errorf("invalid mode: code = %d, stderr = %q", code, stderr)
+	}
+}
+
+func TestRedactValues(t *testing.T) {
+	config := writeTestFile(t, "config.toml", `
+name = "billing"
+port = 8080
+ratio = 0.5
+replicas = 3.0
+debug = true
+started = 2020-01-02T03:04:05Z
+tags = ["a", "b"]
+servers = [{host = "h"}]
+
+[db]
+password = "hunter2"
+`)
+
+	got := pairLines(t, testKVPairs(t, "--redact-values", config))
+	want := `db/password="<string>"
+debug="<bool>"
+name="<string>"
+port="<int>"
+ratio="<float>"
+replicas="<float>"
+servers="<array>"
+started="<datetime>"
+tags="<array>"`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Items are redacted separately in indexed mode.
+	got = pairLines(t, testKVPairs(t, "--redact-values", "--array-mode", "indexed", config))
+	for _, line := range []string{`tags/0="<string>"`, `servers/0/host="<string>"`} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("indexed: %s isn't in\n%s", line, got)
+		}
+	}
+	if strings.Contains(got, "hunter2") || strings.Contains(got, "billing") {
+		t.Errorf("values aren't redacted:\n%s", got)
+	}
+
+	if got := redactedValue(valueKind(map[string]interface{}{"a": 1})); got != "<map>" {
+		t.Errorf("map placeholder = %s", got)
+	}
+	if got := redactedValue(valueKind(struct{}{})); got != "<redacted>" {
+		t.Errorf("other placeholder = %s", got)
+	}
+}
+
+func TestConsulPathStyle(t *testing.T) {
+	config := writeTestFile(t, "config.toml", "[db]\nhost = \"localhost\"\n")
+
+	tests := []struct {
+		style string
+		want  string
+	}{
+		{"", "/myconfig/db/host=\"localhost\""},
+		{"classic", "/myconfig/db/host=\"localhost\""},
+		{"modern", "myconfig/db/host=\"localhost\""},
+	}
+	for _, tt := range tests {
+		pairs := testKVPairs(t, "--prefix", "/myconfig", "--consul-path-style", tt.style, config)
+		if got := pairLines(t, pairs); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.style, got, tt.want)
+		}
+
+		// Values are standard base64 in every style.
+		if want := base64.StdEncoding.EncodeToString([]byte(`"localhost"`)); pairs[0].Value != want {
+			t.Errorf("%q: value = %s, want %s", tt.style, pairs[0].Value, want)
+		}
+	}
+
+	// Skip keys are matched against keys after leading slashes are stripped.
+	skip := writeTestFile(t, "skip.txt", "myconfig/db/host\n")
+	if pairs := testKVPairs(t, "--prefix", "/myconfig", "--consul-path-style", "modern", "--skip-keys-file", skip, config); len(pairs) != 0 {
+		t.Errorf("skipped key is written: %s", pairLines(t, pairs))
+	}
+
+	_, stderr, code := runCLI(t, "", "kv", "--prefix", "/", "--consul-path-style", "modern", writeTestFile(t, "root.json", `{"": 1}`))
+	if code == 0 || !strings.Contains(stderr, "key is empty after stripping leading slashes") {
+		t.Errorf("empty key: code = %d, stderr = %q", code, stderr)
+	}
+
+	_, stderr, code = runCLI(t, "", "kv", "--consul-path-style", "v1", config)
+	if code == 0 || !strings.Contains(stderr, "Invalid consul path style - v1") {
+		t.Errorf("invalid style: code = %d, stderr = %q", code, stderr)
+	}
+}
+
+func TestExcludeTypes(t *testing.T) {
+	config := writeTestFile(t, "config.toml", `
+name = "billing"
+port = 8080
+ratio = 0.5
+replicas = 3.0
+debug = true
+started = 2020-01-02T03:04:05Z
+tags = ["a", "b"]
+sizes = [1, 2]
+`)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--exclude-types", "array"}, "debug=true\nname=\"billing\"\nport=8080\nratio=0.5\nreplicas=3\nstarted=\"2020-01-02T03:04:05Z\""},
+		{[]string{"--exclude-types", "array", "--array-mode", "indexed"}, "debug=true\nname=\"billing\"\nport=8080\nratio=0.5\nreplicas=3\nstarted=\"2020-01-02T03:04:05Z\""},
+		{[]string{"--exclude-types", "number"}, "debug=true\nname=\"billing\"\nsizes=[1,2]\nstarted=\"2020-01-02T03:04:05Z\"\ntags=[\"a\",\"b\"]"},
+		// Kind is as parsed, whole floats are floats.
+		{[]string{"--exclude-types", "float,bool"}, "name=\"billing\"\nport=8080\nsizes=[1,2]\nstarted=\"2020-01-02T03:04:05Z\"\ntags=[\"a\",\"b\"]"},
+		// Items in indexed mode are filtered individually.
+		{[]string{"--exclude-types", "int", "--exclude-types", "string,datetime", "--array-mode", "indexed"}, "debug=true\nratio=0.5\nreplicas=3"},
+	}
+	for _, tt := range tests {
+		if got := pairLines(t, testKVPairs(t, append(tt.args, config)...)); got != tt.want {
+			t.Errorf("%v: got\n%s\nwant\n%s", tt.args, got, tt.want)
+		}
+	}
+
+	_, stderr, code := runCLI(t, "", "kv", "--exclude-types", "map", config)
+	if code == 0 || !strings.Contains(stderr, "Invalid exclude type - map") {
+		t.Errorf("invalid type: code = %d, stderr = %q", code, stderr)
+	}
+}
+
+func TestInputErrors(t *testing.T) {
+	good := writeTestFile(t, "a.toml", "name = \"a\"\n")
+	bad1 := writeTestFile(t, "bad1.toml", "name = \n")
+	bad2 := writeTestFile(t, "bad2.json", "{\"name\": \n")
+	missing := filepath.Join(t.TempDir(), "missing.toml")
+
+	// Errors of all bad inputs are reported and nothing is written.
+	stdout, stderr, code := runCLI(t, "", "kv", good, bad1, missing, bad2)
+	if code == 0 || stdout != "" {
+		t.Errorf("aggregate: code = %d, stdout = %q", code, stdout)
+	}
+	for _, want := range []string{"error parsing input " + bad1, "error opening input file", "error parsing input " + bad2, "Error: 3 input(s) failed"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("aggregate: %q isn't in stderr\n%s", want, stderr)
+		}
+	}
+
+	// Conversion stops at the first bad input.
+	stdout, stderr, code = runCLI(t, "", "kv", "--fail-fast", good, bad1, bad2)
+	if code == 0 || stdout != "" {
+		t.Errorf("fail fast: code = %d, stdout = %q", code, stdout)
+	}
+	if !strings.Contains(stderr, "error parsing input "+bad1) || strings.Contains(stderr, bad2) || strings.Contains(stderr, "input(s) failed") {
+		t.Errorf("fail fast: stderr\n%s", stderr)
+	}
+
+	// Inputs are opened before any is parsed.
+	_, stderr, code = runCLI(t, "", "kv", "--fail-fast", bad1, missing)
+	if code == 0 || !strings.Contains(stderr, "error opening input file") || strings.Contains(stderr, bad1) {
+		t.Errorf("fail fast open: code = %d, stderr\n%s", code, stderr)
+	}
+}
+
+func TestKeyNormalization(t *testing.T) {
+	const (
+		composed   = "caf\u00e9"
+		decomposed = "cafe\u0301"
+	)
+	config := writeTestFile(t, "config.json", `{"caf\u00e9": {"host": "cafe\u0301"}, "cafe\u0301": {"port": 1}}`)
+
+	tests := []struct {
+		form string
+		keys []string
+	}{
+		{"", []string{composed + "/host", decomposed + "/port"}},
+		{"nfc", []string{composed + "/host", composed + "/port"}},
+		{"nfd", []string{decomposed + "/host", decomposed + "/port"}},
+	}
+	for _, tt := range tests {
+		pairs := testKVPairs(t, "--key-normalization", tt.form, config)
+		var keys []string
+		for _, p := range pairs {
+			keys = append(keys, p.Key)
+		}
+		sort.Strings(keys)
+		sort.Strings(tt.keys)
+		if !reflect.DeepEqual(keys, tt.keys) {
+			t.Errorf("%q: keys = %+q, want %+q", tt.form, keys, tt.keys)
+		}
+
+		// Values are not normalized.
+		for _, p := range pairs {
+			if strings.HasSuffix(p.Key, "/host") {
+				if v, _ := pairValue(p); v != `"`+decomposed+`"` {
+					t.Errorf("%q: value = %+q", tt.form, v)
+				}
+			}
+		}
+	}
+
+	_, stderr, code := runCLI(t, "", "kv", "--key-normalization", "nfkc", config)
+	if code == 0 || !strings.Contains(stderr, "Invalid key normalization - nfkc") {
+		t.Errorf("invalid form: code = %d, stderr = %q", code, stderr)
+	}
+}
+
+func TestTemplateValues(t *testing.T) {
+	config := writeTestFile(t, "config.toml", `
+[db]
+host = '{{ key "shared/db/host" }}'
+open = "{{ not closed"
+closed = "}} {{ reversed"
+`)
+	transforms := writeTestFile(t, "transforms.txt", "db/* s/shared/changed/\n")
+	args := []string{"--transform-values-file", transforms, "--value-prefix", "<", "--value-suffix", ">", config}
+
+	// Template is written verbatim while other strings are transformed, wrapped and JSON encoded.
+	got := pairLines(t, testKVPairs(t, args...))
+	want := `db/closed="<}} {{ reversed>"
+db/host={{ key "shared/db/host" }}
+db/open="<{{ not closed>"`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	got = pairLines(t, testKVPairs(t, append([]string{"--escape-templates"}, args...)...))
+	if want := `db/host="<{{ key \"changed/db/host\" }}>"`; !strings.Contains(got, want) {
+		t.Errorf("escaped: %s isn't in\n%s", want, got)
+	}
+
+	out, err := kvPairsToString("commands", testKVPairs(t, config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `consul kv put -- 'db/host' '{{ key "shared/db/host" }}'`; !strings.Contains(out, want) {
+		t.Errorf("commands: %s isn't in\n%s", want, out)
+	}
+}
+
+func TestTypeSuffixKeys(t *testing.T) {
+	config := writeTestFile(t, "config.toml", `
+name = "billing"
+port = 8080
+ratio = 0.5
+replicas = 3.0
+debug = true
+started = 2020-01-02T03:04:05Z
+tags = ["a", "b"]
+`)
+	types := filepath.Join(t.TempDir(), "types.json")
+
+	// Type suffix and type map classify values the same way, by their kind in the config.
+	got := pairLines(t, testKVPairs(t, "--type-suffix-keys", "--emit-type-map", types, config))
+	want := `debug:bool=true
+name:string="billing"
+port:int=8080
+ratio:float=0.5
+replicas:float=3
+started:datetime="2020-01-02T03:04:05Z"
+tags:array=["a","b"]`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	if err := writeTypeMapFile(types); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var typeMap map[string]string
+	if err := json.Unmarshal(b, &typeMap); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(got, "\n") {
+		key := strings.SplitN(line, "=", 2)[0]
+		i := strings.LastIndex(key, typeSuffixSeparator)
+		if typeMap[key] != key[i+1:] {
+			t.Errorf("type map of %s = %q, want %q", key, typeMap[key], key[i+1:])
+		}
+	}
+
+	// Redacted values keep the type of the original value.
+	got = pairLines(t, testKVPairs(t, "--type-suffix-keys", "--redact-values", config))
+	if !strings.Contains(got, `port:int="<int>"`) || !strings.Contains(got, `replicas:float="<float>"`) {
+		t.Errorf("redacted:\n%s", got)
+	}
+}
+
+func TestStripQuotes(t *testing.T) {
+	config := writeTestFile(t, "config.toml", `
+host = '"localhost"'
+user = "'admin'"
+nested = "\"'a'\""
+note = '"unbalanced'
+mixed = "'mixed\""
+short = '"'
+empty = '""'
+port = 5432
+tags = ['"a"']
+`)
+
+	got := pairLines(t, testKVPairs(t, "--strip-quotes", "--array-mode", "indexed", config))
+	want := `empty=""
+host="localhost"
+mixed="'mixed\""
+nested="'a'"
+note="\"unbalanced"
+port=5432
+short="\""
+tags/0="a"
+user="admin"`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Quotes are kept unless asked to strip them.
+	if got := pairLines(t, testKVPairs(t, config)); !strings.Contains(got, `host="\"localhost\""`) {
+		t.Errorf("without --strip-quotes:\n%s", got)
+	}
+}
+
+func TestIndexPrefix(t *testing.T) {
+	fPath := writeTestFile(t, "config.toml", `ports = [80, 443]
+
+[[servers]]
+host = "a"
+
+[[servers]]
+host = "b"
+`)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"prefix", []string{"--index-prefix", "item-"},
+			"ports/item-0=80\nports/item-1=443\nservers/item-0/host=\"a\"\nservers/item-1/host=\"b\""},
+		{"underscore prefix", []string{"--index-prefix", "_"},
+			"ports/_0=80\nports/_1=443\nservers/_0/host=\"a\"\nservers/_1/host=\"b\""},
+		{"prefix and padding", []string{"--index-prefix", "item-", "--index-padding", "3"},
+			"ports/item-000=80\nports/item-001=443\nservers/item-000/host=\"a\"\nservers/item-001/host=\"b\""},
+		{"parents as index", []string{"--index-prefix", "item-", "--emit-parents-as-index"},
+			"ports=[\"item-0\",\"item-1\"]\nports/item-0=80\nports/item-1=443\nservers=[\"item-0\",\"item-1\"]\nservers/item-0=[\"host\"]\nservers/item-0/host=\"a\"\n" +
+				"servers/item-1=[\"host\"]\nservers/item-1/host=\"b\""},
+	}
+
+	for _, tt := range tests {
+		pairs := testKVPairs(t, append(append([]string{"--array-mode", "indexed"}, tt.args...), fPath)...)
+		if got := pairLines(t, pairs); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	// Index options don't change arrays in json mode.
+	if got := pairLines(t, testKVPairs(t, "--index-prefix", "item-", fPath)); !strings.HasPrefix(got, "ports=[80,443]\n") {
+		t.Errorf("json array mode: got\n%s", got)
+	}
+}
+
+func TestJSONNumberPrecision(t *testing.T) {
+	// 2^53 + 1 isn't representable as float64 and would be written as 9007199254740992.
+	fPath := writeTestFile(t, "config.json", `{"id": 9007199254740993, "ids": [9007199254740993, 1.50], "limits": {"max": 18446744073709551615}, "ratio": 2.50}`)
+
+	// Literals are written as is, only whole number floats are coerced.
+	want := "id=9007199254740993\nids=[9007199254740993,1.50]\nlimits/max=18446744073709551615\nratio=2.50"
+	if got := pairLines(t, testKVPairs(t, fPath)); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Values written to Consul round trip to the same number.
+	stdout, stderr, code := runCLI(t, "", "kv", "--canonicalize-json-values", "--output-format", "commands", fPath)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "'id' '9007199254740993'") || !strings.Contains(stdout, "'ids' '[9007199254740993,1.5]'") {
+		t.Errorf("canonicalized values:\n%s", stdout)
+	}
+
+	pairs := testKVPairs(t, fPath)
+	v, err := pairValue(pairs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := decodeJSONValue(v, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, err := n.(json.Number).Int64(); err != nil || i != 9007199254740993 {
+		t.Errorf("round trip = %v, %v", i, err)
+	}
+
+	// Numbers keep their JSON types in the type map and schema.
+	stdout, _, _ = runCLI(t, "", "schema", fPath)
+	if !strings.Contains(stdout, `"id": {
+      "type": "integer"
+    }`) || !strings.Contains(stdout, `"ratio": {
+      "type": "number"
+    }`) {
+		t.Errorf("schema:\n%s", stdout)
+	}
+}
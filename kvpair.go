@@ -0,0 +1,70 @@
+// JSON encoding of KV pairs.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Alias of KV pair without JSON methods, to encode and decode known fields.
+type kvPairFields consulKVPair
+
+// Decode KV pair. Key, flags and value are matched ignoring case, so both KV JSON (`key`) and Consul API
+// output (`Key`) are read. Other fields are kept as is, including index metadata of API output
+// (ex: CreateIndex and ModifyIndex) so that it's not lost when migrating between clusters.
+func (p *consulKVPair) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+
+	var known kvPairFields
+	if err := json.Unmarshal(b, &known); err != nil {
+		return err
+	}
+
+	*p = consulKVPair(known)
+	for k := range fields {
+		if strings.EqualFold(k, "key") || strings.EqualFold(k, "flags") || strings.EqualFold(k, "value") {
+			delete(fields, k)
+		}
+	}
+	if len(fields) > 0 {
+		p.extra = fields
+	}
+
+	return nil
+}
+
+// Encode KV pair with key, flags and value followed by extra fields in sorted order.
+func (p consulKVPair) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(kvPairFields(p))
+	if err != nil || len(p.extra) == 0 {
+		return b, err
+	}
+
+	keys := make([]string, 0, len(p.extra))
+	for k := range p.extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := bytes.NewBuffer(b[:len(b)-1])
+	for _, k := range keys {
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.WriteByte(',')
+		buf.Write(kb)
+		buf.WriteByte(':')
+		buf.Write(p.extra[k])
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
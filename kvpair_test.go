@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestKVPairJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want consulKVPair
+		out  string
+	}{
+		{
+			name: "kv json",
+			in:   `{"key":"app/a","flags":3,"value":"MQ==","create_index":10}`,
+			want: consulKVPair{Key: "app/a", Flags: 3, Value: "MQ==", extra: map[string]json.RawMessage{"create_index": json.RawMessage("10")}},
+			out:  `{"key":"app/a","flags":3,"value":"MQ==","create_index":10}`,
+		},
+		{
+			name: "consul api output",
+			in:   `{"LockIndex":0,"Key":"app/a","Flags":3,"Value":"MQ==","CreateIndex":10,"ModifyIndex":12,"Session":"abc"}`,
+			want: consulKVPair{Key: "app/a", Flags: 3, Value: "MQ==", extra: map[string]json.RawMessage{
+				"CreateIndex": json.RawMessage("10"),
+				"LockIndex":   json.RawMessage("0"),
+				"ModifyIndex": json.RawMessage("12"),
+				"Session":     json.RawMessage(`"abc"`),
+			}},
+			out: `{"key":"app/a","flags":3,"value":"MQ==","CreateIndex":10,"LockIndex":0,"ModifyIndex":12,"Session":"abc"}`,
+		},
+		{
+			name: "mixed case",
+			in:   `{"KEY":"app/a","fLaGs":1,"Value":null}`,
+			want: consulKVPair{Key: "app/a", Flags: 1},
+			out:  `{"key":"app/a","flags":1,"value":""}`,
+		},
+	}
+
+	for _, tt := range tests {
+		var p consulKVPair
+		if err := json.Unmarshal([]byte(tt.in), &p); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(p, tt.want) {
+			t.Errorf("%s: decoded %#v, want %#v", tt.name, p, tt.want)
+		}
+
+		b, err := json.Marshal(p)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(b) != tt.out {
+			t.Errorf("%s: encoded %s, want %s", tt.name, b, tt.out)
+		}
+
+		// Encoded pair decodes to the same pair.
+		var again consulKVPair
+		if err := json.Unmarshal(b, &again); err != nil || !reflect.DeepEqual(again, p) {
+			t.Errorf("%s: round trip gives %#v, %v", tt.name, again, err)
+		}
+	}
+}
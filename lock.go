@@ -0,0 +1,239 @@
+// Consul session based locks on the import prefixes.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Key under which prefix locks are held.
+	prefixLockRoot = "consul-cfg/locks"
+
+	// TTL of lock session. Session is renewed at half the TTL, so a lock of an aborted import
+	// is released within TTL.
+	prefixLockTTL = 15 * time.Second
+)
+
+// Interval between attempts to acquire a lock held by another import. Variable so that it can be replaced.
+var prefixLockRetryInterval = time.Second
+
+// Content of lock key, to find out who holds the lock.
+type prefixLockHolder struct {
+	Holder string `json:"holder"`
+	PID    int    `json:"pid"`
+	Prefix string `json:"prefix"`
+}
+
+// Held lock on a prefix.
+type prefixLock struct {
+	client  *consulClient
+	keys    []string
+	session string
+	done    chan struct{}
+}
+
+// Get lock keys of import of pairs under prefixes. Lock is held on the whole prefix with segments joined
+// by `/`, ex: lock of prefix myconfig/app is consul-cfg/locks/myconfig/app. If a prefix is empty, every
+// top-level segment of pairs is locked. Prefixes under another prefix of the import are left out since the
+// lock of the ancestor covers them. Keys are sorted, so that they are always acquired in the same order.
+func prefixLockKeys(prefixes []string, pairs []consulKVPair, delimiter string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	add := func(prefix string) {
+		k := prefixLockRoot + "/" + strings.Join(strings.Split(prefix, delimiter), "/")
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	for _, prefix := range prefixes {
+		if prefix != "" {
+			add(prefix)
+			continue
+		}
+
+		for _, p := range pairs {
+			add(strings.SplitN(trimDelimiter(p.Key, delimiter), delimiter, 2)[0])
+		}
+	}
+	sort.Strings(keys)
+
+	// Sorted keys have their ancestors before them.
+	var out []string
+	for _, k := range keys {
+		covered := false
+		for _, o := range out {
+			if isLockAncestor(o, k) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			out = append(out, k)
+		}
+	}
+
+	return out
+}
+
+// Check if lock key is an ancestor of other key. Ex: consul-cfg/locks/myconfig of consul-cfg/locks/myconfig/app
+func isLockAncestor(key string, other string) bool {
+	return strings.HasPrefix(other, key+"/")
+}
+
+// Get keys of locks held by other sessions which overlap with lock key, ie. the key itself, its ancestors
+// and descendants. Ancestors are returned separately since lock on an ancestor has to be given up on.
+func overlappingLocks(client *consulClient, key string, session string) (ancestors []string, others []string, err error) {
+	held, err := client.list(prefixLockRoot + "/")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, p := range held {
+		var s string
+		if raw, ok := p.extra["Session"]; ok {
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return nil, nil, err
+			}
+		}
+		if s == "" || s == session {
+			continue
+		}
+
+		switch {
+		case isLockAncestor(p.Key, key):
+			ancestors = append(ancestors, p.Key)
+		case p.Key == key || isLockAncestor(key, p.Key):
+			others = append(others, p.Key)
+		}
+	}
+
+	return ancestors, others, nil
+}
+
+// Acquire locks on prefixes of pairs, waiting till timeout if an overlapping lock is held by another import.
+// Lock of a prefix conflicts with locks on its ancestors and descendants, ex: myconfig and myconfig/a, but
+// not with siblings, ex: myconfig/a and myconfig/b. If an ancestor is locked, all held locks are given up
+// on till the ancestor is released. If only descendants are locked, the lock is kept while waiting for them,
+// so that new imports of descendants wait for this one and imports of an ancestor can't starve.
+func acquirePrefixLock(client *consulClient, prefixes []string, pairs []consulKVPair, timeout time.Duration) (*prefixLock, error) {
+	keys := prefixLockKeys(prefixes, pairs, kvDelimiter)
+	session, err := client.createSession(consulSession{
+		Name:      "consul-cfg import " + strings.Join(keys, ", "),
+		TTL:       prefixLockTTL.String(),
+		LockDelay: "0s",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating session - %v", err)
+	}
+
+	host, _ := os.Hostname()
+	holder := prefixLockHolder{Holder: host, PID: os.Getpid(), Prefix: strings.Join(prefixes, ", ")}
+
+	l := &prefixLock{client: client, session: session, done: make(chan struct{})}
+	go l.renew()
+
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for i := 0; i < len(keys); {
+		key := keys[i]
+		ok, err := client.acquire(key, session, holder)
+		if err != nil {
+			l.unlock()
+			return nil, fmt.Errorf("error acquiring lock %s - %v", key, err)
+		}
+
+		blocking := []string{key}
+		if ok {
+			l.hold(key)
+
+			ancestors, others, err := overlappingLocks(client, key, session)
+			if err != nil {
+				l.unlock()
+				return nil, fmt.Errorf("error reading locks - %v", err)
+			}
+
+			// Give up on all locks, so that the import holding the ancestor isn't blocked by them, and
+			// start over.
+			if len(ancestors) > 0 {
+				l.releaseAll()
+				i = 0
+			}
+
+			blocking = append(ancestors, others...)
+			if len(blocking) == 0 {
+				i++
+				waiting = false
+				continue
+			}
+		}
+
+		if time.Now().After(deadline) {
+			l.unlock()
+			return nil, fmt.Errorf("timed out waiting for lock %s held by another import", strings.Join(blocking, ", "))
+		}
+
+		if !waiting {
+			errLog.Printf("Waiting for lock %s held by another import", strings.Join(blocking, ", "))
+			waiting = true
+		}
+		time.Sleep(prefixLockRetryInterval)
+	}
+
+	return l, nil
+}
+
+// Add key to held locks.
+func (l *prefixLock) hold(key string) {
+	for _, k := range l.keys {
+		if k == key {
+			return
+		}
+	}
+
+	l.keys = append(l.keys, key)
+}
+
+// Release held locks.
+func (l *prefixLock) releaseAll() {
+	for _, key := range l.keys {
+		if err := l.client.release(key, l.session); err != nil {
+			errLog.Printf("Error: error releasing lock %s - %v", key, err)
+		}
+	}
+	l.keys = nil
+}
+
+// Renew session till lock is released.
+func (l *prefixLock) renew() {
+	t := time.NewTicker(prefixLockTTL / 2)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-t.C:
+			if err := l.client.renewSession(l.session); err != nil {
+				errLog.Printf("Error: error renewing lock session - %v", err)
+			}
+		}
+	}
+}
+
+// Release locks and destroy their session.
+func (l *prefixLock) unlock() {
+	close(l.done)
+
+	l.releaseAll()
+	if err := l.client.destroySession(l.session); err != nil {
+		errLog.Printf("Error: error destroying lock session - %v", err)
+	}
+}
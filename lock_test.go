@@ -0,0 +1,214 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrefixLockKeys(t *testing.T) {
+	pairs := []consulKVPair{testPair("db/host", "1"), testPair("app/a", "1"), testPair("port", "1"), testPair("app/b", "1")}
+
+	tests := []struct {
+		prefixes  []string
+		pairs     []consulKVPair
+		delimiter string
+		want      []string
+	}{
+		{[]string{"myconfig"}, nil, "/", []string{"consul-cfg/locks/myconfig"}},
+		{[]string{"myconfig/app"}, nil, "/", []string{"consul-cfg/locks/myconfig/app"}},
+		{[]string{"myconfig.app"}, nil, ".", []string{"consul-cfg/locks/myconfig/app"}},
+		// Prefixes covered by another prefix of the import are left out.
+		{[]string{"myconfig/b", "myconfig-x", "myconfig/a/db", "myconfig"}, nil, "/", []string{"consul-cfg/locks/myconfig", "consul-cfg/locks/myconfig-x"}},
+		{[]string{""}, pairs, "/", []string{"consul-cfg/locks/app", "consul-cfg/locks/db", "consul-cfg/locks/port"}},
+		{[]string{"", "app/a"}, pairs, "/", []string{"consul-cfg/locks/app", "consul-cfg/locks/db", "consul-cfg/locks/port"}},
+	}
+
+	for _, tt := range tests {
+		if got := prefixLockKeys(tt.prefixes, tt.pairs, tt.delimiter); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("prefixLockKeys(%q) = %v, want %v", tt.prefixes, got, tt.want)
+		}
+	}
+}
+
+func TestPrefixLockOverlapping(t *testing.T) {
+	quietLogs(t)
+	testCmd(t, "import")
+	m, client := newMockConsul(t)
+
+	held, err := acquirePrefixLock(client, []string{"myconfig/a"}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ancestors and descendants of a held prefix are blocked, siblings aren't.
+	tests := []struct {
+		prefixes []string
+		blocked  bool
+	}{
+		{[]string{"myconfig/a"}, true},
+		{[]string{"myconfig"}, true},
+		{[]string{"myconfig/a/db"}, true},
+		{[]string{"other", "myconfig/a/db"}, true},
+		{[]string{"myconfig/b"}, false},
+		{[]string{"myconfig/ab"}, false},
+		{[]string{"other/app"}, false},
+	}
+	for _, tt := range tests {
+		l, err := acquirePrefixLock(client, tt.prefixes, nil, 0)
+		if tt.blocked {
+			if err == nil || !strings.Contains(err.Error(), "timed out waiting for lock consul-cfg/locks/myconfig/a held by another import") {
+				t.Errorf("%q: expected lock timeout, got %v", tt.prefixes, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.prefixes, err)
+			continue
+		}
+		l.unlock()
+	}
+
+	// Locks acquired before a timeout are released.
+	if len(m.locks) != 1 {
+		t.Errorf("only lock of myconfig/a should be held after timeouts, got %v", m.locks)
+	}
+
+	// Siblings are held at the same time.
+	sibling, err := acquirePrefixLock(client, []string{"myconfig/b"}, nil, 0)
+	if err != nil {
+		t.Fatalf("sibling lock isn't acquired: %v", err)
+	}
+	if _, err := acquirePrefixLock(client, []string{"myconfig"}, nil, 0); err == nil ||
+		!strings.Contains(err.Error(), "consul-cfg/locks/myconfig/a, consul-cfg/locks/myconfig/b") {
+		t.Errorf("ancestor of both siblings should be blocked by them, got %v", err)
+	}
+
+	held.unlock()
+	sibling.unlock()
+	l, err := acquirePrefixLock(client, []string{"myconfig"}, nil, 0)
+	if err != nil {
+		t.Fatalf("lock isn't acquired after release: %v", err)
+	}
+	l.unlock()
+
+	if len(m.locks) != 0 {
+		t.Errorf("locks still held: %v", m.locks)
+	}
+}
+
+func TestPrefixLockAncestorWaits(t *testing.T) {
+	quietLogs(t)
+	testCmd(t, "import")
+	m, client := newMockConsul(t)
+
+	orig := prefixLockRetryInterval
+	prefixLockRetryInterval = 10 * time.Millisecond
+	t.Cleanup(func() { prefixLockRetryInterval = orig })
+
+	child, err := acquirePrefixLock(client, []string{"myconfig/a"}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Import of ancestor keeps its lock while waiting for the descendant, so that new imports of
+	// descendants wait for it.
+	acquired := make(chan *prefixLock)
+	go func() {
+		l, err := acquirePrefixLock(client, []string{"myconfig"}, nil, time.Minute)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- l
+	}()
+
+	for {
+		m.mu.Lock()
+		n := len(m.locks)
+		m.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := acquirePrefixLock(client, []string{"myconfig/b"}, nil, 0); err == nil ||
+		!strings.Contains(err.Error(), "timed out waiting for lock consul-cfg/locks/myconfig held by another import") {
+		t.Errorf("descendant should wait for ancestor waiting for its lock, got %v", err)
+	}
+
+	child.unlock()
+	if l := <-acquired; l != nil {
+		l.unlock()
+	}
+	if len(m.locks) != 0 {
+		t.Errorf("locks still held: %v", m.locks)
+	}
+}
+
+func TestImportPrefixLockOfInputs(t *testing.T) {
+	quietLogs(t)
+	m, client := newMockConsul(t)
+
+	held, err := acquirePrefixLock(client, []string{"myconfig/billing"}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.unlock()
+
+	// Lock is on the resolved prefix of every input, ex: from settings, not on --prefix.
+	auth := writeTestFile(t, "auth.toml", "port = 1\n[_consul_cfg]\nprefix = \"myconfig/auth\"\n")
+	billing := writeTestFile(t, "billing.toml", "port = 1\n[_consul_cfg]\nprefix = \"myconfig/billing\"\n")
+
+	tests := []struct {
+		inputs  []string
+		blocked bool
+	}{
+		{[]string{auth}, false},
+		{[]string{auth, billing}, true},
+	}
+	for _, tt := range tests {
+		cmd, args := testCmd(t, append([]string{"import", "--prefix-lock-timeout", "0", "--prefix-lock"}, tt.inputs...)...)
+		err := importKVPairs(client, convertKVInputs(cmd, args), args)
+		if got := err != nil && strings.Contains(err.Error(), "timed out waiting for lock consul-cfg/locks/myconfig/billing"); got != tt.blocked {
+			t.Errorf("%v: blocked = %v, error %v", tt.inputs, got, err)
+		}
+	}
+
+	if _, ok := m.kv["myconfig/auth/port"]; !ok {
+		t.Errorf("keys of unblocked import aren't written: %v", sortedKVKeys(m.kv))
+	}
+	testCmd(t, "import")
+}
+
+func TestImportReleasesPrefixLock(t *testing.T) {
+	quietLogs(t)
+	m, client := newMockConsul(t)
+
+	tests := []struct {
+		name  string
+		pairs []consulKVPair
+		err   string
+	}{
+		{"imported", []consulKVPair{testPair("myconfig/a", "1")}, ""},
+		{"failed batch", []consulKVPair{testPair("myconfig/fail", "1")}, "1 of 1 batches failed"},
+		{"invalid batch", []consulKVPair{{Key: "myconfig/a", Value: "not base64"}}, "invalid import batches"},
+	}
+	for _, tt := range tests {
+		_, args := testCmd(t, "import", "--prefix", "myconfig", "--prefix-lock")
+		err := importKVPairs(client, tt.pairs, args)
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		} else if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+		}
+
+		if len(m.locks) != 0 {
+			t.Errorf("%s: locks still held: %v", tt.name, m.locks)
+		}
+	}
+	if m.sessions != len(tests) {
+		t.Errorf("lock sessions = %d, want %d", m.sessions, len(tests))
+	}
+	testCmd(t, "import")
+}
@@ -0,0 +1,51 @@
+// Debug logs of emitted KV pairs.
+
+package main
+
+import (
+	"encoding/json"
+)
+
+var (
+	logLevels  = []string{"info", "debug"}
+	logFormats = []string{"text", "json"}
+)
+
+// Debug log line in json log format.
+type debugLine struct {
+	Level       string `json:"level"`
+	Msg         string `json:"msg"`
+	Key         string `json:"key"`
+	ValueLength int    `json:"value_length"`
+	Flags       uint64 `json:"flags"`
+}
+
+// Check if log level and format are supported.
+func validateLogFlags() {
+	if !isValidInputFormat(logLevel, logLevels) {
+		errLog.Fatalf("Invalid log level - %s. Available options are: %s", logLevel, formatsToString(logLevels))
+	}
+
+	if !isValidInputFormat(logFormat, logFormats) {
+		errLog.Fatalf("Invalid log format - %s. Available options are: %s", logFormat, formatsToString(logFormats))
+	}
+}
+
+// Log emitted KV pair to stderr at debug level. Value length is of the JSON encoded value before base64 encoding.
+func logEmittedPair(key string, valueLen int, flags uint64) {
+	if logLevel != "debug" {
+		return
+	}
+
+	if logFormat == "json" {
+		b, err := json.Marshal(debugLine{Level: "debug", Msg: "emitted pair", Key: key, ValueLength: valueLen, Flags: flags})
+		if err != nil {
+			errLog.Fatalf("error marshalling log line: %v", err)
+		}
+
+		errLog.Print(string(b))
+		return
+	}
+
+	errLog.Printf("Debug: emitted pair key=%s value_length=%d flags=%d", key, valueLen, flags)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDebugLogs(t *testing.T) {
+	config := writeTestFile(t, "config.toml", "name = \"billing\"\n\n[db]\nhost = \"localhost\"\nport = 5432\n")
+
+	_, stderr, code := runCLI(t, "", "kv", "--log-level", "debug", config)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %s", code, stderr)
+	}
+	want := "Debug: emitted pair key=db/host value_length=11 flags=0\n" +
+		"Debug: emitted pair key=db/port value_length=4 flags=0\n" +
+		"Debug: emitted pair key=name value_length=9 flags=0\n"
+	if stderr != want {
+		t.Errorf("text logs:\n%s\nwant:\n%s", stderr, want)
+	}
+
+	// One JSON line per pair, sidecar pairs included.
+	_, stderr, code = runCLI(t, "", "kv", "--log-level", "debug", "--log-format", "json", "--with-checksum", "--flags", "2", config)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr %s", code, stderr)
+	}
+	var keys []string
+	for _, l := range strings.Split(strings.TrimSuffix(stderr, "\n"), "\n") {
+		var dl debugLine
+		if err := json.Unmarshal([]byte(l), &dl); err != nil {
+			t.Fatalf("invalid JSON log line %q - %v", l, err)
+		}
+		if dl.Level != "debug" || dl.Msg != "emitted pair" || dl.Flags != 2 || dl.ValueLength == 0 {
+			t.Errorf("log line %q", l)
+		}
+		keys = append(keys, dl.Key)
+	}
+	if want := []string{"db/host", "db/host__sum", "db/port", "db/port__sum", "name", "name__sum"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("logged keys = %v, want %v", keys, want)
+	}
+
+	// Nothing is logged at default level.
+	if _, stderr, _ := runCLI(t, "", "kv", config); stderr != "" {
+		t.Errorf("info level logs: %s", stderr)
+	}
+
+	_, stderr, code = runCLI(t, "", "kv", "--log-level", "trace", config)
+	if code == 0 || !strings.Contains(stderr, "Invalid log level - trace") {
+		t.Errorf("invalid level: code = %d, stderr = %q", code, stderr)
+	}
+}
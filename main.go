@@ -34,38 +34,205 @@
 package main
 
 import (
+	"encoding/json"
 	"log"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 type consulKVPair struct {
 	Key   string `json:"key"`
-	Flags int    `json:"flags"`
+	Flags uint64 `json:"flags"`
 	Value string `json:"value"`
+
+	// Other fields of KV JSON input, ex: create_index and modify_index.
+	extra map[string]json.RawMessage
 }
 
 var (
-	kvInputType        string
-	kvKeyPrefix        string
-	kvAvailableFormats = []string{"toml", "yaml", "hcl", "json", "props"}
+	kvInputType           string
+	kvBuiltinFormats      = []string{"toml", "yaml", "hcl", "json", "props"}
+	kvInputTypeMap        []string
+	kvParallel            int
+	kvEnv                 string
+	kvEnvSections         []string
+	kvKeyPrefix           string
+	kvKeySuffix           string
+	kvDropPrefixLevels    int
+	kvDropPrefixShortKeys string
+	kvPrefixFromKey       string
+	kvPrefixFromKeyRemove bool
+	kvArchivePrefix       bool
+	kvDelimiter           string
+	kvDelimiterEscape     string
+	kvFlags               uint64
+	kvFlagsEncoder        string
+	kvOutputFormat        string
+	kvOutput              string
+	kvArrayMode           string
+	kvArrayModes          = []string{"json", "indexed"}
+
+	kvPreserveEmptyArrays bool
+	kvNoJSONArrayFallback bool
+	kvCanonicalizeJSON    bool
+	kvPreserveComments    bool
+	kvResolveJSONRefs     bool
+	kvWithChecksum        bool
+
+	kvPreserveJSONKeyOrder bool
+	kvEmitParentsAsIndex   bool
+	kvKeepFloatNotation    bool
+
+	kvDropPrefixShortKeysModes = []string{"error", "skip"}
+
+	kvValuePrefix string
+	kvValueSuffix string
+	kvWrapAll     bool
+
+	kvRedactValues bool
+
+	kvBase      string
+	kvMergeInto string
+
+	kvDiffFormat string
+
+	kvConsulPathStyle  string
+	kvConsulPathStyles = []string{"classic", "modern"}
+
+	kvFailFast bool
+
+	kvFlagsFromKeyPattern []string
+
+	kvPrefixFromHostname    bool
+	kvPrefixFromContentHash bool
+
+	kvEscapeTemplates bool
+
+	kvTypeSuffixKeys bool
+
+	kvExpectKeysFile string
+
+	kvStripQuotes bool
+
+	kvKeyValidationRegex string
+
+	kvKeyDepthHistogram bool
+	kvEmitValueLengths  bool
+
+	kvIgnoreKeysRegex string
+
+	kvKeyNormalization  string
+	kvKeyNormalizations = []string{"nfc", "nfd"}
+
+	kvExcludeTypes     []string
+	kvExcludeTypeKinds = []string{"string", "int", "float", "number", "bool", "datetime", "null", "array"}
+
+	kvPrefixFromJSONPath string
+
+	kvRecordPrefixTemplate string
+
+	kvEnsurePrefixKey bool
+
+	kvEmitTypeMap string
+
+	kvIndexPrefix  string
+	kvIndexPadding int
+
+	kvCombineWithStdin bool
+	kvStdinType        string
+
+	kvMergeStrategy     string
+	kvMergeDedupeArrays bool
+
+	kvFlattenArraysWithKeys bool
+	kvArrayKeyField         string
+
+	kvWarningsAsErrors    bool
+	kvWarningsFile        string
+	kvSkipKeysFile        string
+	kvTransformValuesFile string
+	kvMaxKeyLength        int
+	kvEnforcePrefix       string
+
+	kvDetectSecrets       bool
+	kvDetectSecretsIgnore []string
+
+	kvExternalizeSecrets []string
+	kvSecretsFile        string
+	kvVaultMount         string
+
+	kvHelmRootKey      string
+	kvTemplateMapStyle string
+	kvRedisProtocol    string
+	kvSQLTable         string
+	kvParentsFirst     bool
+
+	kvSQLDialect  string
+	kvSQLDialects = []string{"ansi", "mysql"}
+
+	kvNomadVarPath string
+
+	kvCollapseSingleKeyMaps bool
+
+	importConsulAddr  string
+	importConsulToken string
+	importBatchSize   int
+	importUpdateOnly  []string
+	importRetryFile   string
+	importFromKV      bool
+
+	importMapNullToDelete       bool
+	importCaseInsensitiveDedupe bool
+
+	importInheritFrom string
+	importAlsoWrite   string
+
+	importRollbackFile string
+
+	importPrefixLock        bool
+	importPrefixLockTimeout time.Duration
+
+	importReadonlyCheck bool
+	importOutput        string
+
+	schemaInputType string
+	schemaOutput    string
 
 	tmplInputType        string
 	tmplKeyPrefix        string
 	tmplAvailableFormats = []string{"toml", "yaml", "hcl", "json", "props"}
 
+	logLevel  string
+	logFormat string
+
+	quiet bool
+
 	sysLog = log.New(os.Stdout, "", log.LUTC)
 	errLog = log.New(os.Stderr, "", log.LUTC)
 )
 
 func main() {
+	// Execute cli
+	if err := newRootCmd().Execute(); err != nil {
+		errLog.Fatal(err)
+	}
+}
+
+// Create root command with all sub commands. Flag variables are reset to their defaults.
+func newRootCmd() *cobra.Command {
+	checkParserFormats()
+
 	// Configure CLI
 	var rootCmd = &cobra.Command{
 		Use:   "consul-cfg [sub]",
 		Short: "Commandline utils for managing app configs with Consul",
 		Long:  `consul-cfg is a set of utilities for managing app configurations with Consul like generating config template for consul template and exporting app config as consul KV JSON pair config which can be used to bulk import key pairs to Consul.`,
 		Args:  cobra.MinimumNArgs(0),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			validateLogFlags()
+		},
 	}
 
 	// Configure CLI
@@ -77,8 +244,55 @@ func main() {
 	}
 
 	// Configure flags
-	kvCmd.Flags().StringVarP(&kvInputType, "type", "t", "", "Input config format type. Available options are `toml`, `yaml`, `hcl`, `json` and `props` (JAVA properties)")
-	kvCmd.Flags().StringVarP(&kvKeyPrefix, "prefix", "p", "", "Prefix for all keys")
+	addKVFlags(kvCmd)
+	kvCmd.Flags().StringVarP(&kvOutputFormat, "output-format", "o", "json", "Output format. Available options are `json`, `env-export`, `helm-values`, `consul-template-map`, `sql`, `commands`, `java-properties`, `markdown-table`, `cue`, `redis`, `otel-attributes`, `firestore`, `nomad-var` and `graphviz`")
+	kvCmd.Flags().StringVar(&kvSQLTable, "sql-table", "kv", "Table name used in `sql` output")
+	kvCmd.Flags().StringVar(&kvSQLDialect, "sql-dialect", "ansi", "SQL dialect of sql output. ansi quotes identifiers with double quotes (PostgreSQL, SQLite) and mysql with backticks")
+	kvCmd.Flags().BoolVar(&kvParentsFirst, "parents-first", false, "Order `commands` output so that shorter key paths precede their descendants")
+	kvCmd.Flags().StringVar(&kvOutput, "output", "", "Write output to a file, named pipe or Unix domain socket (`unix:<path>`) instead of stdout")
+	kvCmd.Flags().StringVar(&kvTemplateMapStyle, "template-map-style", "keys", "Style of `consul-template-map` output. `keys` writes a directive per key and `tree` ranges over the prefix")
+	kvCmd.Flags().StringVar(&kvMergeInto, "merge-into", "", "KV JSON file (ex: consul kv export output) on which converted KV pairs are overlaid")
+	kvCmd.Flags().StringVar(&kvBase, "base", "", "Base config file. Only keys added, changed or removed from base are written as Consul transaction operations")
+	kvCmd.Flags().StringVar(&kvDiffFormat, "diff-format", "txn", "Format of diff from base. txn writes Consul transaction operations, unified writes changed keys as -/+ lines, json writes changes with old and new values and summary writes counts of changes")
+	kvCmd.Flags().StringVar(&kvRedisProtocol, "redis-protocol", "plain", "Protocol of `redis` output. plain writes redis-cli commands and resp writes RESP for redis-cli --pipe")
+	kvCmd.Flags().StringVar(&kvNomadVarPath, "nomad-var-path", "", "Path of the variable in nomad-var output. Defaults to prefix")
+	kvCmd.Flags().BoolVar(&kvCollapseSingleKeyMaps, "collapse-single-key-maps", false, "Collapse maps with a single key into dotted keys in helm-values and cue output")
+	kvCmd.Flags().StringVar(&kvHelmRootKey, "helm-root-key", "", "Top level key under which values are nested for `helm-values` output")
+
+	var importCmd = &cobra.Command{
+		Use:   "import [file...]",
+		Short: "Commandline utility to convert any config format to consul KV pairs and import them to Consul.",
+		Args:  cobra.MinimumNArgs(0),
+		Run:   runImportCmd,
+	}
+
+	// Configure flags
+	addKVFlags(importCmd)
+	importCmd.Flags().StringVar(&importConsulAddr, "consul-addr", envOrDefault("CONSUL_HTTP_ADDR", "http://127.0.0.1:8500"), "Consul HTTP address. Defaults to `CONSUL_HTTP_ADDR` env")
+	importCmd.Flags().StringVar(&importConsulToken, "token", os.Getenv("CONSUL_HTTP_TOKEN"), "Consul ACL token. Defaults to `CONSUL_HTTP_TOKEN` env")
+	importCmd.Flags().StringSliceVar(&importUpdateOnly, "update-only", nil, "Only write keys matching these key globs, other keys are left untouched")
+	importCmd.Flags().StringVar(&importRetryFile, "retry-file", "", "Write keys of failed batches to this file in KV JSON format")
+	importCmd.Flags().BoolVar(&importFromKV, "from-kv", false, "Inputs are KV JSON files (ex: retry file or `consul kv export` output) instead of configs")
+	importCmd.Flags().BoolVar(&importMapNullToDelete, "map-null-to-delete", false, "Delete keys whose value is null instead of writing null")
+	importCmd.Flags().BoolVar(&importPrefixLock, "prefix-lock", false, "Hold a Consul lock on the prefix of every input while importing, so that imports of the same, parent or child prefixes run one at a time")
+	importCmd.Flags().DurationVar(&importPrefixLockTimeout, "prefix-lock-timeout", 5*time.Minute, "Max time to wait for the prefix lock held by another import")
+	importCmd.Flags().StringVar(&importRollbackFile, "rollback-file", "", "Write Consul transaction operations which undo the import to this file before importing")
+	importCmd.Flags().BoolVar(&importReadonlyCheck, "readonly-check", false, "Don't import, print differences and fail if keys in Consul under the prefix of inputs don't exactly match the generated keys")
+	importCmd.Flags().StringVar(&importOutput, "output", "", "Write differences of readonly check to a file, named pipe or Unix domain socket (`unix:<path>`) instead of stdout")
+	importCmd.Flags().StringVar(&importAlsoWrite, "also-write", "", "Also write imported keys to this file in KV JSON format")
+	importCmd.Flags().StringVar(&importInheritFrom, "inherit-from", "", "Consul prefix whose keys are copied under the prefix of every input with imported keys merged over them")
+	importCmd.Flags().BoolVar(&importCaseInsensitiveDedupe, "prefix-case-insensitive-dedupe", false, "Fail before import if keys differ only by case from other keys or live keys in Consul")
+	importCmd.Flags().IntVar(&importBatchSize, "import-batch-size", consulMaxTxnOps, "Number of keys written in a single transaction. Max 64")
+
+	var checkCmd = &cobra.Command{
+		Use:   "check [file...]",
+		Short: "Commandline utility to check that configs convert to consul KV pairs without printing them.",
+		Args:  cobra.MinimumNArgs(0),
+		Run:   runCheckCmd,
+	}
+
+	// Configure flags
+	addKVFlags(checkCmd)
 
 	var tmplCmd = &cobra.Command{
 		Use:   "tmpl [file...]",
@@ -91,12 +305,99 @@ func main() {
 	tmplCmd.Flags().StringVarP(&tmplInputType, "type", "t", "", "Input config format type. Available options are `toml`, `yaml`, `hcl`, `json` and `props` (JAVA properties)")
 	tmplCmd.Flags().StringVarP(&tmplKeyPrefix, "prefix", "p", "", "Prefix for all keys")
 
+	var schemaCmd = &cobra.Command{
+		Use:   "schema [file...]",
+		Short: "Commandline utility to infer JSON Schema from config structure.",
+		Args:  cobra.MinimumNArgs(0),
+		Run:   runSchemaCmd,
+	}
+
+	// Configure flags
+	schemaCmd.Flags().StringVarP(&schemaInputType, "type", "t", "", "Input config format type. Available options are `toml`, `yaml`, `hcl`, `json` and `props` (JAVA properties). Detected from file extension if not given")
+	schemaCmd.Flags().StringVar(&schemaOutput, "output", "", "Write schema to a file, named pipe or Unix domain socket (`unix:<path>`) instead of stdout")
+
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Log level. Available options are info and debug. Every emitted KV pair is logged at debug level")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Format of debug logs. Available options are text and json")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Don't print diagnostics, ex: key depth histogram and value lengths. Warnings and errors are still printed")
+
 	// Add sub command to root
 	rootCmd.AddCommand(kvCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(checkCmd)
 	rootCmd.AddCommand(tmplCmd)
+	rootCmd.AddCommand(schemaCmd)
 
-	// Execute cli
-	if err := rootCmd.Execute(); err != nil {
-		errLog.Fatal(err)
-	}
+	return rootCmd
+}
+
+// Add flags used for converting config to KV pairs.
+func addKVFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&kvInputType, "type", "t", "", "Input config format type. Available options are `toml`, `yaml`, `hcl`, `json` and `props` (JAVA properties). Detected from file extension if not given")
+	cmd.Flags().StringSliceVar(&kvInputTypeMap, "input-type-map", nil, "Custom file extension to format type mapping used for detection. Ex: `.cfg=toml`")
+	cmd.Flags().BoolVar(&kvCombineWithStdin, "combine-with-stdin", false, "Also read stdin when files are given and let its keys override keys of files")
+	cmd.Flags().StringVar(&kvStdinType, "stdin-type", "", "Input config format type of stdin with --combine-with-stdin. Defaults to --type")
+	cmd.Flags().BoolVar(&kvFailFast, "fail-fast", false, "Stop at the first input which fails instead of reporting errors of all inputs")
+	cmd.Flags().IntVar(&kvParallel, "parallel", 1, "Number of inputs parsed in parallel. Output order is same as inputs")
+	cmd.Flags().StringVarP(&kvKeyPrefix, "prefix", "p", "", "Prefix for all keys")
+	cmd.Flags().StringVar(&kvEnv, "env", "", "Select values of this environment from environment sections and key@env overrides")
+	cmd.Flags().StringSliceVar(&kvEnvSections, "env-sections", []string{"development", "staging", "production"}, "Top level sections which hold values of an environment")
+	cmd.Flags().BoolVar(&kvPrefixFromHostname, "prefix-from-hostname", false, "Join sanitized hostname of the machine to the prefix")
+	cmd.Flags().BoolVar(&kvPrefixFromContentHash, "prefix-from-content-hash", false, "Join hash of content of all inputs to the prefix")
+	cmd.Flags().StringVar(&kvPrefixFromKey, "prefix-from-key", "", "Dot separated key in config whose value is joined to the prefix. Ex: `app.name`")
+	cmd.Flags().BoolVar(&kvEnsurePrefixKey, "ensure-prefix-key", false, "Write a key with empty string value at the prefix of every input if no keys are written under it")
+	cmd.Flags().StringVar(&kvRecordPrefixTemplate, "record-prefix-template", "", "Go template rendered with fields of every record of csv and jsonl inputs as its prefix. Ex: users/{{.id}}")
+	cmd.Flags().StringVar(&kvPrefixFromJSONPath, "prefix-from-json-path", "", "JSONPath expression selecting a single value in config which is joined to the prefix. Ex: $.metadata.name")
+	cmd.Flags().BoolVar(&kvPrefixFromKeyRemove, "prefix-from-key-remove", false, "Remove the key used by `--prefix-from-key` from output")
+	cmd.Flags().BoolVar(&kvArchivePrefix, "archive-prefix", false, "Prefix keys of tar archive members with their path within the archive")
+	cmd.Flags().IntVar(&kvDropPrefixLevels, "drop-prefix-levels", 0, "Drop this many leading path segments from every key")
+	cmd.Flags().StringVar(&kvDropPrefixShortKeys, "drop-prefix-short-keys", "error", "What to do with keys which don't have more levels than dropped. Available options are `error` and `skip`")
+	cmd.Flags().StringVar(&kvKeySuffix, "key-suffix", "", "Suffix path segment appended to all keys")
+	cmd.Flags().StringVarP(&kvDelimiter, "delimiter", "d", "/", "Delimiter used to join nested keys")
+	cmd.Flags().StringVar(&kvKeyNormalization, "key-normalization", "", "Unicode normalization form applied to keys. Available options are nfc and nfd")
+	cmd.Flags().StringVar(&kvConsulPathStyle, "consul-path-style", "", "Key path style of target Consul version. Available options are classic (keys as is) and modern (leading slashes stripped)")
+	cmd.Flags().StringVar(&kvDelimiterEscape, "delimiter-escape", "", "Escape delimiter in key names. Available options are `percent` and `backslash`")
+	cmd.Flags().Uint64Var(&kvFlags, "flags", 0, "Flags value set on all KV pairs")
+	cmd.Flags().StringVar(&kvArrayMode, "array-mode", "json", "How arrays are converted. `json` writes array as a JSON value and `indexed` writes every item under its index")
+	cmd.Flags().StringVar(&kvIndexPrefix, "index-prefix", "", "String prepended to index segments in indexed array mode. Ex: item- gives servers/item-0")
+	cmd.Flags().IntVar(&kvIndexPadding, "index-padding", 0, "Zero pad index segments in indexed array mode to this many digits. Ex: 3 gives servers/000")
+	cmd.Flags().BoolVar(&kvPreserveEmptyArrays, "preserve-empty-arrays", false, "Write empty arrays as `[]` in indexed array mode instead of skipping them")
+	cmd.Flags().BoolVar(&kvNoJSONArrayFallback, "no-json-array-fallback", false, "Fail instead of JSON encoding arrays in json array mode")
+	cmd.Flags().StringVar(&kvMergeStrategy, "merge-strategy", "replace", "How arrays at the same key in more than one input are merged. replace keeps the last array and concat-arrays concatenates them")
+	cmd.Flags().BoolVar(&kvMergeDedupeArrays, "merge-dedupe-arrays", false, "Remove duplicate items of arrays concatenated by concat-arrays merge strategy")
+	cmd.Flags().BoolVar(&kvFlattenArraysWithKeys, "flatten-arrays-with-keys", false, "Write items of array of maps under value of their array key field instead of index")
+	cmd.Flags().StringVar(&kvArrayKeyField, "array-key-field", "name", "Field of array items used as path segment with `--flatten-arrays-with-keys`")
+	cmd.Flags().BoolVar(&kvKeepFloatNotation, "keep-float-notation", false, "Write whole number floats with a decimal point instead of as integers. Ex: 3.0")
+	cmd.Flags().BoolVar(&kvCanonicalizeJSON, "canonicalize-json-values", false, "Canonicalize JSON encoded arrays and maps so that equal values have identical encoding")
+	cmd.Flags().BoolVar(&kvPreserveComments, "preserve-comments-as-metadata", false, "Write comments above TOML keys as `<key>__doc` KV pairs")
+	cmd.Flags().BoolVar(&kvResolveJSONRefs, "resolve-json-refs", false, "Inline values referenced by `$ref` pointers in JSON inputs")
+	cmd.Flags().BoolVar(&kvPreserveJSONKeyOrder, "preserve-key-order-from-json", false, "Write KV pairs of JSON inputs in document order instead of sorted order")
+	cmd.Flags().StringVar(&kvEmitTypeMap, "emit-type-map", "", "Write original type of the value of every key to this JSON file")
+	cmd.Flags().BoolVar(&kvWithChecksum, "with-checksum", false, "Write checksum of every value as `<key>__sum` KV pair")
+	cmd.Flags().BoolVar(&kvEmitParentsAsIndex, "emit-parents-as-index", false, "Write every intermediate key with a JSON array of its child key names as value")
+	cmd.Flags().StringSliceVar(&kvFlagsFromKeyPattern, "flags-from-key-pattern", nil, "Flags value set on keys matching a key glob, of form <key glob>=<flags>. Later patterns override earlier ones")
+	cmd.Flags().StringVar(&kvFlagsEncoder, "flags-encoder", "", "Go template which computes flags value for each KV pair. Overrides `--flags`")
+	cmd.Flags().StringVar(&kvValuePrefix, "value-prefix", "", "Text prepended to every string value")
+	cmd.Flags().StringVar(&kvValueSuffix, "value-suffix", "", "Text appended to every string value")
+	cmd.Flags().BoolVar(&kvWrapAll, "wrap-all", false, "Wrap all values with `--value-prefix` and `--value-suffix`, non string values are wrapped as their JSON encoding")
+	cmd.Flags().StringSliceVar(&kvExcludeTypes, "exclude-types", nil, "Skip values of these kinds. Available options are string, int, float, number, bool, datetime, null and array")
+	cmd.Flags().BoolVar(&kvStripQuotes, "strip-quotes", false, "Remove a single layer of matching surrounding quotes from string values")
+	cmd.Flags().BoolVar(&kvEscapeTemplates, "escape-templates", false, "Convert values with consul-template syntax like other strings instead of writing them verbatim")
+	cmd.Flags().BoolVar(&kvTypeSuffixKeys, "type-suffix-keys", false, "Append type of the value to every key. Ex: port:int")
+	cmd.Flags().BoolVar(&kvRedactValues, "redact-values", false, "Replace every value with a placeholder of its type. Ex: <string>")
+	cmd.Flags().StringVar(&kvSkipKeysFile, "skip-keys-file", "", "File with newline separated list of keys or key globs to skip")
+	cmd.Flags().StringVar(&kvIgnoreKeysRegex, "ignore-keys-regex", "", "Skip keys matching this regex. Regex isn't anchored")
+	cmd.Flags().StringVar(&kvTransformValuesFile, "transform-values-file", "", "File with key globs and transforms applied to their string values")
+	cmd.Flags().BoolVar(&kvDetectSecrets, "detect-secrets", false, "Warn about values which look like secrets")
+	cmd.Flags().StringSliceVar(&kvDetectSecretsIgnore, "detect-secrets-ignore", nil, "Key globs ignored for secret detection")
+	cmd.Flags().StringSliceVar(&kvExternalizeSecrets, "externalize-secrets", nil, "Key globs whose values are replaced with consul-template Vault references and written to the secrets file")
+	cmd.Flags().StringVar(&kvSecretsFile, "secrets-file", "", "File to which externalized secret values are written for loading into Vault")
+	cmd.Flags().StringVar(&kvVaultMount, "vault-mount", "secret", "Mount path of Vault KV v2 secrets engine used in references of externalized secrets")
+	cmd.Flags().IntVar(&kvMaxKeyLength, "max-key-length", defaultMaxKeyLength, "Fail if any key is longer than this many bytes. 0 disables the check")
+	cmd.Flags().StringVar(&kvKeyValidationRegex, "key-validation-regex", "", "Fail if any key doesn't match this regex. Regex has to match the whole key")
+	cmd.Flags().StringVar(&kvExpectKeysFile, "expect-keys", "", "Fail if generated keys differ from the keys listed in this file")
+	cmd.Flags().StringVar(&kvEnforcePrefix, "enforce-prefix", "", "Fail if any key is not under this path")
+	cmd.Flags().BoolVar(&kvKeyDepthHistogram, "key-depth-histogram", false, "Print number of keys at each depth to stderr")
+	cmd.Flags().BoolVar(&kvEmitValueLengths, "emit-value-lengths", false, "Print size of value of every key, largest first, and total sizes to stderr")
+	cmd.Flags().BoolVar(&kvWarningsAsErrors, "warnings-as-errors", false, "Exit with error if there are any warnings")
+	cmd.Flags().StringVar(&kvWarningsFile, "warnings-file", "", "Write warnings to this file as JSON lines instead of stderr")
 }
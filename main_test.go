@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// Env var with JSON encoded args to run the CLI with instead of tests, see runCLI.
+const testCLIArgsEnv = "CONSUL_CFG_TEST_CLI_ARGS"
+
+func TestMain(m *testing.M) {
+	if v := os.Getenv(testCLIArgsEnv); v != "" {
+		var args []string
+		if err := json.Unmarshal([]byte(v), &args); err != nil {
+			panic(err)
+		}
+
+		os.Args = append([]string{"consul-cfg"}, args...)
+		main()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// Run `consul-cfg <args>` in a new process of the test binary with stdin. Returns stdout, stderr and exit code.
+func runCLI(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+
+	b, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), testCLIArgsEnv+"="+string(b))
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	code := 0
+	if err := cmd.Run(); err != nil {
+		e, ok := err.(*exec.ExitError)
+		if !ok {
+			t.Fatal(err)
+		}
+		code = e.ExitCode()
+	}
+
+	return stdout.String(), stderr.String(), code
+}
+
+// Get command for args as if running `consul-cfg <args>`, with flags parsed. Flags not in args are
+// reset to their defaults and state left by earlier conversions is cleared.
+func testCmd(t *testing.T, args ...string) (*cobra.Command, []string) {
+	t.Helper()
+	resetState()
+
+	cmd, rest, err := newRootCmd().Find(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.ParseFlags(rest); err != nil {
+		t.Fatal(err)
+	}
+
+	return cmd, cmd.Flags().Args()
+}
+
+// Convert inputs to KV pairs as `consul-cfg kv <args>` does.
+func testKVPairs(t *testing.T, args ...string) []consulKVPair {
+	t.Helper()
+	quietLogs(t)
+
+	cmd, files := testCmd(t, append([]string{"kv"}, args...)...)
+	return convertKVInputs(cmd, files)
+}
+
+// Write content to file of given name in a temp dir of the test and return its path.
+func writeTestFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	fPath := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(fPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return fPath
+}
+
+// Clear state which conversion compiles from flags or collects, as a fresh process has it.
+func resetState() {
+	skipKeyPatterns = nil
+	ignoreKeysRe = nil
+	flagsPatterns = nil
+	flagsEncoderTmpl = nil
+	customInputTypeExts = make(map[string]string)
+	prefixJSONPathSteps = nil
+	stdinCombined = false
+	inputPrefixes = nil
+	mergedArrays = make(map[string][]interface{})
+	recordPrefixTmpl = nil
+	secretIgnorePatterns = nil
+	externalizePatterns = nil
+	externalSecrets = make(map[string]interface{})
+	sidecarKeys = make(map[string]bool)
+	valueTransforms = nil
+	typeMap = make(map[string]string)
+	warnings = nil
+}
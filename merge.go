@@ -0,0 +1,79 @@
+// Merge strategies for keys given by more than one input.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Available merge strategies.
+var kvMergeStrategies = []string{"replace", "concat-arrays"}
+
+// Arrays seen so far by key, with items of all inputs which had the key.
+var mergedArrays = make(map[string][]interface{})
+
+// Concatenate arrays in map with arrays at the same key of earlier inputs. Arrays in the map are
+// replaced with items of earlier inputs followed by their own, so that when pairs of the same key
+// are written again by this input they have items of all inputs. Arrays inside arrays aren't merged.
+func concatArrays(prefix string, m map[string]interface{}, delimiter string) {
+	for k, v := range m {
+		key := joinKey(prefix, escapeKeySegment(k, delimiter), delimiter)
+
+		switch t := v.(type) {
+		case map[string]interface{}:
+			concatArrays(key, t, delimiter)
+			continue
+
+		case map[interface{}]interface{}:
+			cm := make(map[string]interface{}, len(t))
+			for ck, cv := range t {
+				cm[fmt.Sprintf("%v", ck)] = cv
+			}
+			concatArrays(key, cm, delimiter)
+			m[k] = cm
+			continue
+		}
+
+		if v == nil {
+			continue
+		}
+		if kind := reflect.TypeOf(v).Kind(); kind != reflect.Slice && kind != reflect.Array {
+			continue
+		}
+
+		arr := reflect.ValueOf(v)
+		items := append([]interface{}{}, mergedArrays[key]...)
+		for i := 0; i < arr.Len(); i++ {
+			items = append(items, arr.Index(i).Interface())
+		}
+		if kvMergeDedupeArrays {
+			items = dedupeItems(items)
+		}
+
+		mergedArrays[key] = items
+		m[k] = items
+	}
+}
+
+// Remove items which are equal to an earlier item. Items are compared by their JSON encoding.
+func dedupeItems(items []interface{}) []interface{} {
+	seen := make(map[string]bool, len(items))
+	out := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		b, err := json.Marshal(item)
+		if err != nil {
+			out = append(out, item)
+			continue
+		}
+
+		if seen[string(b)] {
+			continue
+		}
+		seen[string(b)] = true
+		out = append(out, item)
+	}
+
+	return out
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConcatArrays(t *testing.T) {
+	base := writeTestFile(t, "base.toml", `plugins = ["auth", "metrics"]
+name = "base"
+
+[db]
+hosts = ["db1"]
+`)
+	extra := writeTestFile(t, "extra.toml", `plugins = ["metrics", "tracing"]
+name = "extra"
+
+[db]
+hosts = ["db2"]
+`)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"replace", nil,
+			`db/hosts=["db2"]
+name="extra"
+plugins=["metrics","tracing"]`},
+		{"concat", []string{"--merge-strategy", "concat-arrays"},
+			`db/hosts=["db1","db2"]
+name="extra"
+plugins=["auth","metrics","metrics","tracing"]`},
+		{"concat deduped", []string{"--merge-strategy", "concat-arrays", "--merge-dedupe-arrays"},
+			`db/hosts=["db1","db2"]
+name="extra"
+plugins=["auth","metrics","tracing"]`},
+		{"concat indexed", []string{"--merge-strategy", "concat-arrays", "--array-mode", "indexed"},
+			`db/hosts/0="db1"
+db/hosts/1="db2"
+name="extra"
+plugins/0="auth"
+plugins/1="metrics"
+plugins/2="metrics"
+plugins/3="tracing"`},
+	}
+
+	for _, tt := range tests {
+		stdout, stderr, code := runCLI(t, "", append(append([]string{"kv"}, tt.args...), base, extra)...)
+		if code != 0 {
+			t.Errorf("%s: exit code %d, stderr %s", tt.name, code, stderr)
+			continue
+		}
+
+		// JSON output has every key once.
+		var pairs []consulKVPair
+		if err := json.Unmarshal([]byte(stdout), &pairs); err != nil {
+			t.Fatal(err)
+		}
+		if got := pairLines(t, pairs); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	_, stderr, code := runCLI(t, "", "kv", "--merge-strategy", "append", base)
+	if code == 0 || stderr != "Invalid merge strategy - append. Available options are: replace, concat-arrays\n" {
+		t.Errorf("invalid strategy: code = %d, stderr = %q", code, stderr)
+	}
+}
+
+func TestConcatArraysCommands(t *testing.T) {
+	base := writeTestFile(t, "base.toml", `plugins = ["auth", "metrics"]`)
+	extra := writeTestFile(t, "extra.toml", `plugins = ["metrics", "tracing"]`)
+
+	// Other formats keep pairs of every input, the last one has all items.
+	pairs := testKVPairs(t, "--merge-strategy", "concat-arrays", "--merge-dedupe-arrays", base, extra)
+	got, err := kvPairsToString("commands", pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `consul kv put -- 'plugins' '["auth","metrics"]'
+consul kv put -- 'plugins' '["auth","metrics","tracing"]'`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+// Nomad variable specification output of KV pairs.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Nomad variable spec with all KV pairs as items of a single variable. Path is `--nomad-var-path`
+// or else the prefix. Item names are keys without the prefix with segments joined by `_`.
+// Ex: --prefix app/config and app/config/db/host => item db_host of variable app/config.
+func nomadVarSpec(pairs []consulKVPair) (string, error) {
+	prefix := trimDelimiter(kvKeyPrefix, kvDelimiter)
+
+	path := kvNomadVarPath
+	if path == "" {
+		path = strings.Join(splitKey(prefix, kvDelimiter), "/")
+	}
+	if path == "" {
+		return "", fmt.Errorf("nomad variable path is required, set --nomad-var-path or --prefix")
+	}
+
+	items := make(map[string]string, len(pairs))
+	keys := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		key := trimDelimiter(p.Key, kvDelimiter)
+		if prefix != "" {
+			key = strings.TrimPrefix(key, prefix+kvDelimiter)
+		}
+
+		name := nomadItemName(splitKey(key, kvDelimiter))
+		if k, ok := keys[name]; ok {
+			return "", fmt.Errorf("keys %s and %s both map to item %s", k, p.Key, name)
+		}
+
+		v, err := pairPlainValue(p)
+		if err != nil {
+			return "", err
+		}
+
+		items[name] = v
+		keys[name] = p.Key
+	}
+
+	names := make([]string, 0, len(items))
+	width := 0
+	for n := range items {
+		names = append(names, n)
+		if len(n) > width {
+			width = len(n)
+		}
+	}
+	sort.Strings(names)
+
+	buf := bytes.NewBufferString("")
+	fmt.Fprintf(buf, "path = %s\n\nitems {\n", hclQuote(path))
+	for _, n := range names {
+		fmt.Fprintf(buf, "  %-*s = %s\n", width, n, hclQuote(items[n]))
+	}
+	buf.WriteString("}")
+
+	return buf.String(), nil
+}
+
+// Join key segments with `_` as item name. Every character other than `a-z`, `A-Z`, `0-9` and `_`
+// is replaced with `_` so that items can be accessed as fields in templates. Ex: {{ .db_host }}
+func nomadItemName(segments []string) string {
+	b := []byte(strings.Join(segments, "_"))
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			b[i] = '_'
+		}
+	}
+
+	// Identifiers can't start with a digit.
+	if len(b) == 0 || b[0] >= '0' && b[0] <= '9' {
+		return "_" + string(b)
+	}
+
+	return string(b)
+}
+
+// Quote string as HCL string. `"` and `\` are escaped, control characters are written as escape
+// sequences and `${` and `%{` are escaped so that they aren't read as template sequences.
+func hclQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		case (r == '$' || r == '%') && strings.HasPrefix(s[i+1:], "{"):
+			b.WriteRune(r)
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
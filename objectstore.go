@@ -0,0 +1,273 @@
+// Read config inputs from S3 and GCS objects.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Input prefixes of object storage URLs. Ex: s3://bucket/config.toml, gs://bucket/config.toml
+const (
+	s3InputPrefix = "s3://"
+	gsInputPrefix = "gs://"
+)
+
+// SHA-256 of empty payload, used for signing GET requests.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// Client used to download objects. Variable so that it can be replaced.
+var objectStoreHTTP = &http.Client{Timeout: 60 * time.Second}
+
+// Env vars of AWS credential sources other than static keys, which are not supported. Credentials
+// from them have to be exported as static keys, else requests would silently be anonymous.
+var unsupportedAWSCredentialEnvs = []string{
+	"AWS_PROFILE",
+	"AWS_SHARED_CREDENTIALS_FILE",
+	"AWS_WEB_IDENTITY_TOKEN_FILE",
+	"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+	"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+}
+
+// Check if input is an object storage URL.
+func isObjectStoreInput(name string) bool {
+	return strings.HasPrefix(name, s3InputPrefix) || strings.HasPrefix(name, gsInputPrefix)
+}
+
+// Split object storage URL into bucket and object key.
+func splitObjectURL(name string, prefix string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(name, prefix), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid object URL %s, should be of form %s<bucket>/<key>", name, prefix)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// Download object from S3 or GCS.
+func openObjectStoreInput(name string) (io.Reader, error) {
+	var (
+		req *http.Request
+		err error
+	)
+	if strings.HasPrefix(name, s3InputPrefix) {
+		req, err = s3ObjectRequest(name, time.Now())
+	} else {
+		req, err = gsObjectRequest(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := objectStoreHTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s - %v", name, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s - %v", name, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("object %s not found", name)
+	case (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) && req.Header.Get("Authorization") == "":
+		return nil, fmt.Errorf("access denied to %s (%d) for anonymous request, %s", name, resp.StatusCode, objectStoreCredentialsHint(name))
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("access denied to %s (%d), check credentials and permissions", name, resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("error downloading %s - unexpected response %d: %s", name, resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	return bytes.NewReader(b), nil
+}
+
+// Build request for S3 object. Request is signed with AWS signature version 4 if `AWS_ACCESS_KEY_ID`
+// and `AWS_SECRET_ACCESS_KEY` are set, else it's anonymous. Other credential sources like profiles
+// and instance roles are not supported and fail if they are configured in env. `AWS_ENDPOINT_URL` overrides the endpoint
+// for S3 compatible stores (ex: MinIO), in which case path style URLs are used.
+func s3ObjectRequest(name string, now time.Time) (*http.Request, error) {
+	bucket, key, err := splitObjectURL(name, s3InputPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	region := envOrDefault("AWS_REGION", envOrDefault("AWS_DEFAULT_REGION", "us-east-1"))
+
+	var u string
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		u = strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/" + s3EscapePath(key)
+	} else {
+		u = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, s3EscapePath(key))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		for _, env := range unsupportedAWSCredentialEnvs {
+			if os.Getenv(env) != "" {
+				return nil, fmt.Errorf("%s is set but only credentials from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are supported, "+
+					"export them with `aws configure export-credentials --format env`", env)
+			}
+		}
+
+		return req, nil
+	}
+
+	req.Header.Set("X-Amz-Date", now.UTC().Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signS3Request(req, accessKey, secretKey, region)
+
+	return req, nil
+}
+
+// Sign request with AWS signature version 4. All headers set on the request and host are signed.
+func signS3Request(req *http.Request, accessKey string, secretKey string, region string) {
+	amzDate := req.Header.Get("X-Amz-Date")
+	scope := amzDate[:8] + "/" + region + "/s3/aws4_request"
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	reqHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(reqHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, s := range []string{amzDate[:8], region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Escape object key for URL path. Every byte other than unreserved characters and `/` is percent encoded.
+func s3EscapePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// Build request for GCS object using the JSON API. Access token is read from `GOOGLE_OAUTH_ACCESS_TOKEN`
+// or from `gcloud auth print-access-token` if gcloud is installed, else request is anonymous. Application
+// default credentials are not supported and fail if `GOOGLE_APPLICATION_CREDENTIALS` is set.
+// `STORAGE_EMULATOR_HOST` overrides the endpoint for emulators.
+func gsObjectRequest(name string) (*http.Request, error) {
+	bucket, key, err := splitObjectURL(name, gsInputPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := "https://storage.googleapis.com"
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		endpoint = strings.TrimSuffix(host, "/")
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+	}
+
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", endpoint, url.PathEscape(bucket), url.PathEscape(key))
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	token := gcsAccessToken()
+	if token == "" && os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") != "" {
+		return nil, fmt.Errorf("GOOGLE_APPLICATION_CREDENTIALS is set but only access tokens from GOOGLE_OAUTH_ACCESS_TOKEN or gcloud are supported, " +
+			"set GOOGLE_OAUTH_ACCESS_TOKEN with `gcloud auth application-default print-access-token`")
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return req, nil
+}
+
+// Get hint on setting credentials of the object store of input.
+func objectStoreCredentialsHint(name string) string {
+	if strings.HasPrefix(name, s3InputPrefix) {
+		return "set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY"
+	}
+
+	return "set GOOGLE_OAUTH_ACCESS_TOKEN or log in with gcloud"
+}
+
+// Get GCS access token from env or gcloud. Returns empty token if neither is available.
+func gcsAccessToken() string {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token
+	}
+
+	if _, err := exec.LookPath("gcloud"); err != nil {
+		return ""
+	}
+
+	out, err := exec.Command("gcloud", "auth", "print-access-token").Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(out))
+}
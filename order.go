@@ -0,0 +1,131 @@
+// Order in which map keys are traversed.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Document order of keys of a JSON object and its nested objects and arrays.
+type keyOrder struct {
+	keys     []string
+	children map[string]*keyOrder
+	items    []*keyOrder
+}
+
+// Parse JSON document and get document order of its keys. Keys are lower cased same as parsed config map.
+func jsonKeyOrder(b []byte) (*keyOrder, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return jsonValueOrder(d)
+}
+
+// Read next JSON value from decoder and get its key order. Returns nil for scalar values.
+func jsonValueOrder(d *json.Decoder) (*keyOrder, error) {
+	tok, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		o := &keyOrder{children: make(map[string]*keyOrder)}
+		for d.More() {
+			kTok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			k, ok := kTok.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid object key %v", kTok)
+			}
+
+			child, err := jsonValueOrder(d)
+			if err != nil {
+				return nil, err
+			}
+
+			k = strings.ToLower(k)
+			if _, ok := o.children[k]; !ok {
+				o.keys = append(o.keys, k)
+			}
+			o.children[k] = child
+		}
+
+		// Closing brace.
+		_, err := d.Token()
+		return o, err
+
+	case json.Delim('['):
+		o := &keyOrder{}
+		for d.More() {
+			item, err := jsonValueOrder(d)
+			if err != nil {
+				return nil, err
+			}
+
+			o.items = append(o.items, item)
+		}
+
+		// Closing bracket.
+		_, err := d.Token()
+		return o, err
+	}
+
+	return nil, nil
+}
+
+// Get order of nested value under key.
+func (o *keyOrder) child(key string) *keyOrder {
+	if o == nil {
+		return nil
+	}
+
+	return o.children[key]
+}
+
+// Get order of array item at index.
+func (o *keyOrder) item(i int) *keyOrder {
+	if o == nil || i >= len(o.items) {
+		return nil
+	}
+
+	return o.items[i]
+}
+
+// Get keys of map in traversal order. Keys are sorted unless document order is known in which case
+// keys are in document order followed by any other keys in sorted order.
+func orderedKeys(m map[string]interface{}, o *keyOrder) []string {
+	if o == nil {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		return keys
+	}
+
+	var keys, rest []string
+	seen := make(map[string]bool, len(m))
+	for _, k := range o.keys {
+		if _, ok := m[k]; ok {
+			keys = append(keys, k)
+			seen[k] = true
+		}
+	}
+
+	for k := range m {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(keys, rest...)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreserveKeyOrderFromJSON(t *testing.T) {
+	doc := `{"zone": "a", "app": {"port": 80, "host": "x"}, "servers": [{"name": "web", "id": 1}], "Beta": true}`
+	config := writeTestFile(t, "config.json", doc)
+	toml := writeTestFile(t, "config.toml", "zone = \"a\"\napp = 1\n")
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{config}, []string{"app/host", "app/port", "beta", "servers/0/id", "servers/0/name", "zone"}},
+		{[]string{"--preserve-key-order-from-json", config}, []string{"zone", "app/port", "app/host", "servers/0/name", "servers/0/id", "beta"}},
+		// Order of other inputs is still sorted.
+		{[]string{"--preserve-key-order-from-json", toml}, []string{"app", "zone"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, p := range testKVPairs(t, append([]string{"--array-mode", "indexed"}, tt.args...)...) {
+			got = append(got, p.Key)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%v: keys = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestJSONKeyOrder(t *testing.T) {
+	o, err := jsonKeyOrder([]byte(`{"b": {"y": 1, "X": 2}, "a": [{"q": 1, "p": 2}, 3], "b": {"z": 1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Duplicate keys keep their first position and the last value.
+	if got := strings.Join(o.keys, ","); got != "b,a" {
+		t.Errorf("keys = %s, want b,a", got)
+	}
+	if got := strings.Join(o.child("b").keys, ","); got != "z" {
+		t.Errorf("keys of b = %s, want z", got)
+	}
+	if got := strings.Join(o.child("a").item(0).keys, ","); got != "q,p" {
+		t.Errorf("keys of a/0 = %s, want q,p", got)
+	}
+	if o.child("a").item(1) != nil || o.child("a").item(5) != nil || o.child("missing").child("x") != nil {
+		t.Errorf("scalars and missing values should have no order")
+	}
+
+	if _, err := jsonKeyOrder([]byte(`{"a": `)); err == nil {
+		t.Errorf("expected error for invalid JSON")
+	}
+}
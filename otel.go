@@ -0,0 +1,121 @@
+// OpenTelemetry attributes output of KV pairs.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Attribute in OTLP JSON encoding.
+type otelAttribute struct {
+	Key   string    `json:"key"`
+	Value otelValue `json:"value"`
+}
+
+// AnyValue in OTLP JSON encoding. Only one of the fields is set, none for null.
+type otelValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    string          `json:"intValue,omitempty"`
+	DoubleValue *json.Number    `json:"doubleValue,omitempty"`
+	ArrayValue  *otelArrayValue `json:"arrayValue,omitempty"`
+	KvlistValue *otelKvlist     `json:"kvlistValue,omitempty"`
+}
+
+type otelArrayValue struct {
+	Values []otelValue `json:"values"`
+}
+
+type otelKvlist struct {
+	Values []otelAttribute `json:"values"`
+}
+
+// Convert KV pairs to JSON list of OpenTelemetry attributes. Key segments are joined with `.` and
+// `-` is replaced with `_`, ex: db/max-conns => db.max_conns.
+func otelAttributes(pairs []consulKVPair) (string, error) {
+	attrs := make([]otelAttribute, 0, len(pairs))
+	for _, p := range pairs {
+		v, err := pairValue(p)
+		if err != nil {
+			return "", err
+		}
+
+		val, err := decodeJSONValue(v, true)
+		if err != nil {
+			val = v
+		}
+
+		ov, err := toOtelValue(val)
+		if err != nil {
+			return "", fmt.Errorf("key %s - %v", p.Key, err)
+		}
+
+		attrs = append(attrs, otelAttribute{Key: otelKey(p.Key), Value: ov})
+	}
+
+	b, err := json.MarshalIndent(attrs, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// Get attribute name of key.
+func otelKey(key string) string {
+	segments := splitKey(trimDelimiter(key, kvDelimiter), kvDelimiter)
+	return strings.Replace(strings.Join(segments, "."), "-", "_", -1)
+}
+
+// Convert decoded JSON value to AnyValue. Integers are strings as in OTLP JSON, maps are key value lists.
+func toOtelValue(v interface{}) (otelValue, error) {
+	switch t := v.(type) {
+	case nil:
+		return otelValue{}, nil
+
+	case string:
+		return otelValue{StringValue: &t}, nil
+
+	case bool:
+		return otelValue{BoolValue: &t}, nil
+
+	case json.Number:
+		if strings.ContainsAny(string(t), ".eE") {
+			return otelValue{DoubleValue: &t}, nil
+		}
+		return otelValue{IntValue: string(t)}, nil
+
+	case []interface{}:
+		arr := &otelArrayValue{Values: make([]otelValue, 0, len(t))}
+		for _, item := range t {
+			ov, err := toOtelValue(item)
+			if err != nil {
+				return otelValue{}, err
+			}
+			arr.Values = append(arr.Values, ov)
+		}
+		return otelValue{ArrayValue: arr}, nil
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		kv := &otelKvlist{Values: make([]otelAttribute, 0, len(t))}
+		for _, k := range keys {
+			ov, err := toOtelValue(t[k])
+			if err != nil {
+				return otelValue{}, err
+			}
+			kv.Values = append(kv.Values, otelAttribute{Key: k, Value: ov})
+		}
+		return otelValue{KvlistValue: kv}, nil
+	}
+
+	return otelValue{}, fmt.Errorf("unsupported value %v", v)
+}
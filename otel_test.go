@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOtelAttributesOutput(t *testing.T) {
+	testGoldenOutput(t, "otel-attributes", "otel-attributes", "--prefix", "billing")
+}
+
+func TestOtelKey(t *testing.T) {
+	tests := map[string]string{
+		"db/max-conns":          "db.max_conns",
+		"/app/http/read-limit/": "app.http.read_limit",
+		"name":                  "name",
+	}
+	for key, want := range tests {
+		if got := otelKey(key); got != want {
+			t.Errorf("otelKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestOtelValue(t *testing.T) {
+	val, err := decodeJSONValue(`{"b": [1, 2.5, "x"], "a": null, "c": true}`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ov, err := toOtelValue(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(ov)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Map keys are sorted, integers are strings and floats are numbers.
+	want := `{"kvlistValue":{"values":[{"key":"a","value":{}},` +
+		`{"key":"b","value":{"arrayValue":{"values":[{"intValue":"1"},{"doubleValue":2.5},{"stringValue":"x"}]}}},` +
+		`{"key":"c","value":{"boolValue":true}}]}}`
+	if string(b) != want {
+		t.Errorf("got %s\nwant %s", b, want)
+	}
+}
@@ -0,0 +1,539 @@
+// Output formats for KV pairs.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+var kvOutputFormats = []string{"json", "env-export", "helm-values", "consul-template-map", "sql", "commands", "java-properties", "markdown-table", "cue", "redis", "otel-attributes", "firestore", "nomad-var", "graphviz"}
+
+// Separator of key segments in `redis` output. Ex: db:host
+const redisKeySeparator = ":"
+
+// Separator of keys of collapsed single key maps. Ex: a.b.c
+const collapsedKeySeparator = "."
+
+// Output destination prefix for writing to a Unix domain socket. Ex: unix:/var/run/importer.sock
+const unixOutputPrefix = "unix:"
+
+// Convert KV pairs to given output format.
+func kvPairsToString(format string, pairs []consulKVPair) (string, error) {
+	switch format {
+	case "json":
+		// Keys written by more than one input are only written with their last value.
+		b, err := json.MarshalIndent(dedupeKVPairs(pairs), "", "  ")
+		if err != nil {
+			return "", err
+		}
+
+		return string(b), nil
+
+	case "env-export":
+		buf := bytes.NewBufferString("")
+		for _, p := range pairs {
+			v, err := pairPlainValue(p)
+			if err != nil {
+				return "", err
+			}
+
+			fmt.Fprintf(buf, "export %s=%s\n", envKey(p.Key), shellQuote(v))
+		}
+
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+
+	case "helm-values":
+		m, err := pairsToMap(pairs, kvDelimiter, false)
+		if err != nil {
+			return "", err
+		}
+
+		if kvCollapseSingleKeyMaps {
+			if err := collapseSingleKeyMaps(m, collapsedKeySeparator); err != nil {
+				return "", err
+			}
+		}
+
+		// Nest everything under root key if given.
+		var values interface{} = m
+		if kvHelmRootKey != "" {
+			values = map[string]interface{}{kvHelmRootKey: m}
+		}
+
+		b, err := yaml.Marshal(values)
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimSuffix(string(b), "\n"), nil
+
+	case "consul-template-map":
+		return consulTemplateMap(pairs)
+
+	case "sql":
+		buf := bytes.NewBufferString("")
+		for _, p := range pairs {
+			v, err := pairValue(p)
+			if err != nil {
+				return "", err
+			}
+
+			fmt.Fprintf(buf, "INSERT INTO %s (%s, %s, %s) VALUES (%s, %d, %s);\n", sqlIdent(kvSQLTable),
+				sqlIdent("key"), sqlIdent("flags"), sqlIdent("value"), sqlQuote(p.Key), p.Flags, sqlQuote(v))
+		}
+
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+
+	case "commands":
+		if kvParentsFirst {
+			pairs = parentsFirst(pairs, kvDelimiter)
+		}
+
+		buf := bytes.NewBufferString("")
+		for _, p := range pairs {
+			v, err := pairValue(p)
+			if err != nil {
+				return "", err
+			}
+
+			v, err = putCommandValue(v)
+			if err != nil {
+				return "", fmt.Errorf("key %s - %v", p.Key, err)
+			}
+
+			// Arguments after `--` aren't options even if key starts with `-`.
+			if p.Flags != 0 {
+				fmt.Fprintf(buf, "consul kv put -flags=%d -- %s %s\n", p.Flags, shellQuote(p.Key), shellQuote(v))
+			} else {
+				fmt.Fprintf(buf, "consul kv put -- %s %s\n", shellQuote(p.Key), shellQuote(v))
+			}
+		}
+
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+
+	case "java-properties":
+		buf := bytes.NewBufferString("")
+		for _, p := range pairs {
+			v, err := pairPlainValue(p)
+			if err != nil {
+				return "", err
+			}
+
+			key := strings.Join(splitKey(trimDelimiter(p.Key, kvDelimiter), kvDelimiter), ".")
+			fmt.Fprintf(buf, "%s=%s\n", propertiesEscape(key, true), propertiesEscape(v, false))
+		}
+
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+
+	case "cue":
+		return cueConfig(pairs)
+
+	case "otel-attributes":
+		return otelAttributes(pairs)
+
+	case "firestore":
+		return firestoreDocuments(pairs)
+
+	case "nomad-var":
+		return nomadVarSpec(pairs)
+
+	case "graphviz":
+		return graphvizDOT(pairs)
+
+	case "redis":
+		buf := bytes.NewBufferString("")
+		for _, p := range pairs {
+			v, err := pairPlainValue(p)
+			if err != nil {
+				return "", err
+			}
+
+			key := strings.Join(splitKey(trimDelimiter(p.Key, kvDelimiter), kvDelimiter), redisKeySeparator)
+			switch kvRedisProtocol {
+			case "plain":
+				fmt.Fprintf(buf, "SET %s %s\n", redisQuote(key), redisQuote(v))
+			case "resp":
+				fmt.Fprintf(buf, "*3\r\n$3\r\nSET\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(key), key, len(v), v)
+			default:
+				return "", fmt.Errorf("invalid redis protocol - %s", kvRedisProtocol)
+			}
+		}
+
+		// Trailing CRLF is part of the last RESP command.
+		if kvRedisProtocol == "resp" {
+			return buf.String(), nil
+		}
+
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+
+	case "markdown-table":
+		buf := bytes.NewBufferString("| Key | Value | Flags |\n| --- | --- | --- |\n")
+		for _, p := range pairs {
+			v, err := pairPlainValue(p)
+			if err != nil {
+				return "", err
+			}
+
+			fmt.Fprintf(buf, "| %s | %s | %d |\n", markdownCell(p.Key), markdownCell(v), p.Flags)
+		}
+
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+
+	default:
+		return "", fmt.Errorf("invalid output format - %s", format)
+	}
+}
+
+// Generate consul-template for all KV pairs. In `keys` style every key is written as `<key>=` followed by
+// a keyOrDefault directive with current value as default. In `tree` style a single range over the prefix is written.
+func consulTemplateMap(pairs []consulKVPair) (string, error) {
+	buf := bytes.NewBufferString("")
+	switch kvTemplateMapStyle {
+	case "keys":
+		for _, p := range pairs {
+			v, err := pairValue(p)
+			if err != nil {
+				return "", err
+			}
+
+			fmt.Fprintf(buf, "%s={{ keyOrDefault %s %s }}\n", p.Key, strconv.Quote(p.Key), strconv.Quote(v))
+		}
+
+	case "tree":
+		fmt.Fprintf(buf, "{{- range tree %s }}\n{{ .Key }}={{ .Value }}\n{{- end }}\n", strconv.Quote(kvKeyPrefix))
+
+	default:
+		return "", fmt.Errorf("invalid template map style - %s", kvTemplateMapStyle)
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// Get value stored in Consul for the pair.
+func pairValue(p consulKVPair) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(p.Value)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 value for key %s: %v", p.Key, err)
+	}
+
+	return string(b), nil
+}
+
+// Get value of the pair with JSON string values unquoted. Other values are returned as JSON.
+func pairPlainValue(p consulKVPair) (string, error) {
+	v, err := pairValue(p)
+	if err != nil {
+		return "", err
+	}
+
+	var s string
+	if strings.HasPrefix(v, `"`) && json.Unmarshal([]byte(v), &s) == nil {
+		return s, nil
+	}
+
+	return v, nil
+}
+
+// Convert key to environment variable name. Ex: db/max-conns => DB_MAX_CONNS
+func envKey(key string) string {
+	b := []byte(strings.ToUpper(key))
+	for i, c := range b {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			b[i] = '_'
+		}
+	}
+
+	// Environment variable names can't start with a digit.
+	if len(b) > 0 && b[0] >= '0' && b[0] <= '9' {
+		return "_" + string(b)
+	}
+
+	return string(b)
+}
+
+// Quote string for redis-cli. Strings are double quoted with `"` and `\` escaped, and
+// characters other than printable ASCII written as `\n`, `\r`, `\t` or `\xHH` bytes.
+func redisQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// Quote string for POSIX shells using single quotes.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Reconstruct nested map from KV pairs. Keys are split by delimiter and values are JSON decoded,
+// values which are not valid JSON are kept as string.
+func pairsToMap(pairs []consulKVPair, delimiter string, useNumber bool) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	for _, p := range pairs {
+		v, err := pairValue(p)
+		if err != nil {
+			return nil, err
+		}
+
+		val, err := decodeJSONValue(v, useNumber)
+		if err != nil {
+			val = v
+		}
+
+		segments := splitKey(strings.TrimSuffix(strings.TrimPrefix(p.Key, delimiter), delimiter), delimiter)
+		m := root
+		for i, seg := range segments {
+			// Last segment holds the value.
+			if i == len(segments)-1 {
+				if _, ok := m[seg].(map[string]interface{}); ok {
+					return nil, fmt.Errorf("key %s has both value and nested keys", p.Key)
+				}
+
+				m[seg] = val
+				break
+			}
+
+			child, ok := m[seg]
+			if !ok {
+				child = make(map[string]interface{})
+				m[seg] = child
+			}
+
+			cm, ok := child.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("key %s has both value and nested keys", strings.Join(segments[:i+1], delimiter))
+			}
+
+			m = cm
+		}
+	}
+
+	return root, nil
+}
+
+// Recursively collapse chains of maps with a single key into one key with segments joined by
+// separator. Ex: {a: {b: {c: 1}}} => {a.b.c: 1} and {a: {b: {c: 1, d: 2}}} => {a.b: {c: 1, d: 2}}.
+// Keys of the given map itself are kept as is. Empty maps aren't collapsed.
+func collapseSingleKeyMaps(v interface{}, sep string) error {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+
+		for _, k := range keys {
+			key, val := k, t[k]
+			for {
+				cm, ok := val.(map[string]interface{})
+				if !ok || len(cm) != 1 {
+					break
+				}
+
+				for ck, cv := range cm {
+					key, val = key+sep+ck, cv
+				}
+			}
+
+			if key != k {
+				if _, ok := t[key]; ok {
+					return fmt.Errorf("collapsed key %s already exists", key)
+				}
+				delete(t, k)
+				t[key] = val
+			}
+
+			if err := collapseSingleKeyMaps(val, sep); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		for _, item := range t {
+			if err := collapseSingleKeyMaps(item, sep); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Decode JSON value. Numbers are decoded as json.Number if use number is set.
+func decodeJSONValue(s string, useNumber bool) (interface{}, error) {
+	var v interface{}
+	if !useNumber {
+		err := json.Unmarshal([]byte(s), &v)
+		return v, err
+	}
+
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	// Value should be the whole input.
+	if _, err := d.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON value %s", s)
+	}
+
+	return v, nil
+}
+
+// Write output to destination. Destination can be empty for stdout, `unix:<path>` for a
+// Unix domain socket or a file path which can also be a named pipe.
+func writeOutput(dest string, out string) error {
+	if dest == "" {
+		sysLog.Println(out)
+		return nil
+	}
+
+	var w io.WriteCloser
+	if strings.HasPrefix(dest, unixOutputPrefix) {
+		conn, err := net.Dial("unix", strings.TrimPrefix(dest, unixOutputPrefix))
+		if err != nil {
+			return err
+		}
+
+		w = conn
+	} else {
+		// Opening a named pipe blocks till there is a reader.
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+
+		w = f
+	}
+
+	if _, err := io.WriteString(w, out+"\n"); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// Escape value for `consul kv put` which reads values starting with `@` from a file and value `-` from
+// stdin. Values starting with `@` are escaped with `\` which consul removes. Value `-` can't be escaped.
+func putCommandValue(v string) (string, error) {
+	switch {
+	case v == "-":
+		return "", fmt.Errorf("value - can't be written as a consul kv put command since it reads stdin")
+	case strings.HasPrefix(v, "@"):
+		return `\` + v, nil
+	}
+
+	return v, nil
+}
+
+// Sort pairs so that keys with fewer path segments come first, hence parents precede their
+// descendants. Order of keys with same depth is kept.
+func parentsFirst(pairs []consulKVPair, delimiter string) []consulKVPair {
+	sorted := append([]consulKVPair{}, pairs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.Count(sorted[i].Key, delimiter) < strings.Count(sorted[j].Key, delimiter)
+	})
+
+	return sorted
+}
+
+// Escape string for Java properties file same as `Properties.store`. `\`, `=`, `:`, `#`, `!` and
+// control characters are backslash escaped, spaces are escaped in keys and leading space in values.
+// Characters outside printable ASCII are written as \uXXXX escapes.
+func propertiesEscape(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == ' ' && (key || i == 0):
+			b.WriteString(`\ `)
+		case r == '\\' || r == '=' || r == ':' || r == '#' || r == '!':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r < 0x20 || r > 0x7e:
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, `\u%04X`, u)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// Escape text for a Markdown table cell. Pipes are backslash escaped and new lines are written as <br>.
+func markdownCell(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "|", `\|`, -1)
+	s = strings.Replace(s, "\r\n", "<br>", -1)
+	return strings.Replace(s, "\n", "<br>", -1)
+}
+
+// Quote string as SQL string literal. Single quotes are escaped by doubling them.
+func sqlQuote(s string) string {
+	// MySQL treats backslashes in string literals as escapes by default.
+	if kvSQLDialect == "mysql" {
+		s = strings.Replace(s, `\`, `\\`, -1)
+	}
+
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// Valid SQL table names, an identifier optionally qualified by schema. Ex: kv, config.kv
+var sqlTableRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Quote identifier for SQL dialect. Qualified names are quoted per part. Ex: config.kv => "config"."kv"
+func sqlIdent(name string) string {
+	q := `"`
+	if kvSQLDialect == "mysql" {
+		q = "`"
+	}
+
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = q + p + q
+	}
+
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "Update golden files in testdata")
+
+// Compare output with golden file testdata/<name>.golden. Run `go test -update` to rewrite golden files.
+func assertGolden(t *testing.T, name string, got string) {
+	t.Helper()
+
+	fPath := filepath.Join("testdata", name+".golden")
+	if *updateGolden {
+		if err := ioutil.WriteFile(fPath, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := ioutil.ReadFile(fPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("output doesn't match %s\ngot:\n%s\nwant:\n%s", fPath, got, want)
+	}
+}
+
+// Convert testdata config with args and compare output in format with golden file.
+func testGoldenOutput(t *testing.T, format string, name string, args ...string) {
+	t.Helper()
+
+	pairs := testKVPairs(t, append(args, filepath.Join("testdata", "config.toml"))...)
+	got, err := kvPairsToString(format, pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, name, got)
+}
+
+func TestHelmValuesOutput(t *testing.T) {
+	testGoldenOutput(t, "helm-values", "helm-values", "--prefix", "billing")
+	testGoldenOutput(t, "helm-values", "helm-values-root-key", "--prefix", "billing", "--helm-root-key", "config")
+}
+
+func TestConsulTemplateMapOutput(t *testing.T) {
+	testGoldenOutput(t, "consul-template-map", "consul-template-map-keys", "--prefix", "billing")
+	testGoldenOutput(t, "consul-template-map", "consul-template-map-tree", "--prefix", "billing", "--template-map-style", "tree")
+}
+
+func TestSQLOutput(t *testing.T) {
+	testGoldenOutput(t, "sql", "sql-ansi", "--prefix", "billing", "--sql-table", "config.kv")
+	testGoldenOutput(t, "sql", "sql-mysql", "--prefix", "billing", "--sql-dialect", "mysql")
+}
+
+func TestSQLQuote(t *testing.T) {
+	tests := []struct {
+		dialect string
+		in      string
+		want    string
+	}{
+		{"ansi", `it's`, `'it''s'`},
+		{"ansi", `a\b`, `'a\b'`},
+		{"mysql", `it's`, `'it''s'`},
+		{"mysql", `a\'b`, `'a\\''b'`},
+	}
+
+	for _, tt := range tests {
+		kvSQLDialect = tt.dialect
+		if got := sqlQuote(tt.in); got != tt.want {
+			t.Errorf("%s: sqlQuote(%q) = %s, want %s", tt.dialect, tt.in, got, tt.want)
+		}
+	}
+	kvSQLDialect = "ansi"
+}
+
+func TestSQLTableName(t *testing.T) {
+	valid := []string{"kv", "app_config", "config.kv", "_t1"}
+	invalid := []string{"", "x; DROP TABLE y", "1kv", "a.b.c", `kv"`, "k v", "kv;"}
+
+	for _, name := range valid {
+		if !sqlTableRe.MatchString(name) {
+			t.Errorf("table name %q should be valid", name)
+		}
+	}
+	for _, name := range invalid {
+		if sqlTableRe.MatchString(name) {
+			t.Errorf("table name %q should be invalid", name)
+		}
+	}
+}
+
+func TestCUEOutput(t *testing.T) {
+	testGoldenOutput(t, "cue", "cue", "--prefix", "billing")
+	testGoldenOutput(t, "cue", "cue-collapsed", "--prefix", "billing", "--collapse-single-key-maps")
+}
+
+func TestFirestoreOutput(t *testing.T) {
+	testGoldenOutput(t, "firestore", "firestore", "--prefix", "config/billing")
+}
+
+func TestNomadVarOutput(t *testing.T) {
+	testGoldenOutput(t, "nomad-var", "nomad-var", "--prefix", "billing")
+	testGoldenOutput(t, "nomad-var", "nomad-var-path", "--prefix", "billing", "--nomad-var-path", "nomad/jobs/billing")
+}
+
+func TestEnvExportOutput(t *testing.T) {
+	fPath := writeTestFile(t, "config.toml", `name = "it's"
+quotes = "'single' and \"double\""
+"max-conns" = 10
+tags = ["a'b"]
+
+[db]
+"2nd.host" = "$HOME ${x} `+"`cmd`"+`"
+`)
+
+	got, err := kvPairsToString("env-export", testKVPairs(t, "--prefix", "app", fPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `export APP_DB_2ND_HOST='$HOME ${x} ` + "`cmd`" + `'
+export APP_MAX_CONNS='10'
+export APP_NAME='it'\''s'
+export APP_QUOTES=''\''single'\'' and "double"'
+export APP_TAGS='["a'\''b"]'`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Sourcing the output sets variables to the exact values.
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not in PATH")
+	}
+	out, err := exec.Command(sh, "-c", got+"\nprintf '%s|%s|%s' \"$APP_NAME\" \"$APP_QUOTES\" \"$APP_DB_2ND_HOST\"").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `it's|'single' and "double"|$HOME ${x} ` + "`cmd`"; string(out) != want {
+		t.Errorf("sourced values = %s, want %s", out, want)
+	}
+}
+
+func TestEnvKey(t *testing.T) {
+	tests := map[string]string{
+		"db/max-conns": "DB_MAX_CONNS",
+		"app.v2/Host":  "APP_V2_HOST",
+		"1st/key":      "_1ST_KEY",
+		"ünï":          "__N__",
+	}
+	for in, want := range tests {
+		if got := envKey(in); got != want {
+			t.Errorf("envKey(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestWriteOutput(t *testing.T) {
+	dir := t.TempDir()
+
+	// Regular file is truncated before writing.
+	fPath := filepath.Join(dir, "out.json")
+	if err := ioutil.WriteFile(fPath, []byte("stale content which is longer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeOutput(fPath, "[]"); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(fPath); string(b) != "[]\n" {
+		t.Errorf("file output = %q", b)
+	}
+
+	// Unix socket gets the whole output and the connection is closed after it.
+	sock := filepath.Join(dir, "out.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		b, _ := ioutil.ReadAll(conn)
+		received <- string(b)
+	}()
+	if err := writeOutput(unixOutputPrefix+sock, `[{"key":"a"}]`); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != "[{\"key\":\"a\"}]\n" {
+		t.Errorf("socket output = %q", got)
+	}
+
+	// Socket without a listener is an error.
+	if err := writeOutput(unixOutputPrefix+filepath.Join(dir, "missing.sock"), "[]"); err == nil {
+		t.Errorf("expected error for socket without listener")
+	}
+}
+
+func TestWriteOutputNamedPipe(t *testing.T) {
+	if _, err := exec.LookPath("mkfifo"); err != nil {
+		t.Skip("mkfifo is not in PATH")
+	}
+
+	pipe := filepath.Join(t.TempDir(), "out.pipe")
+	if out, err := exec.Command("mkfifo", pipe).CombinedOutput(); err != nil {
+		t.Fatalf("mkfifo: %v %s", err, out)
+	}
+
+	received := make(chan string, 1)
+	go func() {
+		b, _ := ioutil.ReadFile(pipe)
+		received <- string(b)
+	}()
+
+	// kv command writes the same output to the pipe as to stdout.
+	fPath := filepath.Join("testdata", "config.toml")
+	stdout, stderr, code := runCLI(t, "", "kv", fPath)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if _, stderr, code := runCLI(t, "", "kv", "--output", pipe, fPath); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if got := <-received; got != stdout {
+		t.Errorf("pipe output = %q, want %q", got, stdout)
+	}
+}
+
+func TestCommandsOutput(t *testing.T) {
+	testCmd(t, "kv")
+
+	pairs := []consulKVPair{
+		testPair("app/db/port", "5432"),
+		testPair("app", `"it's"`),
+		testPair("-app/opt", "true"),
+		testPair("app/file", `@{{ key "path" }}`),
+		{Key: "app/flagged", Flags: 42, Value: base64.StdEncoding.EncodeToString([]byte("1"))},
+	}
+	got, err := kvPairsToString("commands", pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		`consul kv put -- 'app/db/port' '5432'`,
+		`consul kv put -- 'app' '"it'\''s"'`,
+		`consul kv put -- '-app/opt' 'true'`,
+		`consul kv put -- 'app/file' '\@{{ key "path" }}'`,
+		`consul kv put -flags=42 -- 'app/flagged' '1'`,
+	}, "\n")
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Parents come before their descendants, order of keys of same depth is kept.
+	testCmd(t, "kv", "--parents-first")
+	got, err = kvPairsToString("commands", pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, l := range strings.Split(got, "\n") {
+		keys = append(keys, strings.Fields(strings.SplitN(l, " -- ", 2)[1])[0])
+	}
+	if want := "'app' '-app/opt' 'app/file' 'app/flagged' 'app/db/port'"; strings.Join(keys, " ") != want {
+		t.Errorf("parents first order = %s, want %s", strings.Join(keys, " "), want)
+	}
+
+	// Value which would be read from stdin is an error.
+	if _, err := kvPairsToString("commands", []consulKVPair{testPair("app/in", "-")}); err == nil || !strings.Contains(err.Error(), "key app/in") {
+		t.Errorf("error = %v, want error for value -", err)
+	}
+}
+
+func TestJavaPropertiesOutput(t *testing.T) {
+	testGoldenOutput(t, "java-properties", "java-properties", "--prefix", "billing")
+
+	fPath := writeTestFile(t, "config.toml", `url = "jdbc:mysql://db?a=b"
+" lead" = " space #1 !"
+"key=with:sep" = "x"
+unicode = "héllo wörld"
+emoji = "😀"
+multi = "a\nb\tc"
+`)
+	got, err := kvPairsToString("java-properties", testKVPairs(t, fPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `\ lead=\ space \#1 \!
+emoji=\uD83D\uDE00
+key\=with\:sep=x
+multi=a\nb\tc
+unicode=h\u00E9llo w\u00F6rld
+url=jdbc\:mysql\://db?a\=b`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Output parses back to the same values as props input. Surrogate pairs aren't decoded by props input.
+	props := writeTestFile(t, "config.properties", got)
+	pairs := testKVPairs(t, props)
+	values := map[string]string{}
+	for _, p := range pairs {
+		v, err := pairPlainValue(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values[p.Key] = v
+	}
+	for k, v := range map[string]string{"url": "jdbc:mysql://db?a=b", "unicode": "héllo wörld", "multi": "a\nb\tc"} {
+		if values[k] != v {
+			t.Errorf("props input %s = %q, want %q", k, values[k], v)
+		}
+	}
+}
+
+func TestMarkdownTableOutput(t *testing.T) {
+	testGoldenOutput(t, "markdown-table", "markdown-table", "--prefix", "billing", "--flags", "7", "--ignore-keys-regex", "^billing/db/pool/")
+
+	fPath := writeTestFile(t, "config.json", `{"grep": "a|b", "path": "C:\\tmp", "multi": "line 1\r\nline 2\nline 3", "a|b": ["x|y"]}`)
+	got, err := kvPairsToString("markdown-table", testKVPairs(t, fPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `| Key | Value | Flags |
+| --- | --- | --- |
+| a\|b | ["x\|y"] | 0 |
+| grep | a\|b | 0 |
+| multi | line 1<br>line 2<br>line 3 | 0 |
+| path | C:\\tmp | 0 |`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRedisOutput(t *testing.T) {
+	testGoldenOutput(t, "redis", "redis-plain", "--prefix", "billing")
+
+	fPath := writeTestFile(t, "config.json", `{"q": "say \"hi\" \\ bye", "ml": "a\nb\r\tc", "u": "né", "sp": "a b", "n": {"x": [1]}}`)
+	pairs := testKVPairs(t, fPath)
+
+	got, err := kvPairsToString("redis", pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `SET "ml" "a\nb\r\tc"
+SET "n:x" "[1]"
+SET "q" "say \"hi\" \\ bye"
+SET "sp" "a b"
+SET "u" "n\xc3\xa9"`
+	if got != want {
+		t.Errorf("plain: got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Bulk strings are length prefixed in bytes and not escaped.
+	testCmd(t, "kv", "--redis-protocol", "resp")
+	got, err = kvPairsToString("redis", pairs[len(pairs)-1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "*3\r\n$3\r\nSET\r\n$1\r\nu\r\n$3\r\nné\r\n"; got != want {
+		t.Errorf("resp: got %q, want %q", got, want)
+	}
+	testCmd(t, "kv")
+}
+
+func TestCollapseSingleKeyMaps(t *testing.T) {
+	testGoldenOutput(t, "helm-values", "helm-values-collapsed", "--prefix", "app/billing", "--collapse-single-key-maps")
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+		err  string
+	}{
+		{"single key chain", `{"a": {"b": {"c": 1}}}`, `{"a.b.c":1}`, ""},
+		{"chain ending in multi key map", `{"a": {"b": {"c": 1, "d": 2}}, "e": 3}`, `{"a.b":{"c":1,"d":2},"e":3}`, ""},
+		{"nested chain under multi key map", `{"a": {"b": {"c": 1}, "d": {}}}`, `{"a":{"b.c":1,"d":{}}}`, ""},
+		{"maps in arrays", `{"a": [{"b": {"c": 1}}, 2]}`, `{"a":[{"b.c":1},2]}`, ""},
+		{"conflict", `{"a": {"b": 1}, "a.b": 2}`, "", "collapsed key a.b already exists"},
+	}
+
+	for _, tt := range tests {
+		v, err := decodeJSONValue(tt.in, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = collapseSingleKeyMaps(v, collapsedKeySeparator)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s: got error %v, want %s", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := encoderJSON(t, v); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Package parser is a registry of custom config format parsers used by consul-cfg. Register parsers
+// from init() of a package imported by consul-cfg to add config formats without changing the
+// parsing code.
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Parser parses a custom config format to a map. It should be safe for concurrent use since
+// inputs may be parsed in parallel. Nested maps should be map[string]interface{} and
+// arrays []interface{}. Keys are used as is, unlike built-in formats they are not lower cased.
+type Parser interface {
+	Parse(r io.Reader) (map[string]interface{}, error)
+}
+
+var (
+	// Registered parsers by format name.
+	parsers = make(map[string]Parser)
+	// Format names in registration order.
+	formats []string
+	// Format names by lower cased file extension.
+	exts = make(map[string]string)
+)
+
+// Register registers a parser for a custom format and file extensions used to detect it. Register
+// from init() so that format is available for all commands except tmpl. Panics if format is already
+// registered. Formats which collide with built-in formats are rejected when the CLI starts.
+func Register(name string, p Parser, fileExts ...string) {
+	if _, ok := parsers[name]; ok {
+		panic(fmt.Sprintf("parser for format %s is already registered", name))
+	}
+
+	parsers[name] = p
+	formats = append(formats, name)
+	for _, ext := range fileExts {
+		exts[strings.ToLower(ext)] = name
+	}
+}
+
+// Get returns parser registered for format.
+func Get(name string) (Parser, bool) {
+	p, ok := parsers[name]
+	return p, ok
+}
+
+// Formats returns names of registered formats in registration order.
+func Formats() []string {
+	return append([]string{}, formats...)
+}
+
+// FormatForExt returns format registered for file extension, ex: .env. Extension is case insensitive.
+func FormatForExt(ext string) (string, bool) {
+	name, ok := exts[strings.ToLower(ext)]
+	return name, ok
+}
@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Parser which maps every line to itself.
+type linesParser struct{}
+
+func (linesParser) Parse(r io.Reader) (map[string]interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]interface{})
+	for _, l := range strings.Fields(string(b)) {
+		m[l] = l
+	}
+
+	return m, nil
+}
+
+func TestRegister(t *testing.T) {
+	Register("lines", linesParser{}, ".lines", ".LST")
+
+	p, ok := Get("lines")
+	if !ok {
+		t.Fatal("lines parser isn't registered")
+	}
+	m, err := p.Parse(strings.NewReader("a b"))
+	if err != nil || !reflect.DeepEqual(m, map[string]interface{}{"a": "a", "b": "b"}) {
+		t.Errorf("Parse() = %v, %v", m, err)
+	}
+
+	if _, ok := Get("unknown"); ok {
+		t.Error("unknown format is registered")
+	}
+
+	for _, ext := range []string{".lines", ".lst", ".Lines"} {
+		if name, ok := FormatForExt(ext); !ok || name != "lines" {
+			t.Errorf("FormatForExt(%q) = %q, %v", ext, name, ok)
+		}
+	}
+
+	if got := Formats(); !reflect.DeepEqual(got, []string{"lines"}) {
+		t.Errorf("Formats() = %q", got)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("registering a format twice didn't panic")
+		}
+	}()
+	Register("lines", linesParser{})
+}
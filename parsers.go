@@ -0,0 +1,23 @@
+// Custom input format parsers of the parser package.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/vividvilla/consul-cfg/parser"
+)
+
+// Format names of built-in and registered custom parsers.
+func inputFormats() []string {
+	return append(append([]string{}, kvBuiltinFormats...), parser.Formats()...)
+}
+
+// Panic if a registered custom format has the name of a built-in format.
+func checkParserFormats() {
+	for _, name := range parser.Formats() {
+		if isValidInputFormat(name, kvBuiltinFormats) {
+			panic(fmt.Sprintf("parser for format %s is already registered", name))
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/vividvilla/consul-cfg/parser"
+)
+
+func init() {
+	parser.Register("colon", colonParser{}, ".colon")
+}
+
+// Parser for lines of `key: value` without any nesting or types.
+type colonParser struct{}
+
+func (colonParser) Parse(r io.Reader) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if kv := strings.SplitN(scanner.Text(), ":", 2); len(kv) == 2 {
+			m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+
+	return m, scanner.Err()
+}
+
+func TestCustomParser(t *testing.T) {
+	config := writeTestFile(t, "app.colon", "Host: localhost\nport: 8080\n")
+	want := "myconfig/Host=\"localhost\"\nmyconfig/port=\"8080\""
+
+	// Format is detected from the registered extension.
+	if got := pairLines(t, testKVPairs(t, "--prefix", "myconfig", config)); got != want {
+		t.Errorf("detected format: got\n%s\nwant\n%s", got, want)
+	}
+
+	// Registered formats are valid for --type and section markers.
+	stdin := "#--- type=colon prefix=myconfig ---\nHost: localhost\nport: 8080\n"
+	stdout, stderr, code := runCLI(t, stdin, "kv", "--output-format", "json")
+	if code != 0 {
+		t.Fatalf("section marker: exit code %d, stderr %s", code, stderr)
+	}
+	if !strings.Contains(stdout, `"key": "myconfig/Host"`) || !strings.Contains(stdout, `"key": "myconfig/port"`) {
+		t.Errorf("section marker: got\n%s", stdout)
+	}
+
+	if !isValidInputFormat("colon", inputFormats()) {
+		t.Errorf("colon isn't in input formats %q", inputFormats())
+	}
+}
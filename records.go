@@ -0,0 +1,162 @@
+// Record oriented inputs (CSV and JSON lines) and per record prefixes.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/vividvilla/consul-cfg/parser"
+)
+
+func init() {
+	parser.Register("csv", csvParser{}, ".csv")
+	parser.Register("jsonl", jsonlParser{}, ".jsonl", ".ndjson")
+}
+
+// Name of field with index of the record in prefix template context.
+const recordIndexField = "_index"
+
+// Compiled `--record-prefix-template`.
+var recordPrefixTmpl *template.Template
+
+// Parser for CSV files. First row is the header with field names and every other row is a record.
+// All values are strings. Records are keyed by their index, ex: 0/name.
+type csvParser struct{}
+
+func (csvParser) Parse(r io.Reader) (map[string]interface{}, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return map[string]interface{}{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(header))
+	for _, h := range header {
+		if h == "" || seen[h] {
+			return nil, fmt.Errorf("header has empty or duplicate field %q", h)
+		}
+		seen[h] = true
+	}
+
+	m := make(map[string]interface{})
+	for i := 0; ; i++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rec := make(map[string]interface{}, len(header))
+		for j, h := range header {
+			rec[h] = row[j]
+		}
+		m[strconv.Itoa(i)] = rec
+	}
+
+	return m, nil
+}
+
+// Parser for JSON lines files. Every non empty line is a JSON object which is a record.
+// Records are keyed by their index, ex: 0/name.
+type jsonlParser struct{}
+
+func (jsonlParser) Parse(r io.Reader) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for n, i := 1, 0; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		// Numbers are kept as their literal, same as JSON inputs.
+		v, err := decodeJSONValue(string(line), true)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: record should be a JSON object - %v", n, err)
+		}
+		rec, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("line %d: record should be a JSON object", n)
+		}
+
+		m[strconv.Itoa(i)] = rec
+		i++
+	}
+
+	return m, scanner.Err()
+}
+
+// Check if format is record oriented.
+func isRecordFormat(cType string) bool {
+	return cType == "csv" || cType == "jsonl"
+}
+
+// Move every record of parsed record input under the prefix rendered from template with the record's
+// fields. Ex: users/{{.id}} => users/42/name. Rendered prefix is split into segments by delimiter.
+func prefixRecords(m map[string]interface{}, tmpl *template.Template, delimiter string) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	prefixes := make(map[string]int, len(m))
+	for i := 0; i < len(m); i++ {
+		rec, ok := m[strconv.Itoa(i)].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("record %d is not a map", i)
+		}
+
+		ctx := make(map[string]interface{}, len(rec)+1)
+		for k, v := range rec {
+			ctx[k] = v
+		}
+		ctx[recordIndexField] = i
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, ctx); err != nil {
+			return nil, fmt.Errorf("record %d - %v", i, err)
+		}
+
+		prefix := trimDelimiter(strings.TrimSpace(buf.String()), delimiter)
+		if prefix == "" {
+			return nil, fmt.Errorf("record %d has an empty prefix", i)
+		}
+		if j, ok := prefixes[prefix]; ok {
+			return nil, fmt.Errorf("records %d and %d have the same prefix %s", j, i, prefix)
+		}
+		prefixes[prefix] = i
+
+		segments := strings.Split(prefix, delimiter)
+		parent := out
+		for n, seg := range segments[:len(segments)-1] {
+			if j, ok := prefixes[strings.Join(segments[:n+1], delimiter)]; ok {
+				return nil, fmt.Errorf("prefix %s of record %d is under prefix of record %d", prefix, i, j)
+			}
+
+			child, ok := parent[seg]
+			if !ok {
+				child = make(map[string]interface{})
+				parent[seg] = child
+			}
+
+			parent = child.(map[string]interface{})
+		}
+
+		last := segments[len(segments)-1]
+		if _, ok := parent[last]; ok {
+			return nil, fmt.Errorf("prefix %s of record %d overlaps with another record", prefix, i)
+		}
+		parent[last] = rec
+	}
+
+	return out, nil
+}
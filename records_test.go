@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestRecordPrefixTemplate(t *testing.T) {
+	users := writeTestFile(t, "users.csv", "id,name,team\n42,Ann,payments\n7,Bob,web\n")
+
+	pairs := testKVPairs(t, "--prefix", "app", "--record-prefix-template", "users/{{.team}}/{{.id}}", users)
+	want := `app/users/payments/42/id="42"
+app/users/payments/42/name="Ann"
+app/users/payments/42/team="payments"
+app/users/web/7/id="7"
+app/users/web/7/name="Bob"
+app/users/web/7/team="web"`
+	if got := pairLines(t, pairs); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Without template records are under their index.
+	if got := pairLines(t, testKVPairs(t, users)); !strings.HasPrefix(got, "0/id=\"42\"\n0/name=\"Ann\"") {
+		t.Errorf("records without template:\n%s", got)
+	}
+
+	// Values of JSON lines keep their types and index is in the context.
+	events := writeTestFile(t, "events.jsonl", "{\"kind\": \"deploy\", \"ok\": true}\n\n{\"kind\": \"rollback\", \"ok\": false}\n")
+	pairs = testKVPairs(t, "--record-prefix-template", "events/{{._index}}-{{.kind}}", events)
+	want = "events/0-deploy/kind=\"deploy\"\nevents/0-deploy/ok=true\nevents/1-rollback/kind=\"rollback\"\nevents/1-rollback/ok=false"
+	if got := pairLines(t, pairs); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	_, stderr, code := runCLI(t, "", "kv", "--record-prefix-template", "users/{{.email}}", users)
+	if code == 0 || !strings.Contains(stderr, "error getting record prefix in "+users+" - record 0") {
+		t.Errorf("missing field: code = %d, stderr = %s", code, stderr)
+	}
+}
+
+func TestPrefixRecordsConflicts(t *testing.T) {
+	records := map[string]interface{}{
+		"0": map[string]interface{}{"id": "1", "group": "a"},
+		"1": map[string]interface{}{"id": "2", "group": "a"},
+		"2": map[string]interface{}{"id": "", "group": "b"},
+	}
+
+	tests := map[string]string{
+		"{{.group}}": "records 0 and 1 have the same prefix a",
+		"{{.id}}":    "record 2 has an empty prefix",
+		"{{if eq .id \"1\"}}a{{else}}a/{{.id}}{{end}}": "prefix a/2 of record 1 is under prefix of record 0",
+	}
+	for text, want := range tests {
+		tmpl := template.Must(template.New("record-prefix").Option("missingkey=error").Parse(text))
+		if _, err := prefixRecords(records, tmpl, "/"); err == nil || err.Error() != want {
+			t.Errorf("%s: error = %v, want %s", text, err, want)
+		}
+	}
+
+	// Trailing delimiter of an empty field is trimmed.
+	m, err := prefixRecords(records, template.Must(template.New("record-prefix").Parse("{{.group}}/{{.id}}")), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := encoderJSON(t, m); got != `{"a":{"1":{"group":"a","id":"1"},"2":{"group":"a","id":"2"}},"b":{"group":"b","id":""}}` {
+		t.Errorf("got %s", got)
+	}
+}
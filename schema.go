@@ -0,0 +1,242 @@
+// Infer JSON Schema from config structure.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// JSON Schema version of generated schema.
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// Inferred schema of a value.
+type jsonSchema struct {
+	// Sorted JSON types of the value.
+	types      []string
+	format     string
+	properties map[string]*jsonSchema
+	required   []string
+	items      *jsonSchema
+}
+
+// Run schema command.
+func runSchemaCmd(cmd *cobra.Command, args []string) {
+	if schemaInputType != "" && !isValidInputFormat(schemaInputType, inputFormats()) {
+		errLog.Fatalf("Invalid input file format - %s. Available options are: %s", schemaInputType, formatsToString(inputFormats()))
+	}
+
+	if len(args) == 0 && schemaInputType == "" {
+		errLog.Fatalf("Error: input format type is required for stdin")
+	}
+
+	var inputs []configInput
+	if len(args) == 0 {
+		inputs = append(inputs, configInput{name: "stdin", cType: schemaInputType, r: os.Stdin})
+	}
+
+	for _, fname := range args {
+		cType, err := inputType(fname, schemaInputType)
+		if err != nil {
+			errLog.Fatalf("Error: %v", err)
+		}
+
+		f, err := openInput(fname)
+		if err != nil {
+			errLog.Fatalf("Error: error opening input file - %v", err)
+		}
+
+		inputs = append(inputs, configInput{name: fname, cType: cType, r: f})
+	}
+	cleanupInputs()
+
+	// Schema of every input is merged, so keys are required only if they are in all inputs.
+	var s *jsonSchema
+	for _, in := range inputs {
+		// Parsed same as kv command, so JSON integers are told apart from floats.
+		m, err := parseConfig(in.cType, in.r, false)
+		if err != nil {
+			errLog.Fatalf("Error: error parsing input %s - %v", in.name, err)
+		}
+
+		// Settings table is not part of the config.
+		delete(m, reservedSettingsKey)
+
+		s = mergeSchemas(s, inferSchema(m))
+	}
+
+	out, err := json.MarshalIndent(s.toJSON(true), "", "  ")
+	if err != nil {
+		errLog.Fatalf("error marshelling output: %v", err)
+	}
+
+	if err := writeOutput(schemaOutput, string(out)); err != nil {
+		errLog.Fatalf("Error: error writing output - %v", err)
+	}
+}
+
+// Infer schema of a value. All keys of maps are required and schema of array items is merged from all items.
+func inferSchema(v interface{}) *jsonSchema {
+	switch t := v.(type) {
+	case nil:
+		return &jsonSchema{types: []string{"null"}}
+
+	case string:
+		return &jsonSchema{types: []string{"string"}}
+
+	case bool:
+		return &jsonSchema{types: []string{"boolean"}}
+
+	case time.Time:
+		return &jsonSchema{types: []string{"string"}, format: "date-time"}
+
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return &jsonSchema{types: []string{"integer"}}
+
+	case float32, float64:
+		return &jsonSchema{types: []string{"number"}}
+
+	// Numbers of JSON inputs are integers if they have no fraction or exponent.
+	case json.Number:
+		if strings.ContainsAny(string(t), ".eE") {
+			return &jsonSchema{types: []string{"number"}}
+		}
+		return &jsonSchema{types: []string{"integer"}}
+
+	case map[string]interface{}:
+		s := &jsonSchema{types: []string{"object"}, properties: make(map[string]*jsonSchema, len(t))}
+		for k, val := range t {
+			s.properties[k] = inferSchema(val)
+			s.required = append(s.required, k)
+		}
+		sort.Strings(s.required)
+		return s
+
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprintf("%v", k)] = val
+		}
+		return inferSchema(m)
+	}
+
+	// Arrays of any type.
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		s := &jsonSchema{types: []string{"array"}}
+		for i := 0; i < rv.Len(); i++ {
+			s.items = mergeSchemas(s.items, inferSchema(rv.Index(i).Interface()))
+		}
+		return s
+	}
+
+	// Any other value is left unconstrained.
+	return &jsonSchema{}
+}
+
+// Merge two schemas so that values of both are valid. Types are combined, integer is widened
+// to number and only keys required in both are required.
+func mergeSchemas(a, b *jsonSchema) *jsonSchema {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	// Unconstrained schema accepts any value.
+	if len(a.types) == 0 || len(b.types) == 0 {
+		return &jsonSchema{}
+	}
+
+	s := &jsonSchema{}
+	set := make(map[string]bool)
+	for _, t := range append(append([]string{}, a.types...), b.types...) {
+		set[t] = true
+	}
+	if set["number"] {
+		delete(set, "integer")
+	}
+	for t := range set {
+		s.types = append(s.types, t)
+	}
+	sort.Strings(s.types)
+
+	if a.format == b.format {
+		s.format = a.format
+	}
+
+	if a.properties != nil || b.properties != nil {
+		s.properties = make(map[string]*jsonSchema)
+		for k, p := range a.properties {
+			s.properties[k] = mergeSchemas(p, b.properties[k])
+		}
+		for k, p := range b.properties {
+			if _, ok := a.properties[k]; !ok {
+				s.properties[k] = p
+			}
+		}
+
+		// Keys are required only if both values are objects having the key.
+		if a.properties != nil && b.properties != nil {
+			req := make(map[string]bool)
+			for _, k := range a.required {
+				req[k] = true
+			}
+			for _, k := range b.required {
+				if req[k] {
+					s.required = append(s.required, k)
+				}
+			}
+		}
+	}
+
+	s.items = mergeSchemas(a.items, b.items)
+	return s
+}
+
+// Convert schema to JSON value. Root schema has the `$schema` keyword.
+func (s *jsonSchema) toJSON(root bool) map[string]interface{} {
+	out := make(map[string]interface{})
+	if s == nil {
+		return out
+	}
+
+	if root {
+		out["$schema"] = jsonSchemaDraft
+	}
+
+	if len(s.types) == 1 {
+		out["type"] = s.types[0]
+	} else if len(s.types) > 1 {
+		out["type"] = s.types
+	}
+
+	if s.format != "" {
+		out["format"] = s.format
+	}
+
+	if s.properties != nil {
+		props := make(map[string]interface{}, len(s.properties))
+		for k, p := range s.properties {
+			props[k] = p.toJSON(false)
+		}
+		out["properties"] = props
+	}
+
+	if len(s.required) > 0 {
+		out["required"] = s.required
+	}
+
+	if s.items != nil {
+		out["items"] = s.items.toJSON(false)
+	}
+
+	return out
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSchemaCommand(t *testing.T) {
+	stdout, stderr, code := runCLI(t, "", "schema", filepath.Join("testdata", "config.toml"))
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	assertGolden(t, "schema", stdout)
+}
+
+func TestSchemaMergedInputs(t *testing.T) {
+	// Keys missing in an input are optional and integer and float values are numbers. Keys of objects
+	// missing in an input are required only when the object is given.
+	prod := writeTestFile(t, "prod.yaml", "name: app\nratio: 1\nreplicas: [1, 2]\ndb:\n  host: pg\n  port: 5432\n")
+	dev := writeTestFile(t, "dev.json", `{"name": "app", "ratio": 0.5, "replicas": [], "db": {"host": "pg2"}, "debug": true, "cache": {"ttl": 5}}`)
+
+	stdout, stderr, code := runCLI(t, "", "schema", prod, dev)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	assertGolden(t, "schema-merged", stdout)
+}
@@ -0,0 +1,136 @@
+// Heuristic detection of secrets in values.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Value looks like a secret.
+	warnSecret = "secret"
+
+	// Min length and entropy (bits per character) of a string to be considered random.
+	secretMinLength  = 20
+	secretMinEntropy = 4.0
+)
+
+// Key names which usually hold secrets.
+var secretKeyNames = []string{"password", "passwd", "secret", "token", "apikey", "api_key", "api-key", "privatekey", "private_key", "private-key", "credential"}
+
+// Compiled `--detect-secrets-ignore` globs.
+var secretIgnorePatterns []*regexp.Regexp
+
+// Compiled `--externalize-secrets` globs.
+var externalizePatterns []*regexp.Regexp
+
+// Externalized secret values by their Vault path relative to the mount.
+var externalSecrets = make(map[string]interface{})
+
+// Keys of pairs written on purpose by conversion options instead of from config values: parent indexes,
+// doc and checksum sidecars and references of externalized secrets. They aren't checked for secrets.
+var sidecarKeys = make(map[string]bool)
+
+// Add warnings for values which look like secrets. Sidecar keys are skipped.
+func detectSecrets(pairs []consulKVPair) {
+	for _, p := range pairs {
+		if sidecarKeys[p.Key] || ignoreSecret(p.Key) {
+			continue
+		}
+
+		v, err := pairPlainValue(p)
+		if err != nil || v == "" || v == "null" {
+			continue
+		}
+
+		if name := secretKeyName(p.Key); name != "" {
+			addWarning(warnSecret, "key %s looks like a secret since its name contains %q", p.Key, name)
+		} else if len(v) >= secretMinLength && shannonEntropy(v) >= secretMinEntropy {
+			addWarning(warnSecret, "value of key %s looks like a secret since it's a high entropy string", p.Key)
+		}
+	}
+}
+
+// Get secret like name contained in last segment of the key.
+func secretKeyName(key string) string {
+	seg := strings.ToLower(key[strings.LastIndex(key, kvDelimiter)+1:])
+	for _, n := range secretKeyNames {
+		if strings.Contains(seg, n) {
+			return n
+		}
+	}
+
+	return ""
+}
+
+// Check if key is ignored for secret detection.
+func ignoreSecret(key string) bool {
+	for _, re := range secretIgnorePatterns {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Shannon entropy of the string in bits per character.
+func shannonEntropy(s string) float64 {
+	freq := make(map[rune]float64)
+	var n float64
+	for _, r := range s {
+		freq[r]++
+		n++
+	}
+
+	var e float64
+	for _, c := range freq {
+		p := c / n
+		e -= p * math.Log2(p)
+	}
+
+	return e
+}
+
+// Replace value of key matching externalize patterns with a consul-template reference to the
+// secret in Vault KV v2 and keep the value to be written to the secrets file. Vault path is the
+// key with segments joined by `/`. Ex: db/password => {{ with secret "secret/data/db/password" }}{{ .Data.data.value }}{{ end }}
+func externalizeSecret(key string, v interface{}, delimiter string) (string, bool) {
+	matched := false
+	for _, re := range externalizePatterns {
+		if re.MatchString(key) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return "", false
+	}
+
+	path := strings.Join(splitKey(trimDelimiter(key, delimiter), delimiter), "/")
+	externalSecrets[path] = v
+
+	ref := strings.Trim(kvVaultMount, "/") + "/data/" + path
+	return fmt.Sprintf("{{ with secret %s }}{{ .Data.data.value }}{{ end }}", strconv.Quote(ref)), true
+}
+
+// Write externalized secrets as a JSON object of Vault paths and their data. File is only readable by the owner.
+func writeSecretsFile(fPath string) error {
+	data := make(map[string]map[string]interface{}, len(externalSecrets))
+	for path, v := range externalSecrets {
+		data[path] = map[string]interface{}{"value": v}
+	}
+
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fPath, b, 0600)
+}
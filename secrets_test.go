@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Convert inputs with args and secret detection, and get keys with secret warnings.
+func testSecretKeys(t *testing.T, args ...string) []string {
+	t.Helper()
+
+	checkKVPairs(testKVPairs(t, append([]string{"--detect-secrets"}, args...)...))
+
+	var keys []string
+	for _, w := range warnings {
+		if w.category == warnSecret {
+			// Messages are of form `key <key> looks ...` or `value of key <key> looks ...`.
+			keys = append(keys, strings.Fields(strings.TrimPrefix(w.message, "value of "))[1])
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func TestDetectSecrets(t *testing.T) {
+	fPath := writeTestFile(t, "config.toml", `host = "db.internal"
+url = "https://example.com/a/b"
+password = "hunter2"
+empty_password = ""
+sha = "3f2a9c1b7d4e5f60718293a4b5c6d7e8"
+random = "x9K2pQ7vL4mZ8nR1tW6yB3cF5hJ0"
+
+[aws]
+Secret_Access_Key = "abc"
+api-key = "abc"
+`)
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"secret names and high entropy values", []string{fPath}, []string{"aws/api-key", "aws/secret_access_key", "password", "random"}},
+		{"ignored keys", []string{"--detect-secrets-ignore", "random,aws/**", fPath}, []string{"password"}},
+	}
+
+	for _, tt := range tests {
+		if got := strings.Join(testSecretKeys(t, tt.args...), ","); got != strings.Join(tt.want, ",") {
+			t.Errorf("%s: secret keys = %s, want %s", tt.name, got, strings.Join(tt.want, ","))
+		}
+	}
+}
+
+func TestDetectSecretsSkipsSidecarKeys(t *testing.T) {
+	fPath := writeTestFile(t, "config.toml", `# Password of the admin user, rotated by ops.
+admin_password = "hunter2"
+
+[credentials]
+user = "admin"
+`)
+	secrets := filepath.Join(t.TempDir(), "secrets.json")
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		// Only the real value is a secret, not its checksum, doc or the parent index of credentials.
+		{"sidecars of secret", []string{"--with-checksum", "--preserve-comments-as-metadata", "--emit-parents-as-index", fPath},
+			"admin_password"},
+		// Externalized secrets are template references to Vault.
+		{"externalized", []string{"--externalize-secrets", "admin_password", "--secrets-file", secrets, fPath}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := strings.Join(testSecretKeys(t, tt.args...), ","); got != tt.want {
+			t.Errorf("%s: secret keys = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// Run doesn't fail on sidecar keys with warnings as errors.
+	args := []string{"kv", "--detect-secrets", "--warnings-as-errors", "--externalize-secrets", "admin_password", "--secrets-file", secrets,
+		"--with-checksum", "--preserve-comments-as-metadata", "--emit-parents-as-index", fPath}
+	if _, stderr, code := runCLI(t, "", args...); code != 0 {
+		t.Errorf("exit code = %d, stderr: %s", code, stderr)
+	}
+}
+
+func TestExternalizeSecrets(t *testing.T) {
+	fPath := writeTestFile(t, "config.toml", `
+[db]
+host = "db.internal"
+password = "hunter2"
+pin = 1234
+
+[api]
+token = "abc"
+`)
+	secrets := filepath.Join(t.TempDir(), "secrets.json")
+
+	pairs := testKVPairs(t, "--prefix", "billing", "--externalize-secrets", "**/password,**/pin,**/token",
+		"--vault-mount", "/kv/", "--secrets-file", secrets, fPath)
+
+	// Secrets are references to their value in Vault under the full key, other values are as is.
+	want := `billing/api/token={{ with secret "kv/data/billing/api/token" }}{{ .Data.data.value }}{{ end }}
+billing/db/host="db.internal"
+billing/db/password={{ with secret "kv/data/billing/db/password" }}{{ .Data.data.value }}{{ end }}
+billing/db/pin={{ with secret "kv/data/billing/db/pin" }}{{ .Data.data.value }}{{ end }}`
+	if got := pairLines(t, pairs); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	b, err := ioutil.ReadFile(secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data map[string]map[string]interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatal(err)
+	}
+	wantData := map[string]map[string]interface{}{
+		"billing/api/token":   {"value": "abc"},
+		"billing/db/password": {"value": "hunter2"},
+		"billing/db/pin":      {"value": float64(1234)},
+	}
+	if !reflect.DeepEqual(data, wantData) {
+		t.Errorf("secrets file = %v, want %v", data, wantData)
+	}
+	if fi, err := os.Stat(secrets); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("secrets file should only be readable by owner, got %v %v", fi.Mode(), err)
+	}
+
+	_, stderr, code := runCLI(t, "", "kv", "--externalize-secrets", "**/password", fPath)
+	if code == 0 || !strings.Contains(stderr, "--secrets-file is required with --externalize-secrets") {
+		t.Errorf("without secrets file: code = %d, stderr = %s", code, stderr)
+	}
+}
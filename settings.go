@@ -0,0 +1,231 @@
+// Per input conversion settings.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Reserved top level table in config which holds conversion settings. It is never written as KV pairs.
+const reservedSettingsKey = "_consul_cfg"
+
+// Number of hex characters of content hash used as prefix.
+const contentHashLength = 12
+
+// Get hostname of the machine. Variable so that it can be replaced.
+var osHostname = os.Hostname
+
+// Conversion settings for an input. Defaults are taken from command line flags.
+type kvSettings struct {
+	prefix    string
+	delimiter string
+	flags     uint64
+	// Document order of keys of the value being traversed. Nil if not known.
+	order *keyOrder
+	// Pairs are written by a conversion option instead of from config values, ex: parent indexes.
+	sidecar bool
+}
+
+// Get conversion settings for given config map. Settings from the reserved table are used
+// unless the same option is given in command line. Reserved table is removed from the map.
+func inputSettings(cmd *cobra.Command, m map[string]interface{}) (kvSettings, error) {
+	s := kvSettings{
+		prefix:    kvKeyPrefix,
+		delimiter: kvDelimiter,
+		flags:     kvFlags,
+	}
+
+	v, ok := m[reservedSettingsKey]
+	if !ok {
+		return s, nil
+	}
+	delete(m, reservedSettingsKey)
+
+	r, ok := v.(map[string]interface{})
+	if !ok {
+		return s, fmt.Errorf("%s should be a table", reservedSettingsKey)
+	}
+
+	for k, v := range r {
+		switch k {
+		case "prefix", "delimiter":
+			str, ok := v.(string)
+			if !ok {
+				return s, fmt.Errorf("%s.%s should be a string", reservedSettingsKey, k)
+			}
+
+			if k == "prefix" && !cmd.Flags().Changed("prefix") {
+				s.prefix = str
+			} else if k == "delimiter" && !cmd.Flags().Changed("delimiter") {
+				s.delimiter = str
+			}
+
+		case "flags":
+			f, err := toUint64(v)
+			if err != nil {
+				return s, fmt.Errorf("%s.flags should be an unsigned integer", reservedSettingsKey)
+			}
+
+			if !cmd.Flags().Changed("flags") {
+				s.flags = f
+			}
+
+		default:
+			return s, fmt.Errorf("unknown option in %s: %s", reservedSettingsKey, k)
+		}
+	}
+
+	if s.delimiter == "" {
+		return s, fmt.Errorf("delimiter can't be empty")
+	}
+
+	return s, nil
+}
+
+// Get prefix from value of a key in config map. Key path is dot separated, ex: app.name. Segments are
+// matched case insensitively since only some formats lower case keys, ex: dotenv keeps the case.
+// Key is removed from the map if remove is set.
+func prefixFromKey(m map[string]interface{}, keyPath string, remove bool) (string, error) {
+	segments := strings.Split(keyPath, ".")
+	parent := m
+	for _, seg := range segments[:len(segments)-1] {
+		k, err := lookupKeyFold(parent, seg, keyPath)
+		if err != nil {
+			return "", err
+		}
+
+		child, ok := parent[k].(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("key %s not found", keyPath)
+		}
+		parent = child
+	}
+
+	last, err := lookupKeyFold(parent, segments[len(segments)-1], keyPath)
+	if err != nil {
+		return "", err
+	}
+	v := parent[last]
+
+	// Only scalar values can be used as prefix.
+	switch v.(type) {
+	case string, bool, int, int64, uint64, float64, json.Number:
+	default:
+		return "", fmt.Errorf("key %s should have a scalar value", keyPath)
+	}
+
+	if remove {
+		delete(parent, last)
+	}
+
+	return fmt.Sprintf("%v", v), nil
+}
+
+// Get key of map matching segment of key path. Exact match is preferred, else the only key which
+// matches ignoring case. Fails if more than one key matches ignoring case.
+func lookupKeyFold(m map[string]interface{}, seg string, keyPath string) (string, error) {
+	if _, ok := m[seg]; ok {
+		return seg, nil
+	}
+
+	var matches []string
+	for k := range m {
+		if strings.EqualFold(k, seg) {
+			matches = append(matches, k)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("key %s not found", keyPath)
+	case 1:
+		return matches[0], nil
+	}
+
+	sort.Strings(matches)
+	return "", fmt.Errorf("key %s is ambiguous, %s match ignoring case", keyPath, strings.Join(matches, ", "))
+}
+
+// Get sanitized hostname of the machine to use as prefix. Hostname is lower cased, characters other than
+// letters, digits, `.`, `-` and `_` and the delimiter are replaced with `-` and leading and trailing `-` are trimmed.
+func hostnamePrefix(delimiter string) (string, error) {
+	h, err := osHostname()
+	if err != nil {
+		return "", err
+	}
+
+	h = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '-'
+	}, strings.ToLower(h))
+
+	if delimiter != "" {
+		h = strings.Replace(h, delimiter, "-", -1)
+	}
+
+	if h = strings.Trim(h, "-"); h == "" {
+		return "", fmt.Errorf("hostname is empty after sanitizing")
+	}
+
+	return h, nil
+}
+
+// Get SHA-256 of content of all inputs in order, truncated to content hash length. Content of every
+// input is prefixed with its length, so moving bytes between inputs changes the hash. Inputs are
+// read fully and replaced with in-memory readers.
+func inputsContentHash(inputs []configInput) (string, error) {
+	h := sha256.New()
+	for i, in := range inputs {
+		b, err := ioutil.ReadAll(in.r)
+		if err != nil {
+			return "", err
+		}
+		inputs[i].r = bytes.NewReader(b)
+
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(b)))
+		h.Write(n[:])
+		h.Write(b)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:contentHashLength], nil
+}
+
+// Add a marker pair with empty string value at prefix of every settings if no pair is at or under the
+// prefix. Marker is added same as converted pairs, so key and value options apply to it. Empty prefixes
+// get no marker.
+func ensurePrefixKeys(pairs *[]consulKVPair, settings []kvSettings) {
+	for _, s := range settings {
+		prefix := trimDelimiter(s.prefix, s.delimiter)
+		if prefix == "" || hasPairUnder(*pairs, prefix, s.delimiter) {
+			continue
+		}
+
+		appendKVPair(pairs, prefix, "", s)
+	}
+}
+
+// Check if any pair is at or under path prefix.
+func hasPairUnder(pairs []consulKVPair, prefix string, delimiter string) bool {
+	for _, p := range pairs {
+		if hasPathPrefix(p.Key, prefix, delimiter) {
+			return true
+		}
+	}
+
+	return false
+}
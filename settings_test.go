@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrefixFromKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       map[string]interface{}
+		keyPath string
+		want    string
+		err     bool
+	}{
+		{"lower cased keys", map[string]interface{}{"app": map[string]interface{}{"name": "billing"}}, "App.Name", "billing", false},
+		{"keys with case", map[string]interface{}{"APP_NAME": "billing"}, "app_name", "billing", false},
+		{"nested keys with case", map[string]interface{}{"App": map[string]interface{}{"Name": "billing"}}, "app.name", "billing", false},
+		{"exact match wins", map[string]interface{}{"Name": "a", "NAME": "b"}, "NAME", "b", false},
+		{"ambiguous", map[string]interface{}{"Name": "a", "NAME": "b"}, "name", "", true},
+		{"missing", map[string]interface{}{"app": "x"}, "app.name", "", true},
+		{"not scalar", map[string]interface{}{"app": map[string]interface{}{}}, "app", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := prefixFromKey(tt.m, tt.keyPath, true)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: prefix = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPrefixFromKeyDotenv(t *testing.T) {
+	fPath := filepath.Join(t.TempDir(), "app.env")
+	if err := ioutil.WriteFile(fPath, []byte("APP_NAME=billing\nPORT=8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pairs := testKVPairs(t, "--prefix-from-key", "app_name", "--prefix-from-key-remove", fPath)
+	if len(pairs) != 1 || pairs[0].Key != "billing/PORT" {
+		t.Errorf("pairs = %v, want only billing/PORT", pairs)
+	}
+}
+
+func TestEnsurePrefixKey(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		t.Helper()
+		fPath := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(fPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return fPath
+	}
+	empty := write("empty.toml", "")
+	settings := write("settings.toml", "[_consul_cfg]\nprefix = \"svc/a\"\n")
+	app := write("app.toml", "[app]\nname = \"billing\"\n")
+	keyed := write("keyed.toml", "[app]\nname = \"billing\"\n")
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"empty input", []string{"--prefix", "myconfig/app/", empty}, `myconfig/app=""`},
+		{"keys under prefix", []string{"--prefix", "myconfig", empty, app}, `myconfig/app/name="billing"`},
+		{"no prefix", []string{empty}, ""},
+		{"settings table prefix", []string{settings, app}, "app/name=\"billing\"\nsvc/a=\"\""},
+		{"prefix from key", []string{"--prefix-from-key", "app.name", "--prefix-from-key-remove", keyed}, `billing=""`},
+		{"key and value options", []string{"--prefix", "myconfig", "--key-suffix", "v1", "--with-checksum", empty},
+			"myconfig/v1=\"\"\nmyconfig/v1__sum=\"12ae32cb1ec02d01\""},
+	}
+
+	for _, tt := range tests {
+		pairs := testKVPairs(t, append([]string{"--ensure-prefix-key"}, tt.args...)...)
+		if got := pairLines(t, pairs); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	// Marker gets flags of the input.
+	pairs := testKVPairs(t, "--ensure-prefix-key", "--prefix", "myconfig", "--flags", "5", empty)
+	if len(pairs) != 1 || pairs[0].Flags != 5 {
+		t.Errorf("pairs = %v, want marker with flags 5", pairs)
+	}
+
+	// Key filters apply to marker.
+	if pairs := testKVPairs(t, "--ensure-prefix-key", "--prefix", "myconfig", "--ignore-keys-regex", "^myconfig$", empty); len(pairs) != 0 {
+		t.Errorf("pairs = %v, want marker to be skipped", pairs)
+	}
+}
+
+func TestSettingsTable(t *testing.T) {
+	toml := writeTestFile(t, "config.toml", "[_consul_cfg]\nprefix = \"svc/billing\"\ndelimiter = \".\"\nflags = 7\n\n[db]\nhost = \"db.internal\"\n")
+	yaml := writeTestFile(t, "config.yaml", "_consul_cfg:\n  prefix: svc/yaml\ndb:\n  host: db.internal\n")
+	plain := writeTestFile(t, "plain.toml", "[db]\nhost = \"db.internal\"\n")
+
+	tests := []struct {
+		name  string
+		args  []string
+		want  string
+		flags uint64
+	}{
+		{"settings are defaults", []string{toml}, `svc/billing.db.host="db.internal"`, 7},
+		{"command line prefix wins", []string{"--prefix", "cli", toml}, `cli.db.host="db.internal"`, 7},
+		{"command line delimiter wins", []string{"--delimiter", "/", toml}, `svc/billing/db/host="db.internal"`, 7},
+		{"command line flags win", []string{"--flags", "1", toml}, `svc/billing.db.host="db.internal"`, 1},
+		{"yaml settings", []string{yaml}, `svc/yaml/db/host="db.internal"`, 0},
+		{"settings apply only to their file", []string{toml, plain}, "svc/billing.db.host=\"db.internal\"\ndb/host=\"db.internal\"", 7},
+	}
+
+	for _, tt := range tests {
+		pairs := testKVPairs(t, tt.args...)
+		if got := pairLines(t, pairs); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+		if len(pairs) > 0 && pairs[0].Flags != tt.flags {
+			t.Errorf("%s: flags = %d, want %d", tt.name, pairs[0].Flags, tt.flags)
+		}
+	}
+}
+
+func TestSettingsTableErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"not a table", "_consul_cfg = \"x\"\n", "_consul_cfg should be a table"},
+		{"prefix not a string", "[_consul_cfg]\nprefix = 1\n", "_consul_cfg.prefix should be a string"},
+		{"negative flags", "[_consul_cfg]\nflags = -1\n", "_consul_cfg.flags should be an unsigned integer"},
+		{"empty delimiter", "[_consul_cfg]\ndelimiter = \"\"\n", "delimiter can't be empty"},
+		{"unknown option", "[_consul_cfg]\nprefx = \"a\"\n", "unknown option in _consul_cfg: prefx"},
+	}
+
+	for _, tt := range tests {
+		fPath := writeTestFile(t, "config.toml", "port = 1\n"+tt.content)
+		_, stderr, code := runCLI(t, "", "kv", fPath)
+		if code == 0 || !strings.Contains(stderr, "invalid _consul_cfg table in "+fPath+" - "+tt.err) {
+			t.Errorf("%s: exit code %d, stderr %s, want error %q", tt.name, code, stderr, tt.err)
+		}
+	}
+}
+
+// Replace hostname of the machine for the test.
+func setHostname(t *testing.T, name string) {
+	orig := osHostname
+	osHostname = func() (string, error) { return name, nil }
+	t.Cleanup(func() { osHostname = orig })
+}
+
+func TestPrefixFromHostname(t *testing.T) {
+	config := writeTestFile(t, "config.toml", "app = \"billing\"\n\n[agent]\nport = 8500\n")
+
+	tests := []struct {
+		hostname string
+		args     []string
+		want     string
+	}{
+		{"Web-1.dc1", []string{"--prefix", "nodes"}, "nodes/web-1.dc1/agent/port"},
+		{"web 1_(eu)", nil, "web-1_-eu/agent/port"},
+		{"web-1.dc1", []string{"--prefix", "nodes", "--delimiter", "."}, "nodes.web-1-dc1.agent.port"},
+		// Hostname comes before prefix from key.
+		{"node", []string{"--prefix", "nodes", "--prefix-from-key", "app"}, "nodes/node/billing/agent/port"},
+	}
+	for _, tt := range tests {
+		setHostname(t, tt.hostname)
+		pairs := testKVPairs(t, append(append(tt.args, "--prefix-from-hostname"), config)...)
+		var keys []string
+		for _, p := range pairs {
+			keys = append(keys, p.Key)
+		}
+		if !strings.Contains(strings.Join(keys, "\n")+"\n", tt.want+"\n") {
+			t.Errorf("%s %v: keys = %v, want %s", tt.hostname, tt.args, keys, tt.want)
+		}
+	}
+
+	setHostname(t, "---")
+	if _, err := hostnamePrefix("/"); err == nil || !strings.Contains(err.Error(), "hostname is empty after sanitizing") {
+		t.Errorf("empty hostname: err = %v", err)
+	}
+}
+
+func TestPrefixFromContentHash(t *testing.T) {
+	prefixOf := func(args ...string) string {
+		pairs := testKVPairs(t, append([]string{"--prefix", "configs/app", "--prefix-from-content-hash"}, args...)...)
+		return strings.TrimSuffix(pairs[0].Key, "/port")
+	}
+
+	content := "port = 8080\n"
+	a := writeTestFile(t, "a.toml", content)
+	b := filepath.Join(t.TempDir(), "other-name.toml")
+	if err := ioutil.WriteFile(b, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed := writeTestFile(t, "changed.toml", "port = 8081\n")
+
+	// Hash is of the length prefixed content.
+	sum := sha256.Sum256(append([]byte{0, 0, 0, 0, 0, 0, 0, byte(len(content))}, content...))
+	want := "configs/app/" + hex.EncodeToString(sum[:])[:contentHashLength]
+	if got := prefixOf(a); got != want {
+		t.Errorf("prefix = %s, want %s", got, want)
+	}
+
+	// Identical content gets the same prefix regardless of file name and options.
+	if got := prefixOf("--flags", "3", b); got != want {
+		t.Errorf("identical content: prefix = %s, want %s", got, want)
+	}
+	if got := prefixOf(changed); got == want {
+		t.Errorf("changed content has the same prefix %s", got)
+	}
+	if got := prefixOf(a, b); got == want {
+		t.Errorf("two inputs have the same prefix as one %s", got)
+	}
+
+	// Moving bytes between inputs changes the hash.
+	hash := func(contents ...string) string {
+		var inputs []configInput
+		for _, c := range contents {
+			inputs = append(inputs, configInput{r: strings.NewReader(c)})
+		}
+		h, err := inputsContentHash(inputs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	if hash("ab", "c") == hash("a", "bc") {
+		t.Error("moving bytes between inputs doesn't change the hash")
+	}
+}
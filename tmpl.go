@@ -33,7 +33,7 @@ func runTmplCmd(cmd *cobra.Command, args []string) {
 	} else {
 		// Add all files as inputs
 		for _, fname := range args {
-			f, err := os.Open(fname)
+			f, err := openInput(fname)
 			if err != nil {
 				errLog.Fatalf("Error: error opening input file - %v", err)
 			}
@@ -41,6 +41,7 @@ func runTmplCmd(cmd *cobra.Command, args []string) {
 			inputs = append(inputs, f)
 		}
 	}
+	cleanupInputs()
 
 	var out string
 	for _, i := range inputs {
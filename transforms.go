@@ -0,0 +1,165 @@
+// Per key value transforms.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Prefix of template transforms in transform values file.
+const templateTransformPrefix = "t:"
+
+// Value transform applied to values of keys matching the glob.
+type valueTransform struct {
+	keyRe *regexp.Regexp
+
+	// Replacement transform. Ex: s/foo/bar/g
+	re     *regexp.Regexp
+	repl   string
+	global bool
+
+	// Template transform. Ex: t:{{ .Value | printf "%q" }}
+	tmpl *template.Template
+}
+
+// Inputs available to template transforms.
+type valueTransformInput struct {
+	// Full key of the pair.
+	Key string
+	// String value of the pair.
+	Value string
+}
+
+// Transforms loaded from `--transform-values-file`.
+var valueTransforms []*valueTransform
+
+// Load value transforms file. Every line has a key glob and a transform separated by whitespace.
+// Empty lines and lines starting with # are ignored.
+func loadTransformValuesFile(fPath string, delimiter string) error {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.IndexAny(line, " \t")
+		if i == -1 {
+			return fmt.Errorf("line %d: should be of form <key glob> <transform>", n)
+		}
+
+		t, err := parseValueTransform(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+
+		if t.keyRe, err = compileKeyGlob(line[:i], delimiter); err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+
+		valueTransforms = append(valueTransforms, t)
+	}
+
+	return scanner.Err()
+}
+
+// Parse a transform. Replacement transforms are of form s<d>regex<d>replacement<d>[g] where <d> is any
+// delimiter character and template transforms are of form t:<template>.
+func parseValueTransform(s string) (*valueTransform, error) {
+	if strings.HasPrefix(s, templateTransformPrefix) {
+		tmpl, err := template.New("transform").Option("missingkey=error").Parse(strings.TrimPrefix(s, templateTransformPrefix))
+		if err != nil {
+			return nil, err
+		}
+
+		return &valueTransform{tmpl: tmpl}, nil
+	}
+
+	if len(s) < 2 || s[0] != 's' {
+		return nil, fmt.Errorf("invalid transform %s, should be s/regex/replacement/ or t:<template>", s)
+	}
+
+	parts := splitEscaped(s[2:], s[1])
+	if len(parts) != 3 || (parts[2] != "" && parts[2] != "g") {
+		return nil, fmt.Errorf("invalid replacement transform %s, should be s/regex/replacement/ or s/regex/replacement/g", s)
+	}
+
+	re, err := regexp.Compile(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &valueTransform{re: re, repl: parts[1], global: parts[2] == "g"}, nil
+}
+
+// Split string by delimiter. Delimiter escaped with backslash is kept as a literal delimiter.
+func splitEscaped(s string, delim byte) []string {
+	var (
+		parts []string
+		cur   strings.Builder
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == delim:
+			cur.WriteByte(delim)
+			i++
+		case s[i] == delim:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+
+	return append(parts, cur.String())
+}
+
+// Apply the first transform matching the key to a string value. Other values are returned as is.
+func transformValue(key string, v interface{}) (interface{}, error) {
+	str, ok := v.(string)
+	if !ok {
+		return v, nil
+	}
+
+	for _, t := range valueTransforms {
+		if !t.keyRe.MatchString(key) {
+			continue
+		}
+
+		if t.tmpl != nil {
+			var b bytes.Buffer
+			if err := t.tmpl.Execute(&b, valueTransformInput{Key: key, Value: str}); err != nil {
+				return nil, err
+			}
+
+			return b.String(), nil
+		}
+
+		if t.global {
+			return t.re.ReplaceAllString(str, t.repl), nil
+		}
+
+		// Replace only the first match like sed.
+		loc := t.re.FindStringSubmatchIndex(str)
+		if loc == nil {
+			return str, nil
+		}
+
+		return str[:loc[0]] + string(t.re.ExpandString(nil, t.repl, str, loc)) + str[loc[1]:], nil
+	}
+
+	return str, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransformValuesFile(t *testing.T) {
+	config := writeTestFile(t, "config.toml", `
+name = "billing"
+port = 8080
+
+[db]
+host = "pg.old.internal"
+replica = "pg.old.internal"
+
+[urls]
+api = "http://api http://x"
+docs = "http://docs"
+`)
+	transforms := writeTestFile(t, "transforms.txt", `
+# Hosts move to the new domain.
+myconfig/app/db/host s/\.old\.internal$/.new.internal/
+myconfig/app/urls/*  s|http://|https://|g
+myconfig/app/name    t:{{ .Value }}-v2 ({{ .Key }})
+myconfig/app/port    t:ignored
+myconfig/app/**      s/old/first-match-wins/
+`)
+
+	got := pairLines(t, testKVPairs(t, "--prefix", "myconfig/app", "--transform-values-file", transforms, config))
+	want := strings.Join([]string{
+		`myconfig/app/db/host="pg.new.internal"`,
+		`myconfig/app/db/replica="pg.first-match-wins.internal"`,
+		`myconfig/app/name="billing-v2 (myconfig/app/name)"`,
+		`myconfig/app/port=8080`,
+		`myconfig/app/urls/api="https://api https://x"`,
+		`myconfig/app/urls/docs="https://docs"`,
+	}, "\n")
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseValueTransform(t *testing.T) {
+	tests := []struct {
+		transform string
+		value     string
+		want      string
+	}{
+		{"s/a/b/", "aaa", "baa"},
+		{"s/a/b/g", "aaa", "bbb"},
+		{`s/(\w+)@(\w+)/$2 at $1/`, "user@host", "host at user"},
+		{`s/\//-/g`, "a/b/c", "a-b-c"},
+		{"s#/#-#", "a/b", "a-b"},
+		{"s/x/y/", "none", "none"},
+		{`t:{{ printf "%q" .Value }}`, "v", `"v"`},
+	}
+	for _, tt := range tests {
+		tr, err := parseValueTransform(tt.transform)
+		if err != nil {
+			t.Errorf("%s: %v", tt.transform, err)
+			continue
+		}
+
+		tr.keyRe, _ = compileKeyGlob("**", "/")
+		valueTransforms = []*valueTransform{tr}
+		got, err := transformValue("k", tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("%s on %q = %v, %v, want %q", tt.transform, tt.value, got, err, tt.want)
+		}
+	}
+	valueTransforms = nil
+
+	for _, s := range []string{"x/a/b/", "s/a/b", "s/a/b/x", "s/(/b/", "t:{{ .Value", "s"} {
+		if _, err := parseValueTransform(s); err == nil {
+			t.Errorf("expected error for %s", s)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// Sidecar file with original types of values.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// Original kind of value of every emitted key. Ex: db/port => int
+var typeMap = make(map[string]string)
+
+// Write type map as a JSON object of keys and their kinds. Keys are sorted.
+func writeTypeMapFile(fPath string) error {
+	b, err := json.MarshalIndent(typeMap, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fPath, b, 0644)
+}
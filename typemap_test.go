@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Restore typed value from value written to Consul and its kind in type map as a consumer would.
+func restoreTypedValue(raw string, kind string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "int":
+		return v.(json.Number).Int64()
+	case "float":
+		return v.(json.Number).Float64()
+	case "datetime":
+		return time.Parse(time.RFC3339, v.(string))
+	case "string", "bool", "null", "array", "map":
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("unknown kind %s", kind)
+}
+
+func TestTypeMapRoundTrip(t *testing.T) {
+	fPath := writeTestFile(t, "config.toml", `name = "billing"
+port = 8080
+ratio = 2.0
+enabled = true
+started = 2024-01-02T03:04:05Z
+tags = ["a", "b"]
+
+[db]
+timeout = 1.5
+`)
+	typesFile := filepath.Join(t.TempDir(), "types.json")
+
+	pairs := testKVPairs(t, "--prefix", "billing", "--with-checksum", "--emit-type-map", typesFile, fPath)
+
+	b, err := ioutil.ReadFile(typesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types map[string]string
+	if err := json.Unmarshal(b, &types); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]interface{})
+	for _, p := range pairs {
+		kind, ok := types[p.Key]
+		if !ok {
+			// Only checksum sidecars aren't typed.
+			if !strings.HasSuffix(p.Key, checksumKeySuffix) {
+				t.Errorf("key %s isn't in type map", p.Key)
+			}
+			continue
+		}
+
+		raw, err := pairValue(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got[p.Key], err = restoreTypedValue(raw, kind); err != nil {
+			t.Fatalf("%s: %v", p.Key, err)
+		}
+	}
+
+	// Whole float is written as an integer but restored as a float.
+	want := map[string]interface{}{
+		"billing/name":       "billing",
+		"billing/port":       int64(8080),
+		"billing/ratio":      2.0,
+		"billing/enabled":    true,
+		"billing/started":    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"billing/tags":       []interface{}{"a", "b"},
+		"billing/db/timeout": 1.5,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restored values\n%v\nwant\n%v", got, want)
+	}
+	for _, p := range pairs {
+		if v, _ := pairValue(p); p.Key == "billing/ratio" && v != "2" {
+			t.Errorf("whole float written as %s, want 2", v)
+		}
+	}
+	if len(types) != len(want) {
+		t.Errorf("type map has %d keys, want %d: %v", len(types), len(want), types)
+	}
+}
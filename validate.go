@@ -0,0 +1,146 @@
+// Validations on generated KV pairs.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Default max key length in bytes.
+const defaultMaxKeyLength = 512
+
+// Validate generated KV pairs.
+func validateKVPairs(pairs []consulKVPair) error {
+	if kvMaxKeyLength > 0 {
+		var long []string
+		for _, p := range pairs {
+			if len(p.Key) > kvMaxKeyLength {
+				long = append(long, fmt.Sprintf("%s (%d bytes)", p.Key, len(p.Key)))
+			}
+		}
+
+		if len(long) > 0 {
+			return fmt.Errorf("keys exceed max key length of %d bytes: %s", kvMaxKeyLength, strings.Join(long, ", "))
+		}
+	}
+
+	if kvEnforcePrefix != "" {
+		var outside []string
+		for _, p := range pairs {
+			if !hasPathPrefix(p.Key, kvEnforcePrefix, kvDelimiter) {
+				outside = append(outside, p.Key)
+			}
+		}
+
+		if len(outside) > 0 {
+			return fmt.Errorf("keys outside enforced prefix %s: %s", kvEnforcePrefix, strings.Join(outside, ", "))
+		}
+	}
+
+	if kvKeyValidationRegex != "" {
+		// Pattern has to match the whole key.
+		re, err := regexp.Compile(`^(?:` + kvKeyValidationRegex + `)$`)
+		if err != nil {
+			return fmt.Errorf("invalid key validation regex - %v", err)
+		}
+
+		var invalid []string
+		for _, p := range pairs {
+			if !re.MatchString(p.Key) {
+				invalid = append(invalid, p.Key)
+			}
+		}
+
+		if len(invalid) > 0 {
+			return fmt.Errorf("keys don't match key validation regex %s: %s", kvKeyValidationRegex, strings.Join(invalid, ", "))
+		}
+	}
+
+	if kvExpectKeysFile != "" {
+		if err := checkExpectedKeys(pairs, kvExpectKeysFile); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Check that generated keys are exactly the keys listed in expected keys file.
+func checkExpectedKeys(pairs []consulKVPair, fPath string) error {
+	expected, err := readKeysFile(fPath)
+	if err != nil {
+		return fmt.Errorf("error reading expected keys file - %v", err)
+	}
+
+	generated := make(map[string]bool, len(pairs))
+	for _, p := range pairs {
+		generated[p.Key] = true
+	}
+
+	var missing, unexpected []string
+	for k := range expected {
+		if !generated[k] {
+			missing = append(missing, k)
+		}
+	}
+	for k := range generated {
+		if !expected[k] {
+			unexpected = append(unexpected, k)
+		}
+	}
+
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return nil
+	}
+
+	sort.Strings(missing)
+	sort.Strings(unexpected)
+
+	var msgs []string
+	if len(missing) > 0 {
+		msgs = append(msgs, fmt.Sprintf("missing keys: %s", strings.Join(missing, ", ")))
+	}
+	if len(unexpected) > 0 {
+		msgs = append(msgs, fmt.Sprintf("unexpected keys: %s", strings.Join(unexpected, ", ")))
+	}
+
+	return fmt.Errorf("keys differ from %s - %s", fPath, strings.Join(msgs, "; "))
+}
+
+// Read file with newline separated list of keys. Empty lines and lines starting with # are ignored.
+func readKeysFile(fPath string) (map[string]bool, error) {
+	f, err := os.Open(fPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keys := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keys[line] = true
+	}
+
+	return keys, scanner.Err()
+}
+
+// Check if key is the prefix path or under it. Prefix is matched by whole path segments
+// so that prefix app doesn't match key application/name.
+func hasPathPrefix(key string, prefix string, delimiter string) bool {
+	prefix = trimDelimiter(prefix, delimiter)
+	if prefix == "" {
+		return true
+	}
+
+	return key == prefix || strings.HasPrefix(key, prefix+delimiter)
+}
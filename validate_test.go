@@ -0,0 +1,162 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMaxKeyLength(t *testing.T) {
+	// Nested tables of 26 segments of 20 bytes give a key of 545 bytes.
+	var b strings.Builder
+	var segs []string
+	for c := 'a'; c <= 'z'; c++ {
+		segs = append(segs, strings.Repeat(string(c), 20))
+	}
+	b.WriteString("[" + strings.Join(segs[:len(segs)-1], ".") + "]\n")
+	b.WriteString(segs[len(segs)-1] + " = 1\n")
+	fPath := writeTestFile(t, "config.toml", b.String())
+	long := strings.Join(segs, "/")
+
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{nil, "keys exceed max key length of 512 bytes: " + long + " (545 bytes)"},
+		{[]string{"--max-key-length", "545"}, ""},
+		{[]string{"--max-key-length", "0"}, ""},
+		{[]string{"--max-key-length", "100", "--prefix", "app"}, "keys exceed max key length of 100 bytes: app/" + long + " (549 bytes)"},
+	}
+
+	for _, tt := range tests {
+		// Convert without the check and validate the pairs with flags of the test.
+		pairs := testKVPairs(t, append(append([]string{}, tt.args...), "--max-key-length", "0", fPath)...)
+		testCmd(t, append([]string{"kv"}, tt.args...)...)
+
+		err := validateKVPairs(pairs)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%v: unexpected error %v", tt.args, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%v: error = %v, want %q", tt.args, err, tt.err)
+		}
+	}
+
+	// Conversion fails naming the long key.
+	_, stderr, code := runCLI(t, "", "kv", fPath)
+	if code == 0 || !strings.Contains(stderr, long+" (545 bytes)") {
+		t.Errorf("exit code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestEnforcePrefix(t *testing.T) {
+	fPath := writeTestFile(t, "config.toml", "name = \"app\"\n\n[db]\nport = 5432\n")
+
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"--prefix", "tenants/acme", "--enforce-prefix", "tenants/acme"}, ""},
+		{[]string{"--prefix", "tenants/acme/app", "--enforce-prefix", "/tenants/acme/"}, ""},
+		{[]string{"--prefix", "tenants/acme-corp", "--enforce-prefix", "tenants/acme"}, "keys outside enforced prefix tenants/acme: tenants/acme-corp/db/port, tenants/acme-corp/name"},
+		{[]string{"--enforce-prefix", "tenants/acme"}, "keys outside enforced prefix tenants/acme: db/port, name"},
+		{[]string{"--delimiter", ".", "--prefix", "tenants.acme", "--enforce-prefix", "tenants.acme"}, ""},
+	}
+
+	for _, tt := range tests {
+		_, stderr, code := runCLI(t, "", append(append([]string{"kv"}, tt.args...), fPath)...)
+		switch {
+		case tt.err == "" && code != 0:
+			t.Errorf("%v: exit code %d, stderr %q", tt.args, code, stderr)
+		case tt.err != "" && (code == 0 || !strings.Contains(stderr, tt.err)):
+			t.Errorf("%v: exit code %d, stderr %q, want error %q", tt.args, code, stderr, tt.err)
+		}
+	}
+
+	// Keys of a settings prefix outside the enforced prefix fail too.
+	settings := writeTestFile(t, "settings.toml", "port = 1\n\n[_consul_cfg]\nprefix = \"tenants/other\"\n")
+	if _, stderr, code := runCLI(t, "", "kv", "--enforce-prefix", "tenants/acme", settings); code == 0 || !strings.Contains(stderr, "tenants/other/port") {
+		t.Errorf("settings prefix: exit code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	tests := []struct {
+		key, prefix string
+		want        bool
+	}{
+		{"app/db", "app", true},
+		{"app", "app", true},
+		{"app/db", "/app/", true},
+		{"apple/db", "app", false},
+		{"app", "app/db", false},
+		{"anything", "", true},
+	}
+
+	for _, tt := range tests {
+		if got := hasPathPrefix(tt.key, tt.prefix, "/"); got != tt.want {
+			t.Errorf("hasPathPrefix(%q, %q) = %v, want %v", tt.key, tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestExpectKeys(t *testing.T) {
+	config := writeTestFile(t, "config.toml", "name = \"app\"\n\n[db]\nhost = \"pg\"\nport = 5432\n")
+	expected := writeTestFile(t, "keys.txt", `
+# Keys of the app.
+app/db/host
+  app/db/port
+
+app/name
+`)
+	pairs := testKVPairs(t, "--prefix", "app", config)
+	if err := checkExpectedKeys(pairs, expected); err != nil {
+		t.Errorf("matching keys: %v", err)
+	}
+
+	// Missing and unexpected keys are both reported, sorted.
+	stale := writeTestFile(t, "stale.txt", "app/name\napp/db/user\napp/db/pass\n")
+	err := checkExpectedKeys(pairs, stale)
+	want := "keys differ from " + stale + " - missing keys: app/db/pass, app/db/user; unexpected keys: app/db/host, app/db/port"
+	if err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %s", err, want)
+	}
+
+	if _, stderr, code := runCLI(t, "", "kv", "--prefix", "app", "--expect-keys", expected, config); code != 0 {
+		t.Errorf("matching keys: exit code %d, stderr %s", code, stderr)
+	}
+	_, stderr, code := runCLI(t, "", "kv", "--expect-keys", expected, config)
+	if code == 0 || !strings.Contains(stderr, "missing keys: app/db/host, app/db/port, app/name; unexpected keys: db/host, db/port, name") {
+		t.Errorf("mismatching keys: exit code %d, stderr %s", code, stderr)
+	}
+}
+
+func TestKeyValidationRegex(t *testing.T) {
+	var pairs []consulKVPair
+	for _, k := range []string{"myconfig/db/App", "myconfig/db/max-conns", "myconfig/name"} {
+		pairs = append(pairs, testPair(k, "1"))
+	}
+
+	tests := []struct {
+		regex string
+		err   string
+	}{
+		{`[a-zA-Z0-9_/-]+`, ""},
+		{`.*/[a-zA-Z-]+`, ""},
+		// Anchored to the whole key, so matching a part isn't enough.
+		{`[a-z0-9_]+(/[a-z0-9_]+)*`, "keys don't match key validation regex [a-z0-9_]+(/[a-z0-9_]+)*: myconfig/db/App, myconfig/db/max-conns"},
+		{`db`, "keys don't match key validation regex db: myconfig/db/App, myconfig/db/max-conns, myconfig/name"},
+		{`a|.*`, ""},
+		{`[`, "invalid key validation regex"},
+	}
+	for _, tt := range tests {
+		testCmd(t, "kv", "--key-validation-regex", tt.regex)
+		err := validateKVPairs(pairs)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.regex, err)
+		case tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)):
+			t.Errorf("%s: error = %v, want %q", tt.regex, err, tt.err)
+		}
+	}
+	testCmd(t, "kv")
+}
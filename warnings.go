@@ -0,0 +1,102 @@
+// Warnings collected while converting configs.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Warning categories.
+const (
+	// Array of maps JSON encoded as a single value.
+	warnArrayBlob = "array-blob"
+	// Keys which differ only by case.
+	warnCaseCollision = "case-collision"
+	// Value larger than Consul's default max value size.
+	warnOversizedValue = "oversized-value"
+)
+
+// Consul's default max value size (`kv_max_value_size`).
+const consulMaxValueSize = 512 * 1024
+
+type warning struct {
+	category string
+	message  string
+}
+
+// Warning line written to warnings file.
+type warningLine struct {
+	Category string `json:"category"`
+	Message  string `json:"message"`
+}
+
+// Collected warnings.
+var warnings []warning
+
+// Add a warning to the collector.
+func addWarning(category string, format string, args ...interface{}) {
+	warnings = append(warnings, warning{
+		category: category,
+		message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Check KV pairs for keys which differ only by case, values which are too big and secrets if enabled.
+func checkKVPairs(pairs []consulKVPair) {
+	seen := make(map[string]string)
+	for _, p := range pairs {
+		lower := strings.ToLower(p.Key)
+		if k, ok := seen[lower]; ok && k != p.Key {
+			addWarning(warnCaseCollision, "keys %s and %s differ only by case", k, p.Key)
+		} else if !ok {
+			seen[lower] = p.Key
+		}
+
+		v, err := pairValue(p)
+		if err == nil && len(v) > consulMaxValueSize {
+			addWarning(warnOversizedValue, "value of key %s is %d bytes which exceeds Consul's default limit of %d bytes", p.Key, len(v), consulMaxValueSize)
+		}
+	}
+
+	if kvDetectSecrets {
+		detectSecrets(pairs)
+	}
+}
+
+// Print collected warnings to stderr or write them to warnings file if set. Returns error if warnings
+// are treated as errors.
+func flushWarnings() error {
+	if kvWarningsFile != "" {
+		if err := writeWarningsFile(kvWarningsFile); err != nil {
+			return fmt.Errorf("error writing warnings file - %v", err)
+		}
+	} else {
+		for _, w := range warnings {
+			errLog.Printf("Warning: [%s] %s", w.category, w.message)
+		}
+	}
+
+	if kvWarningsAsErrors && len(warnings) > 0 {
+		return fmt.Errorf("%d warning(s) treated as errors", len(warnings))
+	}
+
+	return nil
+}
+
+// Write collected warnings to file as JSON lines. File is truncated, so it's empty if there are no warnings.
+func writeWarningsFile(fPath string) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	for _, w := range warnings {
+		if err := enc.Encode(warningLine{Category: w.category, Message: w.message}); err != nil {
+			return err
+		}
+	}
+
+	return ioutil.WriteFile(fPath, buf.Bytes(), 0644)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWarningsAsErrors(t *testing.T) {
+	// Array of maps in json array mode and keys differing only by case are warnings.
+	fPath := writeTestFile(t, "config.toml", "[_consul_cfg]\nprefix = \"App\"\n\n[[servers]]\nhost = \"web\"\n")
+	other := writeTestFile(t, "other.toml", "[_consul_cfg]\nprefix = \"app\"\n\n[[servers]]\nhost = \"db\"\n")
+
+	stdout, stderr, code := runCLI(t, "", "kv", "--array-mode", "json", fPath, other)
+	if code != 0 {
+		t.Fatalf("exit code without --warnings-as-errors = %d, stderr: %s", code, stderr)
+	}
+	for _, w := range []string{"Warning: [array-blob]", "Warning: [case-collision] keys App/servers and app/servers differ only by case"} {
+		if !strings.Contains(stderr, w) {
+			t.Errorf("stderr doesn't have %q: %s", w, stderr)
+		}
+	}
+	if !strings.Contains(stdout, `"key": "App/servers"`) {
+		t.Errorf("output is missing without --warnings-as-errors: %s", stdout)
+	}
+
+	stdout, stderr, code = runCLI(t, "", "kv", "--warnings-as-errors", fPath, other)
+	if code == 0 {
+		t.Errorf("exit code with --warnings-as-errors = 0, want non zero")
+	}
+	if !strings.Contains(stderr, "Error: 3 warning(s) treated as errors") {
+		t.Errorf("stderr = %s", stderr)
+	}
+	if stdout != "" {
+		t.Errorf("output is printed with --warnings-as-errors: %s", stdout)
+	}
+
+	// Config without warnings passes.
+	clean := writeTestFile(t, "clean.toml", "name = \"a\"\n")
+	if _, stderr, code := runCLI(t, "", "kv", "--warnings-as-errors", clean); code != 0 {
+		t.Errorf("exit code for config without warnings = %d, stderr: %s", code, stderr)
+	}
+
+	// Check command fails the same way.
+	if _, _, code := runCLI(t, "", "check", "--warnings-as-errors", fPath); code == 0 {
+		t.Errorf("check exit code with --warnings-as-errors = 0, want non zero")
+	}
+}
+
+func TestWarningsFile(t *testing.T) {
+	fPath := writeTestFile(t, "config.toml", "[[servers]]\nhost = \"web\"\n")
+	warningsFile := filepath.Join(t.TempDir(), "warnings.jsonl")
+
+	_, stderr, code := runCLI(t, "", "kv", "--warnings-file", warningsFile, fPath)
+	if code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr)
+	}
+	if strings.Contains(stderr, "Warning:") {
+		t.Errorf("warnings are printed to stderr with --warnings-file: %s", stderr)
+	}
+
+	b, err := ioutil.ReadFile(warningsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"category":"array-blob","message":"array of maps at key servers is encoded as a single JSON value"}` + "\n"; string(b) != want {
+		t.Errorf("warnings file = %s, want %s", b, want)
+	}
+}
+
+func TestWarningsFileLines(t *testing.T) {
+	warningsFile := writeTestFile(t, "warnings.jsonl", "stale warnings\n")
+
+	// Every warning is a JSON line in the order warnings are found.
+	fPath := writeTestFile(t, "config.toml", "[[servers]]\nhost = \"web\"\n\n[[db]]\nhost = \"pg\"\n")
+	if _, stderr, code := runCLI(t, "", "kv", "--warnings-file", warningsFile, fPath); code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr)
+	}
+	b, err := ioutil.ReadFile(warningsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	keys := []string{"db", "servers"}
+	if len(lines) != len(keys) {
+		t.Fatalf("warnings file = %q, want %d lines", b, len(keys))
+	}
+	for i, l := range lines {
+		var w warningLine
+		if err := json.Unmarshal([]byte(l), &w); err != nil {
+			t.Fatalf("line %d isn't JSON: %v", i+1, err)
+		}
+		if w.Category != warnArrayBlob || !strings.Contains(w.Message, "at key "+keys[i]+" ") {
+			t.Errorf("line %d = %+v", i+1, w)
+		}
+	}
+
+	// File is truncated when there are no warnings.
+	clean := writeTestFile(t, "clean.toml", "name = \"a\"\n")
+	if _, stderr, code := runCLI(t, "", "kv", "--warnings-file", warningsFile, clean); code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr)
+	}
+	if b, _ := ioutil.ReadFile(warningsFile); len(b) != 0 {
+		t.Errorf("warnings file isn't truncated: %q", b)
+	}
+
+	// Warnings file which can't be written is an error.
+	missing := filepath.Join(t.TempDir(), "missing", "warnings.jsonl")
+	if _, stderr, code := runCLI(t, "", "kv", "--warnings-file", missing, fPath); code == 0 || !strings.Contains(stderr, "error writing warnings file") {
+		t.Errorf("exit code = %d, stderr: %s", code, stderr)
+	}
+}